@@ -111,7 +111,12 @@ func runConvert(options *convertOptions) error {
 		"# only search for .desktop file in the squashfs-root directory",
 		"DESKTOP_FILE=$(find squashfs-root -maxdepth 1 -regex '.*\\.desktop' -exec basename {} \\;)",
 		"cp squashfs-root/${DESKTOP_FILE} .",
-		"sed -i \"s@Exec=.*@Exec=${PREFIX}/bin/${BINNAME}@\" ${DESKTOP_FILE}",
+		// desktop 文件在构建时才能从 AppImage 中解出，只替换 Exec 的程序并保留参数和域代码
+		"if command -v ll-pica >/dev/null 2>&1; then",
+		"  ll-pica desktop --exec ${PREFIX}/bin/${BINNAME} ${DESKTOP_FILE} || exit 1",
+		"else", // 构建环境中没有 ll-pica 时使用 sed 替换
+		`  sed -i -E "s@^Exec=(\"[^\"]*\"|[^ ]*)@Exec=${PREFIX}/bin/${BINNAME}@; /^TryExec=/d" ${DESKTOP_FILE}`,
+		"fi",
 
 		"cd squashfs-root",
 		"if [ ! $PREFIX ]; then",
@@ -181,24 +186,27 @@ func runConvert(options *convertOptions) error {
 	linglongYamlPath := filepath.Join(workDir, comm.LinglongYaml)
 
 	// 生成 linglong.yaml 文件
-	if builder.CreateLinglongYaml(linglongYamlPath) {
-		log.Logger.Infof("generate %s success.", comm.LinglongYaml)
-	} else {
-		log.Logger.Errorf("generate %s failed", comm.LinglongYaml)
+	if err := builder.CreateLinglongYaml(linglongYamlPath); err != nil {
+		return err
 	}
+	log.Logger.Infof("generate %s success.", comm.LinglongYaml)
 
 	log.Logger.Info("building linglong package")
 
 	// 构建玲珑包
 	if options.buildFlag {
 		buildLinglongPath := filepath.Dir(linglongYamlPath)
-		builder.LinglongBuild(buildLinglongPath, "ll-builder build --skip-output-check")
+		if err := builder.LinglongBuild(buildLinglongPath, "ll-builder build --skip-output-check"); err != nil {
+			return err
+		}
 
 		layerOpt := "uab"
 		if options.exportLayerFlag {
 			layerOpt = "layer"
 		}
-		builder.LinglongExport(buildLinglongPath, layerOpt)
+		if err := builder.LinglongExport(buildLinglongPath, layerOpt); err != nil {
+			return err
+		}
 	}
 
 	return nil
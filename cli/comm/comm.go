@@ -27,7 +27,8 @@ const (
 	LinglongYaml     = "linglong.yaml"
 	Workdir          = "linglong-pica"
 	PackageDir       = "package"
-	AptlyDir         = ".aptly"
+	AptlyDir         = "aptly"
+	PackageCacheDir  = "blobs"
 	LlSourceDir      = "linglong/sources"
 	LlLocalSourceDir = "sources"
 	StatesJson       = "/var/lib/linglong/states.json"
@@ -39,11 +40,13 @@ type Options struct {
 }
 
 type Source struct {
-	Kind    string
-	Digest  string
-	Url     string
-	Commit  string
-	Version string
+	Kind     string
+	Digest   string
+	Url      string
+	Commit   string
+	Version  string
+	SignedBy string `yaml:"-"` // 校验仓库签名的 key，只作为注释写入 linglong.yaml
+	Origin   string `yaml:"-"` // 包来自的 apt 仓库，只作为注释写入 linglong.yaml
 }
 
 func ExecAndWait(timeout int, name string, arg ...string) (stdout, stderr string, err error) {
@@ -158,9 +161,14 @@ func ConfigFilePath(work string, config string) string {
 	return configFilePath
 }
 
-// aptly 缓存路径
-func AptlyCachePath() string {
-	return filepath.Join(os.Getenv("HOME"), AptlyDir)
+// aptly 的状态目录，每个 profile 一个，保存仓库镜像和包索引
+func AptlyProfilePath(profile string) string {
+	return filepath.Join(PicaConfigPath(), AptlyDir, profile)
+}
+
+// 按 SHA256 存放下载的 deb 包的全局缓存，不随工作目录变化，多个应用共享
+func PackageCachePath() string {
+	return filepath.Join(os.Getenv("HOME"), ".cache", Workdir, PackageCacheDir)
 }
 
 // 返回转换过程中定义的离线包缓存路径
@@ -188,6 +196,20 @@ func ArchConvert(arch string) string {
 	}
 }
 
+// 与 ArchConvert 相反，将玲珑仓库或者 uname 中的架构名转换为 deb 包使用的架构名
+func DebArch(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "loongarch64":
+		return "loong64"
+	default:
+		return arch
+	}
+}
+
 // 对生成的 Source 数组进行去重
 func RemoveExcessDeps(sources []Source) []Source {
 	var result []Source
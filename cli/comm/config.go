@@ -11,6 +11,7 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"pkg.deepin.com/linglong/pica/tools/log"
 )
@@ -23,6 +24,96 @@ type Config struct {
 	Source        string `yaml:"source" json:"source"`
 	DistroVersion string `yaml:"distro_version" json:"distro_version"`
 	Arch          string `yaml:"arch" json:"arch"`
+	// 校验仓库签名的 keyring，为空时使用 apt 信任的 keyring
+	Keyrings []string `yaml:"keyrings,omitempty" json:"keyrings,omitempty"`
+	// 显式关闭仓库的签名校验
+	IgnoreSignatures bool `yaml:"ignore_signatures,omitempty" json:"ignore_signatures,omitempty"`
+	// 多个 apt 仓库，按优先级从高到低查找依赖，配置后不再使用 source 和 distro_version
+	Sources []AptSource `yaml:"sources,omitempty" json:"sources,omitempty"`
+	// aptly 状态目录的名称，不同 profile 的仓库镜像互不影响
+	Profile string `yaml:"profile,omitempty" json:"profile,omitempty"`
+	// 包索引的有效期，例如 6h，超过后检查仓库的 Release 是否变化
+	IndexTTL string `yaml:"index_ttl,omitempty" json:"index_ttl,omitempty"`
+	// 解析依赖时额外跟随的关系：recommends、suggests、all-variants
+	DepFollow []string `yaml:"dep_follow,omitempty" json:"dep_follow,omitempty"`
+	// 下载 deb 包和索引使用的 http 代理，为空时使用 http_proxy、https_proxy 环境变量
+	Proxy string `yaml:"proxy,omitempty" json:"proxy,omitempty"`
+}
+
+const (
+	DefaultProfile  = "default"
+	DefaultIndexTTL = 6 * time.Hour
+)
+
+// aptly 状态目录的名称
+func (c *Config) AptlyProfile() string {
+	if c.Profile == "" {
+		return DefaultProfile
+	}
+	return c.Profile
+}
+
+// 包索引的有效期，没有配置或者配置错误时使用默认值
+func (c *Config) IndexMaxAge() time.Duration {
+	if c.IndexTTL == "" {
+		return DefaultIndexTTL
+	}
+	ttl, err := time.ParseDuration(c.IndexTTL)
+	if err != nil {
+		log.Logger.Warnf("invalid index_ttl %s: %s", c.IndexTTL, err)
+		return DefaultIndexTTL
+	}
+	return ttl
+}
+
+// apt 仓库的默认优先级，与 apt pin 的默认值相同
+const DefaultAptPriority = 500
+
+// 一个 apt 仓库
+type AptSource struct {
+	Name             string   `yaml:"name,omitempty" json:"name,omitempty"` // 仓库名称，为空时根据地址生成
+	Url              string   `yaml:"url" json:"url"`                       // 本地仓库使用 file:// 地址或者绝对路径
+	Suite            string   `yaml:"suite" json:"suite"`
+	Components       []string `yaml:"components,omitempty" json:"components,omitempty"`       // 为空时使用 Release 中的所有组件
+	Architectures    []string `yaml:"architectures,omitempty" json:"architectures,omitempty"` // 为空时不限制架构
+	Priority         int      `yaml:"priority,omitempty" json:"priority,omitempty"`           // 数值大的优先，为空时为 500
+	Keyrings         []string `yaml:"keyrings,omitempty" json:"keyrings,omitempty"`
+	IgnoreSignatures bool     `yaml:"ignore_signatures,omitempty" json:"ignore_signatures,omitempty"`
+	Copy             bool     `yaml:"copy,omitempty" json:"copy,omitempty"`       // 本地仓库的包复制到应用的 sources 目录
+	Mirrors          []string `yaml:"mirrors,omitempty" json:"mirrors,omitempty"` // 仓库的镜像，下载失败时依次使用
+}
+
+// 配置的 apt 仓库，没有配置 sources 时使用 source 和 distro_version 作为唯一的仓库，
+// 仓库没有配置 keyrings 时使用 runtime 的 keyrings
+func (c *Config) AptSources() []AptSource {
+	if len(c.Sources) > 0 {
+		sources := append([]AptSource(nil), c.Sources...)
+		for idx := range sources {
+			if len(sources[idx].Keyrings) == 0 {
+				sources[idx].Keyrings = c.Keyrings
+			}
+		}
+		return sources
+	}
+	return []AptSource{{
+		Url:              c.Source,
+		Suite:            c.DistroVersion,
+		Keyrings:         c.Keyrings,
+		IgnoreSignatures: c.IgnoreSignatures,
+	}}
+}
+
+// 仓库是否包含指定架构
+func (s *AptSource) HasArch(arch string) bool {
+	if len(s.Architectures) == 0 {
+		return true
+	}
+	for _, item := range s.Architectures {
+		if DebArch(item) == arch {
+			return true
+		}
+	}
+	return false
 }
 
 // 定义 states.json 的结构体
@@ -106,7 +197,7 @@ func (c *Config) SaveOrUpdateConfigJson(path string) bool {
 
 	err = os.WriteFile(path, jsonBytes, 0644)
 	if err != nil {
-		log.Logger.Fatalf("save to %s failed!", path)
+		log.Logger.Errorf("save to %s failed: %s", path, err)
 		return false
 	}
 
@@ -0,0 +1,92 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package comm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 转换失败的阶段
+type Stage string
+
+const (
+	StageConfig   Stage = "config"   // 读取或生成配置文件
+	StageResolve  Stage = "resolve"  // 在仓库中查找包和解析依赖
+	StageFetch    Stage = "fetch"    // 下载和校验 deb 包
+	StageExtract  Stage = "extract"  // 解压和读取 deb 包
+	StageGenerate Stage = "generate" // 生成 linglong.yaml
+	StageBuild    Stage = "build"    // ll-builder build
+	StageExport   Stage = "export"   // ll-builder export
+)
+
+// 退出码，多个应用转换失败时使用第一个失败的退出码
+const (
+	ExitOK       = 0
+	ExitFailure  = 1 // 其他错误
+	ExitConfig   = 2
+	ExitResolve  = 3
+	ExitFetch    = 4
+	ExitExtract  = 5
+	ExitGenerate = 6
+	ExitBuild    = 7
+	ExitExport   = 8
+)
+
+var stageExitCodes = map[Stage]int{
+	StageConfig:   ExitConfig,
+	StageResolve:  ExitResolve,
+	StageFetch:    ExitFetch,
+	StageExtract:  ExitExtract,
+	StageGenerate: ExitGenerate,
+	StageBuild:    ExitBuild,
+	StageExport:   ExitExport,
+}
+
+// 转换中某个阶段的错误，Target 为出错的包名或者路径，Err 为原始错误
+type StageError struct {
+	Stage  Stage
+	Target string
+	Err    error
+}
+
+func (e *StageError) Error() string {
+	if e.Target == "" {
+		return fmt.Sprintf("%s: %s", e.Stage, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Stage, e.Target, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// 包装为 stage 阶段的错误，已经是 StageError 时保留原来的阶段
+func NewStageError(stage Stage, target string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		return err
+	}
+	return &StageError{Stage: stage, Target: target, Err: err}
+}
+
+// 错误对应的退出码
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		if code, ok := stageExitCodes[stageErr.Stage]; ok {
+			return code
+		}
+	}
+	return ExitFailure
+}
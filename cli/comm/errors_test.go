@@ -0,0 +1,40 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package comm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errNetwork = errors.New("connection refused")
+
+var testDataExitCode = []struct {
+	err  error
+	code int
+}{
+	{nil, ExitOK},
+	{errNetwork, ExitFailure},
+	{NewStageError(StageFetch, "libfoo", errNetwork), ExitFetch},
+	{fmt.Errorf("org.demo [amd64]: %w", NewStageError(StageBuild, "/tmp/app", errNetwork)), ExitBuild},
+	// 已经包装过的错误保留原来的阶段
+	{NewStageError(StageResolve, "app", NewStageError(StageExtract, "libfoo", errNetwork)), ExitExtract},
+	// 多个应用失败时使用第一个失败的退出码
+	{errors.Join(NewStageError(StageExport, "a", errNetwork), NewStageError(StageFetch, "b", errNetwork)), ExitExport},
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tds := range testDataExitCode {
+		if code := ExitCode(tds.err); code != tds.code {
+			t.Errorf("Failed test for ExitCode! Error: %v want %d, got %d", tds.err, tds.code, code)
+		}
+	}
+	if err := NewStageError(StageFetch, "libfoo", errNetwork); !errors.Is(err, errNetwork) {
+		t.Errorf("Failed test for NewStageError! Error: %v does not wrap %v", err, errNetwork)
+	}
+}
@@ -7,6 +7,7 @@
 package adep
 
 import (
+	"errors"
 	"path/filepath"
 	"strings"
 
@@ -43,7 +44,7 @@ func NewADepCommand() *cobra.Command {
 
 func runAdep(options *adepOptions) error {
 	if options.deps == "" {
-		log.Logger.Fatal("The parameter d has not been set ")
+		return errors.New("the parameter d has not been set")
 	}
 
 	path, err := filepath.Abs(options.path)
@@ -72,10 +73,9 @@ func runAdep(options *adepOptions) error {
 	depList := strings.Split(options.deps, ",")
 	allDepends := append(builder.BuildExt.Apt.Depends, depList...)
 	builder.BuildExt.Apt.Depends = comm.RemoveExcessDepends(allDepends)
-	if builder.CreateLinglongYaml(path) {
-		log.Logger.Infof("generate %s success.", comm.LinglongYaml)
-	} else {
-		log.Logger.Errorf("generate %s failed", comm.LinglongYaml)
+	if err := builder.CreateLinglongYaml(path); err != nil {
+		return err
 	}
+	log.Logger.Infof("generate %s success.", comm.LinglongYaml)
 	return nil
 }
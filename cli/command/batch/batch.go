@@ -0,0 +1,306 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/cli/command/convert"
+	"pkg.deepin.com/linglong/pica/cli/config"
+	"pkg.deepin.com/linglong/pica/cli/deb"
+	"pkg.deepin.com/linglong/pica/cli/report"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+type batchOptions struct {
+	comm.Options
+	list        string   // 需要转换的包列表
+	jobs        int      // 同时转换的应用数
+	state       string   // 保存每个应用转换状态的文件
+	retryFailed bool     // 重新转换上次失败的应用
+	archs       []string // 转换的目标架构
+	withDep     bool
+	elfDeps     bool
+	prefetch    bool
+	reportDir   string
+	markdown    bool
+	buildFlag   bool
+	exportFile  string
+}
+
+func NewBatchCommand() *cobra.Command {
+	var options batchOptions
+	cmd := &cobra.Command{
+		Use:          "batch",
+		Short:        "Convert a list of debs to uab in parallel",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runBatch(&options)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&options.list, "list", "l", "", "package list, csv with columns id,name,type,ref or yaml list of {id, name, type, ref}")
+	flags.StringVarP(&options.Config, "config", "c", "", "config file providing the runtime, the deb list in it is ignored")
+	flags.StringVarP(&options.Workdir, "workdir", "w", "", "work directory")
+	flags.IntVarP(&options.jobs, "jobs", "j", 4, "number of apps converted at the same time")
+	flags.StringVar(&options.state, "state", "", "state file recording the status of each app, default to batch-state.json in the work directory")
+	flags.BoolVar(&options.retryFailed, "retry-failed", false, "convert the apps failed in the previous run again")
+	flags.StringSliceVar(&options.archs, "arch", nil, "target architectures, e.g. amd64,arm64,loong64, default to the arch in package.yaml")
+	flags.BoolVar(&options.withDep, "withDep", false, "Add dependency tree")
+	flags.BoolVar(&options.elfDeps, "elfDeps", false, "Add packages providing libraries missing from ELF dependencies")
+	flags.BoolVar(&options.prefetch, "prefetch", false, "download depends into linglong/sources before generating linglong.yaml, so ll-builder can build offline")
+	flags.StringVar(&options.reportDir, "report-dir", "", "write report.json aggregating the reports of all apps to this directory")
+	flags.BoolVar(&options.markdown, "report-markdown", false, "write report.md next to each report.json")
+	flags.BoolVarP(&options.buildFlag, "build", "b", false, "build linglong")
+	flags.StringVar(&options.exportFile, "exportFile", "uab", "export uab or layer")
+	cmd.MarkFlagRequired("list")
+	return cmd
+}
+
+// 一个需要转换的应用，id 相同的行合并为一个应用
+type item struct {
+	id        string
+	debs      []deb.Deb
+	signature string
+}
+
+func runBatch(options *batchOptions) error {
+	options.Workdir = comm.WorkPath(options.Workdir)
+	if options.jobs < 1 {
+		options.jobs = 1
+	}
+	if options.state == "" {
+		options.state = filepath.Join(options.Workdir, StateFile)
+	}
+
+	debs, err := ReadList(options.list)
+	if err != nil {
+		return comm.NewStageError(comm.StageConfig, options.list, err)
+	}
+
+	packConfig := convert.InitPackConfig(options.Workdir)
+	// package.yaml 只用来提供 runtime 和仓库配置
+	if options.Config != "" {
+		configFilePath := comm.ConfigFilePath(options.Workdir, options.Config)
+		if ret := packConfig.ReadPackConfigYaml(configFilePath); !ret {
+			return comm.NewStageError(comm.StageConfig, configFilePath, errors.New("read pack config yaml error"))
+		}
+	}
+	if err := deb.ConfigureDownload(&packConfig.Runtime.Config); err != nil {
+		return comm.NewStageError(comm.StageConfig, comm.PicaConfigJsonPath(), err)
+	}
+
+	state, err := LoadState(options.state)
+	if err != nil {
+		return comm.NewStageError(comm.StageConfig, options.state, err)
+	}
+
+	archs := convert.TargetArchs(options.archs, packConfig.Runtime.Arch)
+	items := groupItems(debs, archs)
+	var pending []*item
+	for _, it := range items {
+		if state.Pending(it.id, it.signature, options.retryFailed) {
+			pending = append(pending, it)
+		} else {
+			log.Logger.Infof("skip %s, %s in the previous run", it.id, state.Status(it.id))
+		}
+	}
+	log.Logger.Infof("%d apps in %s, %d to convert with %d jobs", len(items), options.list, len(pending), options.jobs)
+
+	// 所有应用共用仓库的包索引，开始转换前先加载，避免多个应用同时加载同一份索引
+	archive := deb.NewCachedArchive(deb.NewRepositories(&packConfig.Runtime.Config))
+	if len(pending) > 0 {
+		for _, arch := range archs {
+			if _, err := archive.PackageIndex(arch); err != nil {
+				log.Logger.Warnf("load package index of %s error: %s", arch, err)
+			}
+		}
+	}
+
+	groupOptions := convert.GroupOptions{
+		WithDep:    options.withDep,
+		ElfDeps:    options.elfDeps,
+		Prefetch:   options.prefetch,
+		Build:      options.buildFlag,
+		ExportFile: options.exportFile,
+		Markdown:   options.markdown,
+	}
+	// base 和 runtime 中安装的包和库也只加载一次
+	if len(pending) > 0 {
+		groupOptions.Installed = deb.LoadInstalled(archs)
+	}
+	reports := convertItems(options, groupOptions, packConfig, archive, state, pending, archs)
+
+	// 汇总列表中所有应用的状态，包括之前运行时转换的应用
+	var failures []error
+	var all []*report.Report
+	for _, it := range items {
+		s := state.Item(it.id)
+		if s != nil && s.Status == StatusFailed {
+			failures = append(failures, fmt.Errorf("%s: %w", it.id, s.Err()))
+		}
+		if appReports, ok := reports[it.id]; ok {
+			all = append(all, appReports...)
+			continue
+		}
+		for _, arch := range archs {
+			if rep, err := report.Read(convert.AppPath(options.Workdir, it.id, arch, len(archs) > 1)); err == nil {
+				all = append(all, rep)
+			}
+		}
+	}
+	printSummary(items, state)
+	if options.reportDir != "" {
+		if err := report.NewSummary(all).Write(options.reportDir, options.markdown); err != nil {
+			log.Logger.Errorf("write report to %s error: %s", options.reportDir, err)
+		} else {
+			log.Logger.Infof("write report to %s", filepath.Join(options.reportDir, report.ReportJson))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d conversions failed: %w", len(failures), errors.Join(failures...))
+	}
+	return nil
+}
+
+// 使用 options.jobs 个 goroutine 转换应用，返回每个应用的报告
+func convertItems(options *batchOptions, groupOptions convert.GroupOptions, packConfig *config.PackConfig, archive deb.Archive,
+	state *State, pending []*item, archs []string) map[string][]*report.Report {
+	var lock sync.Mutex
+	reports := make(map[string][]*report.Report)
+	var done int
+
+	queue := make(chan *item)
+	var wg sync.WaitGroup
+	for i := 0; i < options.jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range queue {
+				appReports, err := convertItem(options, groupOptions, packConfig, archive, state, it, archs)
+				lock.Lock()
+				reports[it.id] = appReports
+				done++
+				if err != nil {
+					log.Logger.Errorf("[%d/%d] %s failed: %s", done, len(pending), it.id, err)
+				} else {
+					log.Logger.Infof("[%d/%d] %s converted", done, len(pending), it.id)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, it := range pending {
+		queue <- it
+	}
+	close(queue)
+	wg.Wait()
+	return reports
+}
+
+// 按列表中的顺序把 id 相同的行合并为一个应用
+func groupItems(debs []deb.Deb, archs []string) []*item {
+	var items []*item
+	index := make(map[string]*item)
+	for _, d := range debs {
+		it, ok := index[d.Id]
+		if !ok {
+			it = &item{id: d.Id}
+			index[d.Id] = it
+			items = append(items, it)
+		}
+		it.debs = append(it.debs, d)
+	}
+	for _, it := range items {
+		it.signature = Signature(it.debs, archs)
+	}
+	return items
+}
+
+// 转换一个应用的所有架构，状态在开始和结束时写入状态文件
+func convertItem(options *batchOptions, groupOptions convert.GroupOptions, packConfig *config.PackConfig, archive deb.Archive,
+	state *State, it *item, archs []string) ([]*report.Report, error) {
+	started := time.Now()
+	if err := state.Update(it.id, func(s *ItemState) {
+		s.Status = StatusRunning
+		s.Signature = it.signature
+		s.Started = started
+		s.Error = ""
+		s.Stage = ""
+	}); err != nil {
+		log.Logger.Warnf("save %s error: %s", options.state, err)
+	}
+
+	var reports []*report.Report
+	var failures []error
+	for _, arch := range archs {
+		// 每个架构使用独立的 deb 列表，获取和解压时会修改其中的字段
+		group := deb.GroupDebs(append([]deb.Deb(nil), it.debs...))[0]
+		appPath := convert.AppPath(options.Workdir, it.id, arch, len(archs) > 1)
+		rep, problems, err := convert.ConvertApp(groupOptions, packConfig, group, archive, appPath, arch)
+		reports = append(reports, rep)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("[%s] %w", arch, err))
+			continue
+		}
+		for _, problem := range problems {
+			log.Logger.Warnf("missing %s [%s]: %s", it.id, arch, problem)
+		}
+	}
+
+	err := errors.Join(failures...)
+	if err := state.Update(it.id, func(s *ItemState) {
+		s.Seconds = time.Since(started).Seconds()
+		if err != nil {
+			s.Status = StatusFailed
+			s.Error = err.Error()
+			var stageErr *comm.StageError
+			if errors.As(err, &stageErr) {
+				s.Stage = stageErr.Stage
+			}
+		} else {
+			s.Status = StatusSuccess
+		}
+	}); err != nil {
+		log.Logger.Warnf("save %s error: %s", options.state, err)
+	}
+	return reports, err
+}
+
+// 输出所有应用的转换结果
+func printSummary(items []*item, state *State) {
+	var success, failed int
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSTATUS\tSECONDS\tREASON")
+	for _, it := range items {
+		status, seconds, reason := StatusPending, 0.0, ""
+		if s := state.Item(it.id); s != nil {
+			status, seconds, reason = s.Status, s.Seconds, s.Error
+		}
+		switch status {
+		case StatusSuccess:
+			success++
+		case StatusFailed:
+			failed++
+		}
+		// 多个架构的错误只显示第一行
+		reason, _, _ = strings.Cut(reason, "\n")
+		fmt.Fprintf(writer, "%s\t%s\t%.1f\t%s\n", it.id, status, seconds, reason)
+	}
+	writer.Flush()
+	fmt.Printf("%d apps, %d succeeded, %d failed\n", len(items), success, failed)
+}
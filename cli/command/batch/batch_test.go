@@ -0,0 +1,105 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package batch
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	aptly "github.com/aptly-dev/aptly/deb"
+	"pkg.deepin.com/linglong/pica/cli/command/convert"
+	"pkg.deepin.com/linglong/pica/cli/config"
+	"pkg.deepin.com/linglong/pica/cli/deb"
+	"pkg.deepin.com/linglong/pica/cli/report"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+func init() {
+	log.Logger = log.InitLog()
+}
+
+// 生成只有 control 和一个文件的 deb 包
+func writeTestDeb(t *testing.T, path, control string) {
+	tarball := func(name, data string) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))})
+		tw.Write([]byte(data))
+		tw.Close()
+		return buf.Bytes()
+	}
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar", tarball("./control", control)},
+		{"data.tar", tarball("./usr/share/doc/README", "demo")},
+	} {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		buf.Write(member.data)
+		if len(member.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 多个应用同时转换，共用同一个仓库，使用 -race 运行时检查数据竞争
+func TestConvertItems(t *testing.T) {
+	dir := t.TempDir()
+	var debs []deb.Deb
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("demo%d", i)
+		path := filepath.Join(dir, name+"_1.0_amd64.deb")
+		writeTestDeb(t, path, fmt.Sprintf("Package: %s\nVersion: 1.0\nArchitecture: amd64\nDepends: libfoo1 (>= 1.0)\nDescription: %s\n", name, name))
+		debs = append(debs, deb.Deb{Id: "org.demo." + name, Name: name, Type: "local", Ref: path})
+	}
+	archive := deb.NewCachedArchive(deb.NewFakeArchive(dir, aptly.NewPackageFromControlFile(aptly.Stanza{
+		"Package":      "libfoo1",
+		"Version":      "1.2",
+		"Architecture": "amd64",
+		"Filename":     "pool/main/libfoo1_1.2_amd64.deb",
+		"SHA256":       "0123",
+	})))
+
+	archs := []string{"amd64"}
+	options := &batchOptions{jobs: 4}
+	options.Workdir = filepath.Join(dir, "work")
+	state, err := LoadState(filepath.Join(dir, StateFile))
+	if err != nil {
+		t.Fatalf("Failed test for LoadState! Error: %s", err)
+	}
+	groupOptions := convert.GroupOptions{
+		WithDep:   true,
+		ElfDeps:   true,
+		Installed: map[string][]deb.InstalledSet{"amd64": {}},
+	}
+	items := groupItems(debs, archs)
+	reports := convertItems(options, groupOptions, config.NewPackConfig(), archive, state, items, archs)
+
+	if len(reports) != len(items) {
+		t.Fatalf("Failed test for convertItems! Error: %d reports, want %d", len(reports), len(items))
+	}
+	for _, it := range items {
+		if s := state.Item(it.id); s == nil || s.Status != StatusSuccess {
+			t.Errorf("Failed test for convertItems! Error: %s state %+v", it.id, s)
+		}
+		reps := reports[it.id]
+		if len(reps) != 1 || reps[0].Status != report.StatusSuccess || len(reps[0].Depends) != 1 || reps[0].Depends[0].Name != "libfoo1" {
+			t.Errorf("Failed test for convertItems! Error: %s reports %+v", it.id, reps)
+		}
+	}
+}
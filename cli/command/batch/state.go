@@ -0,0 +1,234 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package batch
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/cli/deb"
+)
+
+const StateFile = "batch-state.json"
+
+// 应用的转换状态
+const (
+	StatusPending = "pending"
+	StatusRunning = "running" // 上次运行时被中断
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+type ItemState struct {
+	Status    string     `json:"status"`
+	Signature string     `json:"signature"` // 列表中的包和目标架构，变化后重新转换
+	Stage     comm.Stage `json:"stage,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Started   time.Time  `json:"started"`
+	Seconds   float64    `json:"seconds"`
+}
+
+// 失败的阶段和原因，用来计算退出码
+func (s *ItemState) Err() error {
+	err := errors.New(s.Error)
+	if s.Stage == "" {
+		return err
+	}
+	return &comm.StageError{Stage: s.Stage, Err: err}
+}
+
+// 批量转换的状态，每次变化后写入文件，中断后再次运行时从文件恢复
+type State struct {
+	path  string
+	lock  sync.Mutex
+	Items map[string]*ItemState `json:"items"`
+}
+
+func LoadState(path string) (*State, error) {
+	state := &State{path: path, Items: make(map[string]*ItemState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if state.Items == nil {
+		state.Items = make(map[string]*ItemState)
+	}
+	return state, nil
+}
+
+// 是否需要转换，已经成功并且输入没有变化的应用不再转换，失败的应用只在 retryFailed 时重新转换
+func (s *State) Pending(id, signature string, retryFailed bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	item, ok := s.Items[id]
+	if !ok || item.Signature != signature {
+		return true
+	}
+	switch item.Status {
+	case StatusSuccess:
+		return false
+	case StatusFailed:
+		return retryFailed
+	}
+	return true
+}
+
+func (s *State) Status(id string) string {
+	if item := s.Item(id); item != nil {
+		return item.Status
+	}
+	return StatusPending
+}
+
+// 应用状态的副本，不存在时返回 nil
+func (s *State) Item(id string) *ItemState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	item, ok := s.Items[id]
+	if !ok {
+		return nil
+	}
+	clone := *item
+	return &clone
+}
+
+// 修改应用的状态并写入文件
+func (s *State) Update(id string, fn func(item *ItemState)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	item, ok := s.Items[id]
+	if !ok {
+		item = &ItemState{Status: StatusPending}
+		s.Items[id] = item
+	}
+	fn(item)
+	return s.save()
+}
+
+// 先写入临时文件再重命名，中断时不会留下不完整的状态文件
+func (s *State) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// 应用的输入签名，列表中的包或者目标架构变化后重新转换
+func Signature(debs []deb.Deb, archs []string) string {
+	hash := sha256.New()
+	for _, d := range debs {
+		fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%s\n", d.Id, d.Name, d.Type, d.Ref)
+	}
+	fmt.Fprintf(hash, "%s\n", strings.Join(archs, ","))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// 读取包列表，.csv 文件按 id,name,type,ref 的列读取，可以有表头，其他文件按 yaml 列表读取。
+// type 默认为 repo，name 默认和 id 相同
+func ReadList(path string) ([]deb.Deb, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var debs []deb.Deb
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		debs, err = readCSV(fd)
+	} else {
+		err = yaml.NewDecoder(fd).Decode(&debs)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for idx := range debs {
+		d := &debs[idx]
+		d.Id = strings.TrimSpace(d.Id)
+		d.Name = strings.TrimSpace(d.Name)
+		d.Type = strings.TrimSpace(d.Type)
+		d.Ref = strings.TrimSpace(d.Ref)
+		if d.Id == "" {
+			return nil, fmt.Errorf("parse %s: entry %d has no id", path, idx+1)
+		}
+		if d.Name == "" {
+			d.Name = d.Id
+		}
+		if d.Type == "" {
+			d.Type = "repo"
+		}
+	}
+	return debs, nil
+}
+
+func readCSV(reader io.Reader) ([]deb.Deb, error) {
+	r := csv.NewReader(reader)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := []string{"id", "name", "type", "ref"}
+	// 第一行为表头时按表头中的列名读取
+	if len(records) > 0 && strings.EqualFold(strings.TrimSpace(records[0][0]), "id") {
+		columns = records[0]
+		records = records[1:]
+	}
+	var debs []deb.Deb
+	for _, record := range records {
+		var d deb.Deb
+		for idx, value := range record {
+			if idx >= len(columns) {
+				break
+			}
+			switch strings.ToLower(strings.TrimSpace(columns[idx])) {
+			case "id":
+				d.Id = value
+			case "name":
+				d.Name = value
+			case "type":
+				d.Type = value
+			case "ref":
+				d.Ref = value
+			}
+		}
+		debs = append(debs, d)
+	}
+	return debs, nil
+}
@@ -0,0 +1,86 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+)
+
+var testDataReadList = []struct {
+	file    string
+	content string
+	count   int
+}{
+	{"list.csv", "id,name,type,ref\norg.demo.app,demo,,\n# 注释\norg.demo.app,demo-data,local,/tmp/demo-data.deb\n", 2},
+	{"list.csv", "org.demo.app\norg.demo.other,other,repo\n", 2},
+	{"list.yaml", "- id: org.demo.app\n  name: demo\n- id: org.demo.other\n  type: local\n  ref: /tmp/other.deb\n", 2},
+}
+
+func TestReadList(t *testing.T) {
+	for _, tds := range testDataReadList {
+		path := filepath.Join(t.TempDir(), tds.file)
+		os.WriteFile(path, []byte(tds.content), 0644)
+		debs, err := ReadList(path)
+		if err != nil || len(debs) != tds.count {
+			t.Errorf("Failed test for ReadList! Error: %v, got %+v", err, debs)
+			continue
+		}
+		// type 默认为 repo，name 默认和 id 相同
+		if debs[0].Type != "repo" || debs[0].Name == "" || debs[1].Name == "" {
+			t.Errorf("Failed test for ReadList! Error: defaults not applied %+v", debs)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "list.csv")
+	os.WriteFile(path, []byte(",demo,repo\n"), 0644)
+	if _, err := ReadList(path); err == nil {
+		t.Errorf("Failed test for ReadList! Error: entry without id accepted")
+	}
+}
+
+func TestState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), StateFile)
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed test for LoadState! Error: %s", err)
+	}
+	state.Update("org.demo.ok", func(s *ItemState) { s.Status, s.Signature = StatusSuccess, "a" })
+	state.Update("org.demo.failed", func(s *ItemState) {
+		s.Status, s.Signature, s.Stage, s.Error = StatusFailed, "a", comm.StageFetch, "connection refused"
+	})
+	// 中断时正在转换的应用
+	state.Update("org.demo.running", func(s *ItemState) { s.Status, s.Signature = StatusRunning, "a" })
+
+	state, err = LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed test for LoadState! Error: %s", err)
+	}
+	for _, tds := range []struct {
+		id, signature string
+		retryFailed   bool
+		pending       bool
+	}{
+		{"org.demo.ok", "a", false, false},
+		{"org.demo.ok", "b", false, true},
+		{"org.demo.failed", "a", false, false},
+		{"org.demo.failed", "a", true, true},
+		{"org.demo.running", "a", false, true},
+		{"org.demo.new", "a", false, true},
+	} {
+		if pending := state.Pending(tds.id, tds.signature, tds.retryFailed); pending != tds.pending {
+			t.Errorf("Failed test for Pending! Error: %+v got %v", tds, pending)
+		}
+	}
+	// 上次失败的应用保留失败阶段对应的退出码
+	if err := state.Item("org.demo.failed").Err(); comm.ExitCode(err) != comm.ExitFetch || err.Error() != "fetch: connection refused" {
+		t.Errorf("Failed test for Err! Error: %v exit code %d", err, comm.ExitCode(err))
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/tools/cache"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+type pruneOptions struct {
+	olderThan string
+}
+
+func NewCacheCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the shared deb package cache",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "List cached packages, most recently used first",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runList()
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:          "du",
+		Short:        "Show the number and total size of cached packages",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDu()
+		},
+	})
+	cmd.AddCommand(newPruneCommand())
+	cmd.AddCommand(&cobra.Command{
+		Use:          "verify",
+		Short:        "Check the SHA256 of cached packages and remove corrupted ones",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerify()
+		},
+	})
+	return cmd
+}
+
+func newPruneCommand() *cobra.Command {
+	var options pruneOptions
+	cmd := &cobra.Command{
+		Use:          "prune",
+		Short:        "Remove packages not used for a while",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPrune(&options)
+		},
+	}
+	cmd.Flags().StringVar(&options.olderThan, "older-than", "30d", "remove packages not used within this duration, e.g. 12h, 30d, 0 removes all")
+	return cmd
+}
+
+func packageCache() *cache.Cache {
+	return cache.New(comm.PackageCachePath())
+}
+
+func runList() error {
+	entries, err := packageCache().List()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s  %8s  %s  %s\n", entry.SHA256[:12], formatSize(entry.Size), entry.Used.Format("2006-01-02 15:04"), entry.Name)
+	}
+	return nil
+}
+
+func runDu() error {
+	count, size, err := packageCache().Du()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d packages, %s in %s\n", count, formatSize(size), comm.PackageCachePath())
+	return nil
+}
+
+func runPrune(options *pruneOptions) error {
+	olderThan, err := parseAge(options.olderThan)
+	if err != nil {
+		return err
+	}
+	removed, err := packageCache().Prune(olderThan)
+	var size int64
+	for _, entry := range removed {
+		log.Logger.Debugf("remove %s %s", entry.SHA256, entry.Name)
+		size += entry.Size
+	}
+	fmt.Printf("removed %d packages, %s\n", len(removed), formatSize(size))
+	return err
+}
+
+func runVerify() error {
+	corrupted, err := packageCache().Verify()
+	for _, item := range corrupted {
+		fmt.Printf("removed %s\n", item)
+	}
+	if err != nil {
+		return err
+	}
+	if len(corrupted) > 0 {
+		return fmt.Errorf("%d corrupted packages removed", len(corrupted))
+	}
+	fmt.Println("all cached packages verified")
+	return nil
+}
+
+// 支持 time.ParseDuration 的格式以及按天计算的 30d
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %s", value)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	idx := 0
+	for value >= 1024 && idx < len(units)-1 {
+		value /= 1024
+		idx++
+	}
+	if idx == 0 {
+		return fmt.Sprintf("%d%s", size, units[idx])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[idx])
+}
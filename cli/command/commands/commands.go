@@ -9,12 +9,24 @@ package commands
 import (
 	"github.com/spf13/cobra"
 	"pkg.deepin.com/linglong/pica/cli/command/adep"
+	"pkg.deepin.com/linglong/pica/cli/command/batch"
+	"pkg.deepin.com/linglong/pica/cli/command/cache"
 	"pkg.deepin.com/linglong/pica/cli/command/convert"
+	"pkg.deepin.com/linglong/pica/cli/command/desktop"
 	minit "pkg.deepin.com/linglong/pica/cli/command/init"
+	"pkg.deepin.com/linglong/pica/cli/command/relocate"
+	"pkg.deepin.com/linglong/pica/cli/command/repo"
+	"pkg.deepin.com/linglong/pica/cli/command/version"
 )
 
 func AddCommands(cmd *cobra.Command) {
 	cmd.AddCommand(minit.NewInitCommand())
 	cmd.AddCommand(convert.NewConvertCommand())
+	cmd.AddCommand(batch.NewBatchCommand())
 	cmd.AddCommand(adep.NewADepCommand())
+	cmd.AddCommand(version.NewVersionCommand())
+	cmd.AddCommand(relocate.NewRelocateCommand())
+	cmd.AddCommand(desktop.NewDesktopCommand())
+	cmd.AddCommand(repo.NewRepoCommand())
+	cmd.AddCommand(cache.NewCacheCommand())
 }
@@ -7,17 +7,20 @@
 package convert
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"net"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/spf13/cobra"
-	"pault.ag/go/debian/control"
 	"pkg.deepin.com/linglong/pica/cli/comm"
 	"pkg.deepin.com/linglong/pica/cli/config"
 	"pkg.deepin.com/linglong/pica/cli/deb"
 	"pkg.deepin.com/linglong/pica/cli/linglong"
+	"pkg.deepin.com/linglong/pica/cli/report"
+	"pkg.deepin.com/linglong/pica/tools/download"
 	"pkg.deepin.com/linglong/pica/tools/fs"
 	"pkg.deepin.com/linglong/pica/tools/log"
 )
@@ -27,7 +30,13 @@ type convertOptions struct {
 	gtype       string
 	packageId   string
 	packageName string
-	withDep     bool // 带上依赖树
+	withDep     bool     // 带上依赖树
+	elfDeps     bool     // 补充提供缺失库的包
+	archs       []string // 转换的目标架构
+	update      []string // 不使用 pica.lock 中锁定版本的包，* 表示所有包
+	prefetch    bool     // 生成 linglong.yaml 前下载依赖包到 linglong/sources
+	reportDir   string   // 汇总所有应用转换报告的目录
+	markdown    bool     // 同时生成 markdown 格式的报告
 	buildFlag   bool
 	exportFile  string
 }
@@ -50,16 +59,46 @@ func NewConvertCommand() *cobra.Command {
 	flags.StringVar(&options.packageId, "pi", "", "package id")
 	flags.StringVar(&options.packageName, "pn", "", "package name")
 	flags.BoolVar(&options.withDep, "withDep", false, "Add dependency tree")
+	flags.BoolVar(&options.elfDeps, "elfDeps", false, "Add packages providing libraries missing from ELF dependencies")
+	flags.StringSliceVar(&options.archs, "arch", nil, "target architectures, e.g. amd64,arm64,loong64, default to the arch in package.yaml")
+	flags.StringSliceVar(&options.update, "update", nil, "re-resolve packages locked in pica.lock, all packages when no name given, e.g. --update=libfoo,libbar")
+	flags.Lookup("update").NoOptDefVal = "*"
+	flags.BoolVar(&options.prefetch, "prefetch", false, "download depends into linglong/sources before generating linglong.yaml, so ll-builder can build offline")
+	flags.StringVar(&options.reportDir, "report-dir", "", "write report.json aggregating the reports of all apps to this directory")
+	flags.BoolVar(&options.markdown, "report-markdown", false, "write report.md next to each report.json")
 	flags.BoolVarP(&options.buildFlag, "build", "b", false, "build linglong")
 	flags.StringVar(&options.exportFile, "exportFile", "uab", "export uab or layer")
 	return cmd
 }
 
-func runConvert(options *convertOptions) error {
-	options.Workdir = comm.WorkPath(options.Workdir)
-	configFilePath := comm.ConfigFilePath(options.Workdir, options.Config)
+// 转换单个应用的选项，convert 和 batch 共用
+type GroupOptions struct {
+	WithDep    bool           // 带上依赖树
+	ElfDeps    bool           // 补充提供缺失库的包
+	Update     deb.LockUpdate // 不使用 pica.lock 中锁定版本的包
+	Prefetch   bool           // 生成 linglong.yaml 前下载依赖包到 linglong/sources
+	Build      bool
+	ExportFile string
+	Markdown   bool // 同时生成 markdown 格式的报告
+	// 各架构 base 和 runtime 中安装的包和库，每个架构只加载一次，没有对应架构时转换时加载
+	Installed map[string][]deb.InstalledSet
+}
 
-	comm.InitWorkDir(options.Workdir)
+func (options *convertOptions) groupOptions() GroupOptions {
+	return GroupOptions{
+		WithDep:    options.withDep,
+		ElfDeps:    options.elfDeps,
+		Update:     options.lockUpdate(),
+		Prefetch:   options.prefetch,
+		Build:      options.buildFlag,
+		ExportFile: options.exportFile,
+		Markdown:   options.markdown,
+	}
+}
+
+// 初始化工作目录和 pica 配置目录，读取 ~/.pica/config.json，不存在时生成一份默认配置
+func InitPackConfig(workdir string) *config.PackConfig {
+	comm.InitWorkDir(workdir)
 	comm.InitPicaConfigDir()
 
 	packConfig := config.NewPackConfig()
@@ -71,29 +110,33 @@ func runConvert(options *convertOptions) error {
 		// 如果存在 pica 配置文件解析配置文件
 		packConfig.Runtime.ReadConfigJson()
 	}
+	return packConfig
+}
+
+func runConvert(options *convertOptions) error {
+	options.Workdir = comm.WorkPath(options.Workdir)
+	configFilePath := comm.ConfigFilePath(options.Workdir, options.Config)
+	packConfig := InitPackConfig(options.Workdir)
 
 	// 如果传入的是 deb 包， 先构造一下 package.yaml 文件
 	if strings.HasSuffix(options.Config, ".deb") {
-		ret, err := deb.AptShow(configFilePath)
-		if err == nil {
-			info, err := control.ParseControl(bufio.NewReader(strings.NewReader(ret)), "")
-			if err != nil {
-				log.Logger.Warnf("parse control error: %s", err)
-				return err
-			}
+		info, err := deb.ReadDebControl(configFilePath)
+		if err != nil {
+			log.Logger.Warnf("read control error: %s", err)
+			return err
+		}
 
-			packConfig.File.Deb = []deb.Deb{
-				{
-					Type: options.gtype,
-					Id:   info.Source.Paragraph.Values["Package"],
-					Ref:  configFilePath,
-					Name: info.Source.Paragraph.Values["Package"],
-				},
-			}
-			// 此时替换 configFilePath 为 工作目录的 package.yaml
-			configFilePath = comm.ConfigFilePath(options.Workdir, "")
-			packConfig.CreatePackConfigYaml(configFilePath)
+		packConfig.File.Deb = []deb.Deb{
+			{
+				Type: options.gtype,
+				Id:   info.Values["Package"],
+				Ref:  configFilePath,
+				Name: info.Values["Package"],
+			},
 		}
+		// 此时替换 configFilePath 为 工作目录的 package.yaml
+		configFilePath = comm.ConfigFilePath(options.Workdir, "")
+		packConfig.CreatePackConfigYaml(configFilePath)
 	}
 
 	if options.packageId != "" && options.packageName != "" {
@@ -108,101 +151,377 @@ func runConvert(options *convertOptions) error {
 	}
 
 	if ret := packConfig.ReadPackConfigYaml(configFilePath); !ret {
-		log.Logger.Fatalf("read pack config yaml error")
+		return comm.NewStageError(comm.StageConfig, configFilePath, errors.New("read pack config yaml error"))
 	}
 
-	for idx := range packConfig.File.Deb {
-		appPath := filepath.Join(comm.BuildPackPath(options.Workdir), packConfig.File.Deb[idx].Id)
-		linglongYamlPath := filepath.Join(appPath, comm.LinglongYaml)
+	// 下载使用 runtime 中配置的代理和仓库镜像
+	if err := deb.ConfigureDownload(&packConfig.Runtime.Config); err != nil {
+		return comm.NewStageError(comm.StageConfig, comm.PicaConfigJsonPath(), err)
+	}
 
-		// 如果已经存在 linglong.yaml 文件直接跳过。
-		if ret, err := fs.CheckFileExits(linglongYamlPath); ret && err == nil {
-			log.Logger.Infof("%s file already exists", linglongYamlPath)
-			continue
+	archs := TargetArchs(options.archs, packConfig.Runtime.Arch)
+	// 所有应用共用仓库的包索引
+	archive := deb.NewCachedArchive(deb.NewRepositories(&packConfig.Runtime.Config))
+	// base 和 runtime 中安装的包和库每个架构只加载一次
+	groupOptions := options.groupOptions()
+	groupOptions.Installed = deb.LoadInstalled(archs)
+	var missing []string
+	var failures []error
+	var reports []*report.Report
+	for _, arch := range archs {
+		// 每个架构使用独立的 deb 列表，获取和解压时会修改其中的字段
+		debs := append([]deb.Deb(nil), packConfig.File.Deb...)
+		// id 相同的 deb 包合并为一个玲珑应用
+		for _, group := range deb.GroupDebs(debs) {
+			appPath := AppPath(options.Workdir, group.Id, arch, len(archs) > 1)
+			// 单个应用失败时继续转换其他应用，最后汇总
+			rep, problems, err := ConvertApp(groupOptions, packConfig, group, archive, appPath, arch)
+			reports = append(reports, rep)
+			if err != nil {
+				err = fmt.Errorf("%s [%s]: %w", group.Id, arch, err)
+				log.Logger.Errorf("convert %s", err)
+				failures = append(failures, err)
+				continue
+			}
+			for _, problem := range problems {
+				missing = append(missing, fmt.Sprintf("%s [%s]: %s", group.Id, arch, problem))
+			}
 		}
+	}
 
-		fs.CreateDir(appPath)
-		// 如果 Ref 为空，type 为 repo, 那么先使用 aptly 获取 url 链接， 如果没有就使用 apt download 获取 url 链接，
-		// 另外的如果 type 为 local 直接将 deb 包下载到工作目录
-		if packConfig.File.Deb[idx].Ref == "" {
-			packConfig.File.Deb[idx].Ref = packConfig.File.Deb[idx].GetPackageUrl(packConfig.Runtime.Source, packConfig.Runtime.DistroVersion, packConfig.Runtime.Arch)
-			if packConfig.File.Deb[idx].Ref == "" {
-				log.Logger.Fatalf("get package url failed")
-			}
-			packConfig.File.Deb[idx].Path = filepath.Join(comm.LocalPackageSourceDir(appPath), filepath.Base(packConfig.File.Deb[idx].Ref))
-		}
-		// fetch deb file
-		if len(packConfig.File.Deb[idx].Ref) > 0 {
-			packConfig.File.Deb[idx].Path = filepath.Join(comm.LocalPackageSourceDir(appPath), filepath.Base(packConfig.File.Deb[idx].Ref))
-
-			if ret, _ := fs.CheckFileExits(packConfig.File.Deb[idx].Path); ret {
-				if hash := packConfig.File.Deb[idx].CheckDebHash(); hash {
-					log.Logger.Infof("download skipped because of %s cached", packConfig.File.Deb[idx].Name)
-				} else {
-					log.Logger.Warnf("check deb hash failed! : ", packConfig.File.Deb[idx].Name)
-					fs.RemovePath(packConfig.File.Deb[idx].Path)
-
-					packConfig.File.Deb[idx].FetchDebFile(packConfig.File.Deb[idx].Path)
-					log.Logger.Debugf("fetch deb path:[%d] %s", idx, packConfig.File.Deb[idx].Path)
-
-					if ret := packConfig.File.Deb[idx].CheckDebHash(); !ret {
-						log.Logger.Warnf("check deb hash failed! : ", packConfig.File.Deb[idx].Name)
-						continue
-					}
-					log.Logger.Infof("download %s success.", packConfig.File.Deb[idx].Name)
-				}
-			} else {
-				packConfig.File.Deb[idx].FetchDebFile(packConfig.File.Deb[idx].Path)
-				log.Logger.Infof("fetch deb path:[%d] %s", idx, packConfig.File.Deb[idx].Path)
+	// 汇总各个架构中缺失的包和依赖
+	for _, item := range missing {
+		log.Logger.Warnf("missing %s", item)
+	}
+	if len(archs) > 1 && len(missing) == 0 && len(failures) == 0 {
+		log.Logger.Infof("all packages and dependencies found for %s", strings.Join(archs, ", "))
+	}
+	for _, err := range failures {
+		log.Logger.Errorf("failed %s", err)
+	}
+	if options.reportDir != "" {
+		if err := report.NewSummary(reports).Write(options.reportDir, options.markdown); err != nil {
+			log.Logger.Errorf("write report to %s error: %s", options.reportDir, err)
+		} else {
+			log.Logger.Infof("write report to %s", filepath.Join(options.reportDir, report.ReportJson))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d conversions failed: %w", len(failures), errors.Join(failures...))
+	}
+	return nil
+}
+
+// 命令行指定的架构优先，否则使用 package.yaml 中的架构，转换为 deb 的架构名并去重
+func TargetArchs(archs []string, defaultArch string) []string {
+	if len(archs) == 0 {
+		archs = []string{defaultArch}
+	}
+	var result []string
+	seen := make(map[string]bool)
+	for _, arch := range archs {
+		arch = comm.DebArch(strings.TrimSpace(arch))
+		if arch == "" {
+			arch = runtime.GOARCH
+		}
+		if !seen[arch] {
+			seen[arch] = true
+			result = append(result, arch)
+		}
+	}
+	return result
+}
+
+// 命令行指定的需要更新的包
+func (options *convertOptions) lockUpdate() deb.LockUpdate {
+	var update deb.LockUpdate
+	for _, name := range options.update {
+		if name = strings.TrimSpace(name); name == "*" {
+			update.All = true
+		} else if name != "" {
+			update.Names = append(update.Names, name)
+		}
+	}
+	return update
+}
+
+// 应用的工程目录，多个架构时每个架构一个工程目录，分别生成 linglong.yaml
+func AppPath(workdir, id, arch string, multiArch bool) string {
+	appPath := filepath.Join(comm.BuildPackPath(workdir), id)
+	if multiArch {
+		appPath = filepath.Join(appPath, arch)
+	}
+	return appPath
+}
+
+// 转换一个架构的一组 deb 包，返回报告和无法满足的依赖，报告无论成功与否都写入工程目录
+func ConvertApp(options GroupOptions, packConfig *config.PackConfig, group *deb.DebGroup, archive deb.Archive, appPath, arch string) (*report.Report, []string, error) {
+	rep := report.New(group.Id, arch, appPath)
+	problems, err := convertGroup(options, packConfig, group, archive, appPath, arch, rep)
+	rep.Collect(group)
+	rep.Finish(err)
+	if werr := rep.Write(appPath, options.Markdown); werr != nil {
+		log.Logger.Errorf("write report of %s error: %s", group.Id, werr)
+	}
+	return rep, problems, err
+}
+
+// 转换一个架构的一组 deb 包，生成 linglong.yaml，返回无法满足的依赖，失败时返回对应阶段的 StageError。
+// 各阶段的耗时、警告和生成的文件记录在 rep 中
+func convertGroup(options GroupOptions, packConfig *config.PackConfig, group *deb.DebGroup, archive deb.Archive, appPath, arch string, rep *report.Report) ([]string, error) {
+	linglongYamlPath := filepath.Join(appPath, comm.LinglongYaml)
+	lockPath := filepath.Join(appPath, deb.LockFile)
+	update := options.Update
+
+	// 如果已经存在 linglong.yaml 文件并且不需要更新直接跳过。
+	if ret, err := fs.CheckFileExits(linglongYamlPath); ret && err == nil && !update.All && len(update.Names) == 0 {
+		log.Logger.Infof("%s file already exists", linglongYamlPath)
+		rep.Status = report.StatusSkipped
+		rep.AddArtifact(linglongYamlPath)
+		return nil, nil
+	}
+
+	// 存在 pica.lock 时使用其中锁定的包
+	lock, err := deb.ReadLock(lockPath)
+	if err != nil {
+		rep.Warnf("read lock error: %s, resolve again", err)
+	} else if lock != nil && !update.All {
+		log.Logger.Infof("load %s", lockPath)
+		group.Lock = lock
+	}
+	group.Update = update
+
+	fs.CreateDir(appPath)
+	for _, d := range group.Debs {
+		var locked *deb.LockedPackage
+		if !update.Has(d.Name) {
+			locked = group.Lock.Package(d.Name)
+		}
+		done := rep.Start(comm.StageFetch)
+		err := fetchDeb(d, appPath, archive, arch, locked)
+		done()
+		if err != nil {
+			return nil, err
+		}
+		// 提取 deb 包的相关数据
+		done = rep.Start(comm.StageExtract)
+		err = d.ExtractDeb(packConfig.VersionPolicy, arch)
+		done()
+		if err != nil {
+			return nil, comm.NewStageError(comm.StageExtract, d.Name, err)
+		}
+		if d.Architecture != arch {
+			return nil, comm.NewStageError(comm.StageResolve, d.Name, fmt.Errorf("built for %s, not %s", d.Architecture, arch))
+		}
+	}
+	if len(group.Debs) > 1 {
+		log.Logger.Infof("merge %s into %s", strings.Join(group.Names(), ", "), group.Id)
+		group.CheckConflicts()
+	}
+
+	// 依赖处理
+	installed := options.Installed[arch]
+	if installed == nil {
+		installed = deb.LoadInstalled([]string{arch})[arch]
+	}
+	resolveOptions := deb.ResolveOptions{
+		WithDeps:  options.WithDep,
+		Options:   deb.DependencyOptions(packConfig.Runtime.DepFollow),
+		Providers: packConfig.Providers,
+		Installed: installed,
+	}
+	done := rep.Start(comm.StageResolve)
+	err = resolveDepends(group, archive, resolveOptions)
+	// 检查 ELF 文件需要的库，补充了依赖包时重新解析
+	if err == nil {
+		if err = group.ScanLibraries(archive, installed, options.ElfDeps); err != nil {
+			err = comm.NewStageError(lookupStage(err), group.Id, signatureHint(err))
+		}
+	}
+	if err == nil && len(group.Extra) > 0 {
+		err = resolveDepends(group, archive, resolveOptions)
+	}
+	done()
+	if err != nil {
+		return nil, err
+	}
+	// 预先下载依赖包，下载或者校验失败时不生成 linglong.yaml
+	if options.Prefetch {
+		done := rep.Start(comm.StageFetch)
+		err := group.Prefetch(comm.LLSourcePath(appPath))
+		done()
+		if err != nil {
+			return nil, comm.NewStageError(comm.StageFetch, group.Id, err)
+		}
+	}
+	done = rep.Start(comm.StageGenerate)
+	// 对 linglong.yaml 依赖去重
+	group.Sources = comm.RemoveExcessDeps(group.Sources)
+	// 构建脚本使用复制到 sources 目录的 ll-pica 重定位依赖包
+	if err := deb.StagePica(comm.LocalPackageSourceDir(appPath), arch); err != nil {
+		rep.Warnf("stage ll-pica error: %s", err)
+	}
+	// 生成构建脚本
+	group.GenerateBuildScript()
 
-				if ret := packConfig.File.Deb[idx].CheckDebHash(); !ret {
-					log.Logger.Warnf("check deb hash failed! : ", packConfig.File.Deb[idx].Name)
-					continue
+	main := group.Main()
+	builder := linglong.LinglongBuilder{
+		Package: linglong.Package{
+			Appid:       group.Id,
+			Name:        main.Name,
+			Version:     main.Version,
+			Kind:        group.PackageKind,
+			Description: main.Desc,
+		},
+		Runtime: fmt.Sprintf("%s/%s", packConfig.Runtime.Id, packConfig.Runtime.Version),
+		Base:    fmt.Sprintf("%s/%s", packConfig.Runtime.BaseId, packConfig.Runtime.BaseVersion),
+		Command: group.Command,
+		Sources: group.Sources,
+		Build:   group.Build,
+	}
+
+	// 生成 linglong.yaml 文件
+	if err := builder.CreateLinglongYaml(linglongYamlPath); err != nil {
+		done()
+		return nil, err
+	}
+	log.Logger.Infof("generate %s success.", linglongYamlPath)
+	rep.AddArtifact(linglongYamlPath)
+
+	// 记录本次使用的包，依赖取自锁定文件时保留锁定的 base 和 runtime
+	newLock := deb.NewLock(&packConfig.Runtime.Config)
+	if group.Replayed {
+		for _, item := range group.Lock.CheckLayers(newLock) {
+			rep.Warnf("%s, depends may differ, use --update to resolve again", item)
+		}
+		newLock.Base, newLock.Runtime = group.Lock.Base, group.Lock.Runtime
+	}
+	for _, d := range group.Debs {
+		newLock.Packages = append(newLock.Packages, deb.LockedPackage{
+			Name:         d.Name,
+			Version:      d.DebVersion,
+			Architecture: d.Architecture,
+			Url:          d.Ref,
+			SHA256:       d.Hash,
+		})
+	}
+	newLock.Depends = group.Depends
+	if err := newLock.Write(lockPath); err != nil {
+		log.Logger.Errorf("write %s error: %s", lockPath, err)
+	} else {
+		rep.AddArtifact(lockPath)
+	}
+	done()
+
+	// 构建玲珑包，只能构建本机架构
+	if options.Build {
+		if arch != runtime.GOARCH {
+			rep.Warnf("skip building %s for %s on %s", group.Id, arch, runtime.GOARCH)
+		} else {
+			buildLinglongPath := filepath.Dir(linglongYamlPath)
+			done := rep.Start(comm.StageBuild)
+			err := builder.LinglongBuild(buildLinglongPath, "ll-builder build")
+			done()
+			if err != nil {
+				return nil, err
+			}
+			done = rep.Start(comm.StageExport)
+			err = builder.LinglongExport(buildLinglongPath, options.ExportFile)
+			done()
+			if err != nil {
+				return nil, err
+			}
+			// 导出的 uab 或者 layer 文件
+			for _, pattern := range []string{"*.uab", "*.layer"} {
+				files, _ := filepath.Glob(filepath.Join(buildLinglongPath, pattern))
+				for _, file := range files {
+					rep.AddArtifact(file)
 				}
-				log.Logger.Infof("download %s success.", packConfig.File.Deb[idx].Name)
 			}
+		}
+	}
 
-			// 提取 deb 包的相关数据
-			if err := packConfig.File.Deb[idx].ExtractDeb(); err != nil {
-				return err
-			}
+	var problems []string
+	for _, item := range group.Unsatisfied {
+		problems = append(problems, fmt.Sprintf("unsatisfiable depend %s", item))
+	}
+	return problems, nil
+}
 
-			// 依赖处理
-			packConfig.File.Deb[idx].ResolveDepends(packConfig.Runtime.Source, packConfig.Runtime.DistroVersion, options.withDep)
-			// 生成构建脚本
-			packConfig.File.Deb[idx].GenerateBuildScript()
-			// 对 linglong.yaml 依赖去重
-			packConfig.File.Deb[idx].Sources = comm.RemoveExcessDeps(packConfig.File.Deb[idx].Sources)
-
-			builder := linglong.LinglongBuilder{
-				Package: linglong.Package{
-					Appid:       packConfig.File.Deb[idx].Id,
-					Name:        packConfig.File.Deb[idx].Name,
-					Version:     packConfig.File.Deb[idx].Version,
-					Kind:        packConfig.File.Deb[idx].PackageKind,
-					Description: packConfig.File.Deb[idx].Desc,
-				},
-				Runtime: fmt.Sprintf("%s/%s", packConfig.Runtime.Id, packConfig.Runtime.Version),
-				Base:    fmt.Sprintf("%s/%s", packConfig.Runtime.BaseId, packConfig.Runtime.BaseVersion),
-				Command: packConfig.File.Deb[idx].Command,
-				Sources: packConfig.File.Deb[idx].Sources,
-				Build:   packConfig.File.Deb[idx].Build,
-			}
+// 解析依赖，失败时停止转换，不生成缺少依赖的 linglong.yaml 和 pica.lock
+func resolveDepends(group *deb.DebGroup, archive deb.Archive, options deb.ResolveOptions) error {
+	if err := group.ResolveDepends(archive, options); err != nil {
+		return comm.NewStageError(lookupStage(err), group.Id, signatureHint(err))
+	}
+	return nil
+}
 
-			// 生成 linglong.yaml 文件
-			if builder.CreateLinglongYaml(linglongYamlPath) {
-				log.Logger.Infof("generate %s success.", comm.LinglongYaml)
-			} else {
-				log.Logger.Errorf("generate %s failed", comm.LinglongYaml)
-			}
+// 在仓库中查找包失败时的阶段，仓库加载失败和网络错误属于 fetch，找不到包和签名错误属于 resolve
+func lookupStage(err error) comm.Stage {
+	if isSignatureError(err) {
+		return comm.StageResolve
+	}
+	var repoErr *deb.RepositoryError
+	var httpErr *download.HTTPError
+	var netErr net.Error
+	if errors.As(err, &repoErr) || errors.As(err, &httpErr) || errors.As(err, &netErr) {
+		return comm.StageFetch
+	}
+	return comm.StageResolve
+}
 
-			// 构建玲珑包
-			if options.buildFlag {
-				buildLinglongPath := filepath.Dir(linglongYamlPath)
-				builder.LinglongBuild(buildLinglongPath, "ll-builder build")
-				builder.LinglongExport(buildLinglongPath, options.exportFile)
-			}
+func isSignatureError(err error) bool {
+	var sigErr *deb.SignatureError
+	return errors.As(err, &sigErr)
+}
+
+// 签名错误时提示如何处理
+func signatureHint(err error) error {
+	if isSignatureError(err) {
+		return fmt.Errorf("%w, add the key to keyrings or set ignore_signatures to skip verification", err)
+	}
+	return err
+}
+
+// 获取 deb 包到应用的源码目录，locked 为 pica.lock 中锁定的包
+func fetchDeb(d *deb.Deb, appPath string, archive deb.Archive, arch string, locked *deb.LockedPackage) error {
+	// 如果 Ref 为空，type 为 repo, 优先使用锁定的 url 链接，然后从仓库获取 url 链接， 如果没有就使用 apt download 获取 url 链接，
+	// 另外的如果 type 为 local 直接将 deb 包下载到工作目录
+	if d.Ref == "" && locked != nil {
+		log.Logger.Infof("use %s %s locked in %s", d.Name, locked.Version, deb.LockFile)
+		d.Ref = locked.Url
+		d.Hash = locked.SHA256
+	}
+	if d.Ref == "" {
+		url, err := d.GetPackageUrl(archive, arch)
+		if err != nil {
+			return comm.NewStageError(lookupStage(err), d.Name, signatureHint(err))
+		}
+		d.Ref = url
+	}
+	if len(d.Ref) == 0 {
+		return comm.NewStageError(comm.StageResolve, d.Name, &deb.NotFoundError{Name: d.Name, Arch: arch})
+	}
+
+	// fetch deb file
+	d.Path = filepath.Join(comm.LocalPackageSourceDir(appPath), filepath.Base(d.Ref))
+	if ret, _ := fs.CheckFileExits(d.Path); ret {
+		if hash := d.CheckDebHash(); hash {
+			log.Logger.Infof("download skipped because of %s cached", d.Name)
+			return nil
 		}
+		log.Logger.Warnf("check deb hash failed! : ", d.Name)
+		fs.RemovePath(d.Path)
+	}
+
+	if err := d.FetchDebFile(d.Path); err != nil {
+		return err
+	}
+	log.Logger.Debugf("fetch deb path: %s", d.Path)
+
+	if ret := d.CheckDebHash(); !ret {
+		return comm.NewStageError(comm.StageFetch, d.Name, fmt.Errorf("check hash of %s failed", d.Path))
 	}
+	log.Logger.Infof("download %s success.", d.Name)
 	return nil
 }
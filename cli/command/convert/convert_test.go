@@ -0,0 +1,114 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package convert
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/cli/config"
+	"pkg.deepin.com/linglong/pica/cli/deb"
+	"pkg.deepin.com/linglong/pica/cli/report"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+func init() {
+	log.Logger = log.InitLog()
+}
+
+// 加载包索引总是失败的仓库
+type failingArchive struct {
+	err error
+}
+
+func (a *failingArchive) PackageIndex(arch string) (*deb.PackageIndex, error) {
+	return nil, a.err
+}
+
+func (a *failingArchive) LookupLibraries(arch string, sonames map[string]bool) (map[string][]string, error) {
+	return nil, a.err
+}
+
+func (a *failingArchive) Offline() bool {
+	return true
+}
+
+// 生成只有 control 和一个文件的 deb 包
+func writeTestDeb(t *testing.T, path, control string) {
+	tarball := func(name, data string) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))})
+		tw.Write([]byte(data))
+		tw.Close()
+		return buf.Bytes()
+	}
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar", tarball("./control", control)},
+		{"data.tar", tarball("./usr/share/doc/demo/README", "demo")},
+	} {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		buf.Write(member.data)
+		if len(member.data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConvertAppStage(t *testing.T) {
+	networkErr := &deb.RepositoryError{Repo: "main", Err: errors.New("dial tcp: connection refused")}
+	local := filepath.Join(t.TempDir(), "demo_1.0_amd64.deb")
+	writeTestDeb(t, local, "Package: demo\nVersion: 1.0\nArchitecture: amd64\nDepends: libfoo1\nDescription: demo\n")
+
+	for _, tds := range []struct {
+		name    string
+		debInfo deb.Deb
+		archive deb.Archive
+		stage   comm.Stage
+		code    int
+	}{
+		// 仓库索引加载失败属于 fetch，和找不到包区分开
+		{"index", deb.Deb{Id: "org.demo.app", Name: "demo", Type: "repo"}, &failingArchive{err: networkErr}, comm.StageFetch, comm.ExitFetch},
+		{"missing", deb.Deb{Id: "org.demo.app", Name: "demo", Type: "repo"}, deb.NewFakeArchive(t.TempDir()), comm.StageResolve, comm.ExitResolve},
+		// 解析依赖失败时停止转换
+		{"depends", deb.Deb{Id: "org.demo.app", Name: "demo", Type: "local", Ref: local}, &failingArchive{err: networkErr}, comm.StageFetch, comm.ExitFetch},
+		{"resolve", deb.Deb{Id: "org.demo.app", Name: "demo", Type: "local", Ref: local}, &failingArchive{err: errors.New("arch or package name is empty")}, comm.StageResolve, comm.ExitResolve},
+	} {
+		appPath := t.TempDir()
+		group := deb.GroupDebs([]deb.Deb{tds.debInfo})[0]
+		rep, _, err := ConvertApp(GroupOptions{WithDep: true}, config.NewPackConfig(), group, tds.archive, appPath, "amd64")
+
+		var stageErr *comm.StageError
+		if !errors.As(err, &stageErr) || stageErr.Stage != tds.stage || comm.ExitCode(err) != tds.code {
+			t.Errorf("Failed test for ConvertApp %s! Error: %v, want stage %s", tds.name, err, tds.stage)
+		}
+		if rep.Status != report.StatusFailed || rep.ExitCode != tds.code {
+			t.Errorf("Failed test for ConvertApp %s! Error: report status %s exit code %d", tds.name, rep.Status, rep.ExitCode)
+		}
+		// 失败时不生成 linglong.yaml 和 pica.lock
+		for _, file := range []string{comm.LinglongYaml, deb.LockFile} {
+			if _, err := os.Stat(filepath.Join(appPath, file)); err == nil {
+				t.Errorf("Failed test for ConvertApp %s! Error: %s written on failure", tds.name, file)
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package desktop
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"pkg.deepin.com/linglong/pica/tools/fs/desktop"
+	"pkg.deepin.com/linglong/pica/tools/fs/icon"
+	"pkg.deepin.com/linglong/pica/tools/fs/relocate"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+type desktopOptions struct {
+	exec   string
+	maps   []string
+	output string
+	dryRun bool
+}
+
+// 一个 desktop 文件的改写结果
+type fileReport struct {
+	File     string           `json:"file"`
+	Changes  []desktop.Change `json:"changes,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+func NewDesktopCommand() *cobra.Command {
+	var options desktopOptions
+	cmd := &cobra.Command{
+		Use:          "desktop [OPTIONS] <file>...",
+		Short:        "Rewrite Exec, TryExec and Icon of desktop files",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDesktop(&options, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&options.exec, "exec", "", "replace the program in Exec, keeping the arguments and field codes, TryExec is removed")
+	flags.StringArrayVarP(&options.maps, "map", "m", nil, "prefix map from=to for paths in Exec and TryExec, can be repeated, e.g. /app=/opt/apps/$APPID/files")
+	flags.StringVarP(&options.output, "output", "o", "", "write the json report to file instead of stdout")
+	flags.BoolVar(&options.dryRun, "dry-run", false, "only print the report without changing files")
+	return cmd
+}
+
+func runDesktop(options *desktopOptions, files []string) error {
+	prefixMap, err := relocate.ParsePrefixMap(options.maps)
+	if err != nil {
+		return err
+	}
+	rewrite := desktop.RewriteOptions{Exec: options.exec, MapIcon: icon.Name}
+	if len(prefixMap) > 0 {
+		rewrite.MapPath = func(arg string) string {
+			// VAR=path 形式的参数只改写值
+			name, value, _ := desktop.CutEnv(arg)
+			if newValue, ok := prefixMap.Map(value); ok {
+				return name + newValue
+			}
+			return arg
+		}
+	}
+
+	var reports []fileReport
+	var failed int
+	for _, file := range files {
+		entry, err := desktop.ParseFile(file)
+		if err != nil {
+			log.Logger.Errorf("read %s error: %s", file, err)
+			failed++
+			continue
+		}
+		changes, warnings := entry.Rewrite(rewrite)
+		reports = append(reports, fileReport{File: file, Changes: changes, Warnings: warnings})
+		if len(changes) == 0 || options.dryRun {
+			continue
+		}
+		if err := entry.Save(file); err != nil {
+			log.Logger.Errorf("save %s error: %s", file, err)
+			failed++
+		}
+	}
+
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 没有指定输出文件时只输出报告，便于其他工具解析
+	if options.output == "" {
+		fmt.Println(string(data))
+	} else {
+		if err := os.WriteFile(options.output, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		log.Logger.Infof("rewrite %d desktop files, report saved to %s", len(reports), options.output)
+	}
+	if failed > 0 {
+		return fmt.Errorf("rewrite desktop: %d files failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package relocate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"pkg.deepin.com/linglong/pica/tools/fs/relocate"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+type relocateOptions struct {
+	maps   []string
+	output string
+	system string
+	dryRun bool
+}
+
+func NewRelocateCommand() *cobra.Command {
+	var options relocateOptions
+	cmd := &cobra.Command{
+		Use:          "relocate [OPTIONS] <dir>",
+		Short:        "Relocate RUNPATH, pkg-config files and absolute symlinks of extracted files",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRelocate(&options, args[0])
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringArrayVarP(&options.maps, "map", "m", nil, "prefix map from=to, can be repeated, e.g. /usr=$PREFIX")
+	flags.StringVarP(&options.output, "output", "o", "", "write the json report to file instead of stdout")
+	flags.StringVar(&options.system, "system", "/", "root used to check whether symlink targets already exist")
+	flags.BoolVar(&options.dryRun, "dry-run", false, "only print the report without changing files")
+	return cmd
+}
+
+func runRelocate(options *relocateOptions, dir string) error {
+	if len(options.maps) == 0 {
+		return fmt.Errorf("at least one --map is required")
+	}
+	prefixMap, err := relocate.ParsePrefixMap(options.maps)
+	if err != nil {
+		return err
+	}
+	report, err := relocate.Relocate(relocate.Options{
+		Root:   dir,
+		Map:    prefixMap,
+		System: options.system,
+		DryRun: options.dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 没有指定输出文件时只输出报告，便于其他工具解析
+	if options.output == "" {
+		fmt.Println(string(data))
+	} else {
+		if err := os.WriteFile(options.output, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		log.Logger.Infof("relocate %s: %d changes, report saved to %s", dir, len(report.Changes), options.output)
+	}
+	if len(report.Failures) > 0 {
+		return fmt.Errorf("relocate %s: %d files failed", dir, len(report.Failures))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package repo
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/cli/config"
+	"pkg.deepin.com/linglong/pica/cli/deb"
+	"pkg.deepin.com/linglong/pica/tools/fs"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+type refreshOptions struct {
+	config string
+	archs  []string
+}
+
+func NewRepoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repo",
+		Short: "Manage apt repository indexes",
+	}
+	cmd.AddCommand(newRefreshCommand())
+	return cmd
+}
+
+func newRefreshCommand() *cobra.Command {
+	var options refreshOptions
+	cmd := &cobra.Command{
+		Use:          "refresh",
+		Short:        "Refresh package indexes of configured repositories regardless of index_ttl",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRefresh(&options)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&options.config, "config", "c", "", "package.yaml whose runtime repositories are refreshed, default to ~/.pica/config.json")
+	flags.StringSliceVar(&options.archs, "arch", nil, "architectures to refresh, default to the arch in config")
+	return cmd
+}
+
+func runRefresh(options *refreshOptions) error {
+	comm.InitPicaConfigDir()
+	packConfig := config.NewPackConfig()
+	if ret, _ := fs.CheckFileExits(comm.PicaConfigJsonPath()); ret {
+		packConfig.Runtime.ReadConfigJson()
+	}
+	if options.config != "" {
+		if ret := packConfig.ReadPackConfigYaml(options.config); !ret {
+			return comm.NewStageError(comm.StageConfig, options.config, errors.New("read pack config yaml error"))
+		}
+	}
+
+	archs := options.archs
+	if len(archs) == 0 {
+		archs = []string{packConfig.Runtime.Arch}
+	}
+	if err := deb.ConfigureDownload(&packConfig.Runtime.Config); err != nil {
+		return comm.NewStageError(comm.StageConfig, comm.PicaConfigJsonPath(), err)
+	}
+	repos := deb.NewRepositories(&packConfig.Runtime.Config)
+	for _, arch := range archs {
+		arch = comm.DebArch(strings.TrimSpace(arch))
+		index, err := deb.RefreshIndex(repos, arch)
+		if err != nil {
+			// 签名校验失败属于 resolve，其他为下载索引失败
+			var sigErr *deb.SignatureError
+			if errors.As(err, &sigErr) {
+				return comm.NewStageError(comm.StageResolve, arch, err)
+			}
+			return comm.NewStageError(comm.StageFetch, arch, err)
+		}
+		log.Logger.Infof("%s: %d packages from %d repositories", arch, index.Len(), len(repos))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package version
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"pkg.deepin.com/linglong/pica/cli/config"
+	"pkg.deepin.com/linglong/pica/cli/deb"
+	"pkg.deepin.com/linglong/pica/tools/fs"
+)
+
+type mapOptions struct {
+	config string
+	policy deb.VersionPolicy
+}
+
+func NewVersionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Debian version tools",
+	}
+	cmd.AddCommand(newMapCommand())
+	return cmd
+}
+
+func newMapCommand() *cobra.Command {
+	var options mapOptions
+	cmd := &cobra.Command{
+		Use:          "map <debversion>...",
+		Short:        "Preview the linglong version mapped from deb versions",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMap(cmd, &options, args)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&options.config, "config", "c", "", "read version_policy from package.yaml")
+	flags.StringVar(&options.policy.Epoch, "epoch", deb.EpochMajor, "epoch policy: major or reject")
+	flags.StringVar(&options.policy.Tilde, "tilde", deb.TildeOrder, "tilde policy: order or reject")
+	flags.StringVar(&options.policy.Revision, "revision", deb.RevisionBuild, "revision policy: build or drop")
+	flags.IntVar(&options.policy.Rebuild, "rebuild", 0, "pica rebuild counter")
+	return cmd
+}
+
+func runMap(cmd *cobra.Command, options *mapOptions, args []string) error {
+	policy := options.policy
+	// 命令行中指定的策略优先于 package.yaml 中的配置
+	if options.config != "" {
+		if ret, _ := fs.CheckFileExits(options.config); !ret {
+			return fmt.Errorf("%s not found", options.config)
+		}
+		packConfig := config.NewPackConfig()
+		if ret := packConfig.ReadPackConfigYaml(options.config); !ret {
+			return fmt.Errorf("read %s failed", options.config)
+		}
+		policy = packConfig.VersionPolicy
+		flags := cmd.Flags()
+		if flags.Changed("epoch") {
+			policy.Epoch = options.policy.Epoch
+		}
+		if flags.Changed("tilde") {
+			policy.Tilde = options.policy.Tilde
+		}
+		if flags.Changed("revision") {
+			policy.Revision = options.policy.Revision
+		}
+		if flags.Changed("rebuild") {
+			policy.Rebuild = options.policy.Rebuild
+		}
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	for _, ver := range args {
+		mapped, err := policy.Map(ver)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s => %s\n", mapped.Deb, mapped.Linglong)
+		for _, lossy := range mapped.Lossy {
+			fmt.Printf("  lossy: %s\n", lossy)
+		}
+	}
+
+	// 传入多个版本时检查映射后的顺序
+	if len(args) > 1 {
+		inversions, collisions, err := policy.CheckOrder(args)
+		if err != nil {
+			return err
+		}
+		for _, item := range collisions {
+			fmt.Printf("collision: %s\n", item)
+		}
+		for _, item := range inversions {
+			fmt.Printf("inversion: %s\n", item)
+		}
+		if len(inversions) > 0 {
+			return fmt.Errorf("%d version pairs are out of order after mapping", len(inversions))
+		}
+	}
+	return nil
+}
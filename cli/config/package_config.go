@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"text/template"
 
 	"gopkg.in/yaml.v3"
@@ -17,6 +18,58 @@ const PackageConfigTMPL = `runtime:
   source: {{.Runtime.Source}}
   distro_version: {{.Runtime.DistroVersion}}
   arch: {{.Runtime.Arch}}
+{{- if .Runtime.Keyrings}}
+  keyrings:
+{{- range .Runtime.Keyrings}}
+    - {{.}}
+{{- end}}
+{{- end}}
+{{- if .Runtime.IgnoreSignatures}}
+  ignore_signatures: true
+{{- end}}
+{{- if .Runtime.Profile}}
+  profile: {{.Runtime.Profile}}
+{{- end}}
+{{- if .Runtime.IndexTTL}}
+  index_ttl: {{.Runtime.IndexTTL}}
+{{- end}}
+{{- if .Runtime.DepFollow}}
+  dep_follow: [{{join .Runtime.DepFollow ", "}}]
+{{- end}}
+{{- if .Runtime.Proxy}}
+  proxy: {{.Runtime.Proxy}}
+{{- end}}
+{{- if .Runtime.Sources}}
+  sources:
+{{- range .Runtime.Sources}}
+    - url: {{.Url}}
+      suite: {{.Suite}}
+{{- if .Name}}
+      name: {{.Name}}
+{{- end}}
+{{- if .Components}}
+      components: [{{join .Components ", "}}]
+{{- end}}
+{{- if .Architectures}}
+      architectures: [{{join .Architectures ", "}}]
+{{- end}}
+{{- if .Priority}}
+      priority: {{.Priority}}
+{{- end}}
+{{- if .Keyrings}}
+      keyrings: [{{join .Keyrings ", "}}]
+{{- end}}
+{{- if .IgnoreSignatures}}
+      ignore_signatures: true
+{{- end}}
+{{- if .Copy}}
+      copy: true
+{{- end}}
+{{- if .Mirrors}}
+      mirrors: [{{join .Mirrors ", "}}]
+{{- end}}
+{{- end}}
+{{- end}}
 file:
   deb:
   {{- range $deb := .File.Deb }}
@@ -30,6 +83,12 @@ file:
   {{  printf "    hash: %s" $deb.Hash}}
 {{- end}}
 {{end}}
+{{- if .Providers}}
+providers:
+{{- range $virtual, $name := .Providers}}
+  {{ printf "%s: %s" $virtual $name}}
+{{- end}}
+{{end}}
 `
 
 type PackConfig struct {
@@ -39,6 +98,10 @@ type PackConfig struct {
 	File struct {
 		Deb []deb.Deb `yaml:"deb"`
 	} `yaml:"file"`
+	// 虚包的首选提供者，例如 x-terminal-emulator: deepin-terminal
+	Providers map[string]string `yaml:"providers"`
+	// deb 版本号映射为玲珑版本号的策略
+	VersionPolicy deb.VersionPolicy `yaml:"version_policy"`
 }
 
 func NewPackConfig() *PackConfig {
@@ -77,6 +140,7 @@ func NewPackConfig() *PackConfig {
 				},
 			},
 		},
+		VersionPolicy: deb.NewVersionPolicy(),
 	}
 }
 
@@ -96,7 +160,7 @@ func (p *PackConfig) ReadPackConfigYaml(path string) bool {
 }
 
 func (p *PackConfig) CreatePackConfigYaml(path string) bool {
-	tpl, err := template.New("package").Parse(PackageConfigTMPL)
+	tpl, err := template.New("package").Funcs(template.FuncMap{"join": strings.Join}).Parse(PackageConfigTMPL)
 
 	if err != nil {
 		log.Logger.Warnf("parse template failed: %v", err)
@@ -109,7 +173,7 @@ func (p *PackConfig) CreatePackConfigYaml(path string) bool {
 		log.Logger.Infof("create save file: %s", path)
 		saveFd, ret := os.Create(path)
 		if ret != nil {
-			log.Logger.Fatalf("save to %s failed!", path)
+			log.Logger.Errorf("save to %s failed: %s", path, ret)
 			return false
 		}
 		defer saveFd.Close()
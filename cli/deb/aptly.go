@@ -0,0 +1,230 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/aptly-dev/aptly/cmd"
+	ctx "github.com/aptly-dev/aptly/context"
+	"github.com/aptly-dev/aptly/deb"
+	"github.com/aptly-dev/aptly/utils"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 加锁的 aptly 状态目录，同一个 profile 同时只有一个 ll-pica 进程使用
+type aptlyState struct {
+	root              string
+	unlock            func()
+	context           *ctx.AptlyContext
+	collectionFactory *deb.CollectionFactory
+}
+
+// 对文件加排他锁，已经被其他进程锁定时等待，返回解锁函数
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(fd.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		log.Logger.Infof("waiting for %s locked by another ll-pica", path)
+		if err := syscall.Flock(int(fd.Fd()), syscall.LOCK_EX); err != nil {
+			fd.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+	}
+	return func() {
+		syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+		fd.Close()
+	}, nil
+}
+
+// 打开 profile 的 aptly 状态目录，使用完需要 Close
+func openAptly(profile string) (*aptlyState, error) {
+	root := comm.AptlyProfilePath(profile)
+	unlock, err := lockFile(filepath.Join(root, "lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个 profile 独立的 aptly 配置，使用内置的 openpgp 实现，与 FetchRelease 使用同样的 keyring
+	config := utils.Config
+	config.RootDir = root
+	config.GpgProvider = "internal"
+	configPath := filepath.Join(root, "aptly.conf")
+	if err := utils.SaveConfig(configPath, &config); err != nil {
+		unlock()
+		return nil, err
+	}
+	flags, _, err := cmd.RootCommand().ParseFlags([]string{"-config=" + configPath})
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	context, err := ctx.NewContext(flags)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return &aptlyState{
+		root:              root,
+		unlock:            unlock,
+		context:           context,
+		collectionFactory: context.NewCollectionFactory(),
+	}, nil
+}
+
+func (s *aptlyState) Close() {
+	s.context.Shutdown()
+	s.unlock()
+}
+
+// aptly 镜像的名称，每个架构一个镜像
+func (r *Repository) mirrorName(arch string) string {
+	return r.Name + "_" + arch
+}
+
+// 镜像的地址、发行版和组件与配置一致时可以复用
+func (r *Repository) sameMirror(remote *deb.RemoteRepo) bool {
+	if remote.ArchiveRoot != r.Source && remote.ArchiveRoot != r.Source+"/" {
+		return false
+	}
+	if remote.Distribution != r.Distro {
+		return false
+	}
+	return len(r.Components) == 0 || reflect.DeepEqual(remote.Components, r.Components)
+}
+
+// 保证仓库镜像的包索引在有效期内，过期后 Release 没有变化时不重新下载索引
+func (r *Repository) syncMirror(state *aptlyState, arch string) error {
+	collection := state.collectionFactory.RemoteRepoCollection()
+	name := r.mirrorName(arch)
+	remote, err := collection.ByName(name)
+	if err == nil {
+		if err := collection.LoadComplete(remote); err != nil {
+			return fmt.Errorf("unable to load mirror: %w", err)
+		}
+		if !r.sameMirror(remote) {
+			log.Logger.Infof("%s changed, create mirror again", r.Name)
+			if err := collection.Drop(remote); err != nil {
+				return fmt.Errorf("unable to drop mirror: %w", err)
+			}
+			remote = nil
+		}
+	} else {
+		remote = nil
+	}
+
+	fresh := remote != nil && remote.NumPackages() > 0 && time.Since(remote.LastDownloadDate) < r.TTL
+	// Release 的签名先用 keyring 校验，签名错误时不能回退到 apt download；有效期内使用缓存的 Release
+	unlock, err := lockFile(filepath.Join(r.cacheDir(), "lock"))
+	if err != nil {
+		return err
+	}
+	_, err = r.FetchRelease(r.cacheDir())
+	unlock()
+	if err != nil {
+		var sigErr *SignatureError
+		if errors.As(err, &sigErr) {
+			return err
+		}
+		if !fresh {
+			log.Logger.Warnf("fetch release error: %s", err)
+		}
+	} else if signedBy := r.signedBy(); signedBy != "" {
+		log.Logger.Infof("%s signed by %s", r.DistURL(), signedBy)
+	}
+	if fresh && !r.refresh {
+		log.Logger.Debugf("use index of %s updated at %s", name, remote.LastDownloadDate.Format(time.RFC3339))
+		r.setState(func() { r.remote = remote })
+		return nil
+	}
+
+	if remote == nil {
+		remote, err = deb.NewRemoteRepo(name, r.Source, r.Distro, r.Components, []string{arch}, false, false, false)
+		if err != nil {
+			return fmt.Errorf("unable to create mirror: %w", err)
+		}
+		if err := collection.Add(remote); err != nil {
+			return fmt.Errorf("unable to add mirror: %w", err)
+		}
+	}
+
+	verifier, err := r.Verifier()
+	if err != nil {
+		return &SignatureError{Source: r.DistURL(), Err: err}
+	}
+	date := remote.Meta["Date"]
+	if err := remote.Fetch(state.context.Downloader(), verifier); err != nil {
+		return fmt.Errorf("unable to fetch release: %w", err)
+	}
+
+	if remote.NumPackages() > 0 && date != "" && date == remote.Meta["Date"] {
+		log.Logger.Debugf("release of %s not changed", name)
+	} else {
+		state.context.Progress().Printf("Downloading & parsing package files of %s...\n", r.Name)
+		err = remote.DownloadPackageIndexes(state.context.Progress(), state.context.Downloader(), verifier, state.collectionFactory, false)
+		if err != nil {
+			return fmt.Errorf("unable to download package indexes: %w", err)
+		}
+		// aptly 不保存包在仓库中的目录，写入 Extra 中的 Filename，加载后用于拼接下载地址
+		remote.PackageList().ForEach(func(p *deb.Package) error {
+			if files := p.Files(); len(files) > 0 {
+				p.Extra()["Filename"] = files[0].DownloadURL()
+			}
+			return nil
+		})
+		if err := remote.FinalizeDownload(state.collectionFactory, state.context.Progress()); err != nil {
+			return fmt.Errorf("unable to save package indexes: %w", err)
+		}
+	}
+	remote.LastDownloadDate = time.Now()
+	if err := collection.Update(remote); err != nil {
+		return fmt.Errorf("unable to update mirror: %w", err)
+	}
+	r.setState(func() { r.remote = remote })
+	return nil
+}
+
+// 镜像中的包。aptly 按需从数据库读取依赖、文件和其他字段，关闭数据库前需要全部读出
+func (r *Repository) mirrorPackages(state *aptlyState) (*deb.PackageList, error) {
+	list, err := deb.NewPackageListFromRefList(r.remote.RefList(), state.collectionFactory.PackageCollection(), nil)
+	if err != nil {
+		return nil, err
+	}
+	list.ForEach(func(p *deb.Package) error {
+		p.Deps()
+		p.Files()
+		p.Extra()
+		return nil
+	})
+	return list, nil
+}
+
+// 忽略有效期重新检查所有仓库，返回合并后的包索引
+func RefreshIndex(repos []*Repository, arch string) (*PackageIndex, error) {
+	for _, repo := range repos {
+		repo.refresh = true
+	}
+	defer func() {
+		for _, repo := range repos {
+			repo.refresh = false
+		}
+	}()
+	return LoadPackageIndex(repos, arch)
+}
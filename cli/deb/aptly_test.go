@@ -0,0 +1,89 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPackages = `Package: libfoo1
+Version: 1.0
+Architecture: amd64
+Filename: pool/main/libfoo1_1.0_amd64.deb
+Size: 3
+SHA256: 0000000000000000000000000000000000000000000000000000000000000000
+
+`
+
+func newTestRepoServer(hits map[string]int, lock *sync.Mutex) *httptest.Server {
+	release := fmt.Sprintf("Origin: Test\nSuite: stable\nDate: Sat, 01 Jan 2022 00:00:00 UTC\nArchitectures: amd64\nComponents: main\n"+
+		"MD5Sum:\n %x %d main/binary-amd64/Packages\nSHA256:\n %x %d main/binary-amd64/Packages\n",
+		md5.Sum([]byte(testPackages)), len(testPackages), sha256.Sum256([]byte(testPackages)), len(testPackages))
+	files := map[string]string{
+		"/dists/stable/Release":                    release,
+		"/dists/stable/main/binary-amd64/Packages": testPackages,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hits[r.URL.Path]++
+		lock.Unlock()
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+}
+
+func TestSyncMirror(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	hits := make(map[string]int)
+	var lock sync.Mutex
+	server := newTestRepoServer(hits, &lock)
+	defer server.Close()
+
+	repo := &Repository{Name: "test", Source: server.URL, Distro: "stable", Priority: 500,
+		IgnoreSignatures: true, Profile: "test", TTL: time.Hour}
+	repos := []*Repository{repo}
+
+	for i := 0; i < 2; i++ {
+		index, err := LoadPackageIndex(repos, "amd64")
+		if err != nil {
+			t.Fatalf("Failed test for LoadPackageIndex! Error: %s", err)
+		}
+		if packages := index.Lookup("libfoo1", "amd64"); len(packages) != 1 || index.Origin(packages[0]) != repo {
+			t.Fatalf("Failed test for LoadPackageIndex! Error: libfoo1 not found")
+		}
+		// 关闭 aptly 数据库后仍然可以读取依赖和文件
+		if locked, err := LocatePackage(Repositories(repos), "libfoo1", "amd64"); err != nil || locked.Url != server.URL+"/pool/main/libfoo1_1.0_amd64.deb" {
+			t.Fatalf("Failed test for LocatePackage! Error: %v %+v", err, locked)
+		}
+		if packages := index.Lookup("libfoo1", "amd64"); packages[0].Deps() == nil {
+			t.Fatalf("Failed test for LoadPackageIndex! Error: depends not loaded")
+		}
+	}
+	// 有效期内只下载一次索引
+	if hits["/dists/stable/main/binary-amd64/Packages"] != 1 || hits["/dists/stable/Release"] != 2 {
+		t.Errorf("Failed test for LoadPackageIndex! Error: unexpected requests %v", hits)
+	}
+
+	// 强制刷新时 Release 没有变化不重新下载索引
+	if _, err := RefreshIndex(repos, "amd64"); err != nil {
+		t.Fatalf("Failed test for RefreshIndex! Error: %s", err)
+	}
+	if hits["/dists/stable/main/binary-amd64/Packages"] != 1 {
+		t.Errorf("Failed test for RefreshIndex! Error: unexpected requests %v", hits)
+	}
+}
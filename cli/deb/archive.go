@@ -0,0 +1,233 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 软件包仓库，转换时通过它查找包、解析依赖以及查找提供库的包，测试时可以使用 FakeArchive
+type Archive interface {
+	// 合并后的包索引，包来自的仓库通过 PackageIndex.Origin 获取
+	PackageIndex(arch string) (*PackageIndex, error)
+	// 在 Contents 索引中查找提供这些库的包，返回 soname -> 包名
+	LookupLibraries(arch string, sonames map[string]bool) (map[string][]string, error)
+	// 是否只包含本地仓库，离线时不回退到 apt download
+	Offline() bool
+}
+
+// 仓库中找不到包
+type NotFoundError struct {
+	Name string
+	Arch string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s not found for %s", e.Name, e.Arch)
+}
+
+// 单个仓库加载失败
+type RepositoryError struct {
+	Repo string
+	Err  error
+}
+
+func (e *RepositoryError) Error() string {
+	return fmt.Sprintf("load repository %s: %s", e.Repo, e.Err)
+}
+
+func (e *RepositoryError) Unwrap() error {
+	return e.Err
+}
+
+// 依赖解析时跟随的关系，对应 aptly 的 DependencyOptions
+var dependencyFollows = map[string]int{
+	"recommends":   deb.DepFollowRecommends,
+	"suggests":     deb.DepFollowSuggests,
+	"all-variants": deb.DepFollowAllVariants,
+}
+
+// 将配置中的 dep_follow 转换为 aptly 的 DependencyOptions，忽略不支持的值
+func DependencyOptions(follow []string) int {
+	options := 0
+	for _, item := range follow {
+		option, ok := dependencyFollows[strings.TrimSpace(item)]
+		if !ok {
+			log.Logger.Warnf("unsupported dep_follow %s", item)
+			continue
+		}
+		options |= option
+	}
+	return options
+}
+
+// 按优先级从高到低排列的 apt 仓库
+type Repositories []*Repository
+
+func (repos Repositories) PackageIndex(arch string) (*PackageIndex, error) {
+	return LoadPackageIndex(repos, arch)
+}
+
+// 按仓库优先级合并所有仓库的 Contents 索引后查找
+func (repos Repositories) LookupLibraries(arch string, sonames map[string]bool) (map[string][]string, error) {
+	var files []string
+	var lastErr error
+	for _, repo := range repos {
+		if !repo.HasArch(arch) {
+			continue
+		}
+		list, err := FetchContentsIndex(repo, arch)
+		if err != nil {
+			var sigErr *SignatureError
+			if errors.As(err, &sigErr) {
+				return nil, err
+			}
+			log.Logger.Warnf("load contents index of %s error: %s", repo.Name, err)
+			lastErr = &RepositoryError{Repo: repo.Name, Err: err}
+			continue
+		}
+		files = append(files, list...)
+	}
+	if len(files) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return LookupContents(files, sonames)
+}
+
+func (repos Repositories) Offline() bool {
+	return offline(repos)
+}
+
+// 缓存包索引和库查找结果的仓库，批量转换时多个应用共用同一份索引，可以在多个 goroutine 中同时使用。
+// 加载和查找依次进行，失败时不缓存，下次重新加载
+type CachedArchive struct {
+	Archive
+	lock      sync.Mutex
+	indexes   map[string]*PackageIndex
+	libraries map[string]map[string][]string // 架构 -> soname -> 提供它的包，找不到的 soname 对应 nil
+}
+
+func NewCachedArchive(archive Archive) *CachedArchive {
+	return &CachedArchive{
+		Archive:   archive,
+		indexes:   make(map[string]*PackageIndex),
+		libraries: make(map[string]map[string][]string),
+	}
+}
+
+func (c *CachedArchive) PackageIndex(arch string) (*PackageIndex, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if index, ok := c.indexes[arch]; ok {
+		return index, nil
+	}
+	index, err := c.Archive.PackageIndex(arch)
+	if err != nil {
+		return nil, err
+	}
+	c.indexes[arch] = index
+	return index, nil
+}
+
+// 只查找没有查找过的 soname
+func (c *CachedArchive) LookupLibraries(arch string, sonames map[string]bool) (map[string][]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok := c.libraries[arch]
+	if !ok {
+		cached = make(map[string][]string)
+		c.libraries[arch] = cached
+	}
+	missing := make(map[string]bool)
+	for soname := range sonames {
+		if _, ok := cached[soname]; !ok {
+			missing[soname] = true
+		}
+	}
+	if len(missing) > 0 {
+		found, err := c.Archive.LookupLibraries(arch, missing)
+		if err != nil {
+			return nil, err
+		}
+		for soname := range missing {
+			cached[soname] = found[soname]
+		}
+	}
+	result := make(map[string][]string)
+	for soname := range sonames {
+		if packages := cached[soname]; len(packages) > 0 {
+			result[soname] = append([]string(nil), packages...)
+		}
+	}
+	return result, nil
+}
+
+// 在仓库中查找包，同名包按仓库优先级和版本从高到低排序，返回第一个的锁定信息
+func LocatePackage(archive Archive, name, arch string) (*LockedPackage, error) {
+	index, err := archive.PackageIndex(arch)
+	if err != nil {
+		return nil, err
+	}
+	query := &deb.AndQuery{
+		L: &deb.FieldQuery{Field: "Name", Relation: deb.VersionEqual, Value: name},
+		R: &deb.FieldQuery{Field: "$Architecture", Relation: deb.VersionEqual, Value: arch},
+	}
+	packages := index.Query(query)
+	if len(packages) == 0 {
+		return nil, &NotFoundError{Name: name, Arch: arch}
+	}
+	locked := index.Origin(packages[0]).Locked(packages[0])
+	return &locked, nil
+}
+
+// 内存中的仓库，不访问网络，包的下载地址为 root 下 Filename 对应的 file:// 地址
+type FakeArchive struct {
+	Repo      *Repository
+	Packages  *deb.PackageList
+	Libraries map[string][]string // soname -> 提供它的包
+}
+
+// 包需要包含 Filename 字段
+func NewFakeArchive(root string, packages ...*deb.Package) *FakeArchive {
+	list := deb.NewPackageList()
+	for _, p := range packages {
+		list.Add(p)
+	}
+	return &FakeArchive{
+		Repo:      &Repository{Name: "fake", Source: fileURL(root), Priority: comm.DefaultAptPriority, root: root},
+		Packages:  list,
+		Libraries: make(map[string][]string),
+	}
+}
+
+func (f *FakeArchive) PackageIndex(arch string) (*PackageIndex, error) {
+	index := NewPackageIndex()
+	index.Merge(f.Repo, f.Packages)
+	return index, nil
+}
+
+func (f *FakeArchive) LookupLibraries(arch string, sonames map[string]bool) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for soname := range sonames {
+		if packages, ok := f.Libraries[soname]; ok {
+			result[soname] = packages
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeArchive) Offline() bool {
+	return true
+}
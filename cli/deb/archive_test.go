@@ -0,0 +1,139 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+)
+
+func newTestArchive() *FakeArchive {
+	recommends := newTestPackage("demo", "1.0", "amd64", "libfoo | libbar1").Stanza()
+	recommends["Recommends"] = "demo-data"
+	return NewFakeArchive("/srv/repo",
+		deb.NewPackageFromControlFile(recommends),
+		newTestPackage("demo-data", "1.0", "all", ""),
+		newTestPackage("libfoo", "1.0", "amd64", ""),
+		newTestPackage("libfoo", "2.0", "amd64", ""),
+		newTestPackage("libbar1", "1.0", "amd64", ""),
+	)
+}
+
+var testDataDependencyOptions = []struct {
+	follow   []string
+	packages string
+}{
+	{nil, "demo=1.0,libfoo=2.0"},
+	{[]string{"recommends"}, "demo-data=1.0,demo=1.0,libfoo=2.0"},
+	{[]string{"all-variants", "unknown"}, "demo=1.0,libbar1=1.0,libfoo=2.0"},
+}
+
+func TestFakeArchive(t *testing.T) {
+	archive := newTestArchive()
+	locked, err := LocatePackage(archive, "libfoo", "amd64")
+	if err != nil || locked.Version != "2.0" || locked.Url != "file:///srv/repo/pool/main/libfoo_2.0_amd64.deb" {
+		t.Fatalf("Failed test for LocatePackage! Error: %v %+v", err, locked)
+	}
+	var notFound *NotFoundError
+	if _, err := LocatePackage(archive, "libfoo", "arm64"); !errors.As(err, &notFound) {
+		t.Errorf("Failed test for LocatePackage! Error: want NotFoundError, got %v", err)
+	}
+
+	for _, tds := range testDataDependencyOptions {
+		group := GroupDebs([]Deb{{Id: "org.app", Name: "app", Package: "app", DebVersion: "1.0", Architecture: "amd64", Depends: "demo"}})[0]
+		options := ResolveOptions{WithDeps: true, Options: DependencyOptions(tds.follow), Installed: []InstalledSet{}}
+		if err := group.ResolveDepends(archive, options); err != nil {
+			t.Fatalf("Failed test for ResolveDepends! Error: %s", err)
+		}
+		var ret []string
+		for _, item := range group.Depends {
+			ret = append(ret, item.Name+"="+item.Version)
+		}
+		sort.Strings(ret)
+		if strings.Join(ret, ",") != tds.packages {
+			t.Errorf("Failed test for ResolveDepends! Error: %v got %s, want %s", tds.follow, strings.Join(ret, ","), tds.packages)
+		}
+	}
+}
+
+func TestCachedArchive(t *testing.T) {
+	archive := NewCachedArchive(newTestArchive())
+	index, err := archive.PackageIndex("amd64")
+	if err != nil {
+		t.Fatalf("Failed test for CachedArchive! Error: %s", err)
+	}
+	if again, _ := archive.PackageIndex("amd64"); again != index {
+		t.Errorf("Failed test for CachedArchive! Error: index loaded twice")
+	}
+	count := index.Len()
+
+	// 部分更新时锁定的包只加入索引的副本
+	group := GroupDebs([]Deb{{Id: "org.app", Name: "app", Package: "app", DebVersion: "1.0", Architecture: "amd64", Depends: "demo"}})[0]
+	group.Lock = &Lock{Depends: []LockedPackage{{Name: "libfoo", Version: "1.0", Architecture: "amd64", Url: "file:///srv/repo/pool/main/libfoo_1.0_amd64.deb"}}}
+	group.Update = LockUpdate{Names: []string{"demo"}}
+	if err := group.ResolveDepends(archive, ResolveOptions{WithDeps: true, Installed: []InstalledSet{}}); err != nil {
+		t.Fatalf("Failed test for ResolveDepends! Error: %s", err)
+	}
+	if libfoo := group.Lock.Depend("libfoo"); libfoo == nil || index.Len() != count {
+		t.Errorf("Failed test for CachedArchive! Error: shared index changed, %d packages, want %d", index.Len(), count)
+	}
+	for _, item := range group.Depends {
+		if item.Name == "libfoo" && item.Version != "1.0" {
+			t.Errorf("Failed test for ResolveDepends! Error: locked libfoo not used, got %s", item.Version)
+		}
+	}
+}
+
+func TestCachedArchiveLibraries(t *testing.T) {
+	fake := newTestArchive()
+	fake.Libraries["libfoo.so.1"] = []string{"libfoo"}
+	archive := NewCachedArchive(fake)
+	found, err := archive.LookupLibraries("amd64", map[string]bool{"libfoo.so.1": true, "libbar.so.1": true})
+	if err != nil || len(found) != 1 || found["libfoo.so.1"][0] != "libfoo" {
+		t.Fatalf("Failed test for LookupLibraries! Error: %v %v", found, err)
+	}
+	// 查找过的 soname 使用缓存，包括找不到的
+	fake.Libraries["libbar.so.1"] = []string{"libbar1"}
+	if found, _ := archive.LookupLibraries("amd64", map[string]bool{"libbar.so.1": true}); len(found) != 0 {
+		t.Errorf("Failed test for LookupLibraries! Error: cached result not used, got %v", found)
+	}
+}
+
+// 读取 Contents 时会重新设置仓库的签名 key，与解析依赖时读取锁定信息同时进行，使用 -race 运行时检查数据竞争
+func TestRepositoryState(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Release"), []byte("Suite: stable\n"), 0644)
+	repo := &Repository{Name: "main", Source: "http://example.com/debian", Distro: "stable", IgnoreSignatures: true, TTL: time.Hour, root: "/srv/repo"}
+	p := newTestPackage("libfoo", "1.0", "amd64", "")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := repo.FetchRelease(dir); err != nil {
+				t.Errorf("Failed test for FetchRelease! Error: %s", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			repo.Locked(p)
+		}
+	}()
+	wg.Wait()
+}
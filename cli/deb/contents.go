@@ -0,0 +1,194 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/tools/download"
+	"pkg.deepin.com/linglong/pica/tools/fs"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// Contents 索引的缓存目录
+const contentsDir = "contents"
+
+// Release 文件中列出的索引文件
+type releaseFile struct {
+	Path   string
+	SHA256 string
+}
+
+// 下载仓库的 Contents-<arch> 索引，Release 中存在校验值时只在变化后重新下载，返回本地文件列表
+func FetchContentsIndex(repo *Repository, arch string) ([]string, error) {
+	root := repo.DistURL()
+	cacheDir := repo.cacheDir()
+	// 多个 ll-pica 同时运行时共享缓存目录
+	unlock, err := lockFile(filepath.Join(cacheDir, "lock"))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// 存放 deb 包的本地目录没有 Contents，由 deb 包的文件列表生成
+	if repo.Local() && repo.flat() {
+		local := filepath.Join(cacheDir, "Contents-"+arch+".gz")
+		root, _ := localRoot(repo.Source)
+		if err := GenerateContents(root, arch, local); err != nil {
+			return nil, err
+		}
+		return []string{local}, nil
+	}
+
+	// Contents 的校验值来自签名校验后的 Release
+	data, err := repo.FetchRelease(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	files := contentsFromRelease(string(data), arch)
+	if len(files) == 0 {
+		// Release 中没有列出 Contents 时尝试常见的位置
+		files = []releaseFile{{Path: "main/Contents-" + arch + ".gz"}, {Path: "Contents-" + arch + ".gz"}}
+	}
+
+	var result []string
+	for _, file := range files {
+		local := filepath.Join(cacheDir, strings.ReplaceAll(file.Path, "/", "_"))
+		if file.SHA256 != "" {
+			if hash, err := fs.GetFileSha256(local); err == nil && hash == file.SHA256 {
+				log.Logger.Debugf("use cached %s", local)
+				result = append(result, local)
+				continue
+			}
+		}
+		// 下载时按 Release 中的校验值校验
+		if err := fetch(root+"/"+file.Path, local, file.SHA256); err != nil {
+			var checksumErr *download.ChecksumError
+			if errors.As(err, &checksumErr) {
+				return nil, err
+			}
+			log.Logger.Debugf("download %s error: %s", file.Path, err)
+			continue
+		}
+		result = append(result, local)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no Contents-%s index found in %s", arch, root)
+	}
+	return result, nil
+}
+
+// 从 Release 的 SHA256 段中找出对应架构的 Contents 索引
+func contentsFromRelease(release, arch string) []releaseFile {
+	var files []releaseFile
+	for _, file := range releaseFiles(release) {
+		if path.Base(file.Path) == "Contents-"+arch+".gz" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Release 的 SHA256 段中列出的所有文件
+func releaseFiles(release string) []releaseFile {
+	var files []releaseFile
+	inSHA256 := false
+	for _, line := range strings.Split(release, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			inSHA256 = strings.TrimSpace(line) == "SHA256:"
+			continue
+		}
+		fields := strings.Fields(line)
+		if inSHA256 && len(fields) == 3 {
+			files = append(files, releaseFile{Path: fields[2], SHA256: fields[0]})
+		}
+	}
+	return files
+}
+
+// 在 Contents 索引中查找提供这些库的包，返回 soname -> 包名
+func LookupContents(files []string, sonames map[string]bool) (map[string][]string, error) {
+	result := make(map[string][]string)
+	for _, file := range files {
+		if err := scanContents(file, func(filePath string, packages []string) {
+			name := path.Base(filePath)
+			if !sonames[name] || !libraryDirPattern.MatchString(path.Dir(filePath)) {
+				return
+			}
+			for _, p := range packages {
+				if !contains(result[name], p) {
+					result[name] = append(result[name], p)
+				}
+			}
+		}); err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+	}
+	return result, nil
+}
+
+// 逐行解析 Contents 索引，每行为 "文件路径 区域/包名,区域/包名"，路径中可能包含空格
+func scanContents(file string, fn func(filePath string, packages []string)) error {
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	reader, err := gzip.NewReader(fd)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		idx := strings.LastIndexAny(line, " \t")
+		if idx <= 0 {
+			continue
+		}
+		filePath := strings.TrimPrefix(strings.TrimSpace(line[:idx]), "./")
+		var packages []string
+		for _, location := range strings.Split(line[idx+1:], ",") {
+			packages = append(packages, path.Base(location))
+		}
+		fn(filePath, packages)
+	}
+	return scanner.Err()
+}
+
+var cacheNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// 仓库的 Release 和 Contents 索引的缓存目录
+func (r *Repository) cacheDir() string {
+	return filepath.Join(comm.PicaConfigPath(), contentsDir, cacheName(r.DistURL()))
+}
+
+// 将仓库地址转换为缓存目录名
+func cacheName(url string) string {
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "http://"), "https://")
+	return strings.Trim(cacheNamePattern.ReplaceAllString(url, "_"), "_")
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -7,28 +7,16 @@
 package deb
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
-	"strconv"
 	"strings"
-	"sync"
 
-	"github.com/smira/flag"
-	"pault.ag/go/debian/control"
-
-	"github.com/aptly-dev/aptly/aptly"
-	"github.com/aptly-dev/aptly/cmd"
 	"github.com/aptly-dev/aptly/deb"
-	"github.com/aptly-dev/aptly/pgp"
-	"github.com/aptly-dev/aptly/query"
-	"github.com/aptly-dev/aptly/utils"
 
 	"pkg.deepin.com/linglong/pica/cli/comm"
-	"pkg.deepin.com/linglong/pica/cli/linglong"
 	"pkg.deepin.com/linglong/pica/tools/fs"
 	"pkg.deepin.com/linglong/pica/tools/log"
 )
@@ -45,50 +33,60 @@ type Deb struct {
 	SHA256       string `control:"SHA256"`
 	Desc         string `control:"Description"`
 	Depends      string `control:"Depends"`
+	PreDepends   string `control:"Pre-Depends"`
+	Provides     string `control:"Provides"`
 	Architecture string `control:"Architecture"`
 	Filename     string `control:"Filename"`
+	DebVersion   string // deb 包原始的版本号
 	FromAppStore bool
-	PackageKind  string
 	Command      []string
 	Sources      []comm.Source
-	Build        []string
-	DelMap       map[string]bool // 用来记录跳过的包的映射，每个Deb实例独立
+	Scripts      []ScriptAction   // 维护者脚本的分析结果
+	Desktops     []DesktopCommand // desktop 文件以及对应的启动命令
+	DesktopEdits []DesktopChange  // desktop 文件中改写过的键
+	Icons        []IconResult     // desktop 文件中图标的解析结果
+	Rewrites     []ScriptRewrite  // 改写过的启动脚本
+	Lossy        []string         // 版本号映射时丢失的信息
+	Warnings     Warnings         // 转换时需要检查的警告
 }
 
-func (d *Deb) GetPackageUrl(source, distro, arch string) string {
-	aptlyCache := comm.AptlyCachePath()
-	// 删除掉aptly缓存的内容
-	if ret, _ := fs.CheckFileExits(aptlyCache); ret {
-		log.Logger.Debugf("%s is existd!", aptlyCache)
-		if ret, err := fs.RemovePath(aptlyCache); err != nil {
-			log.Logger.Warnf("err:%+v, out: %+v", err, ret)
-		}
-	}
+// 转包时复制到 sources 目录的 ll-pica，相对于 sources 目录
+const StagedPica = ".pica/ll-pica"
 
-	root := cmd.RootCommand()
-	root.UsageLine = "aptly"
+// install_dep 所在的目录，linglong-pica 同时在这里安装一份 ll-pica
+const helperDir = "/usr/libexec/linglong/builder/helper"
 
-	// 只过滤需要搜索的包
-	args := []string{
-		"mirror",
-		"create",
-		"-ignore-signatures",
-		"-architectures=" + arch,
-		"-filter=" + d.Name,
-		distro,
-		source,
-		distro,
-	}
+// 设置黑名单过滤包，不获取依赖
+var skipPackage = []string{"deepin-elf-verify", "systemd", "systemd-dev", "usrmerge", "xdg-utils", "dbus", "dbus-broker"}
 
-	cmd.Run(root, args, cmd.GetContext() == nil)
+// 获取包的下载地址，仓库中找不到时回退到 apt download，签名错误时直接返回错误
+func (d *Deb) GetPackageUrl(archive Archive, arch string) (string, error) {
+	locked, err := LocatePackage(archive, d.Name, arch)
+	if err == nil {
+		if d.Hash == "" {
+			d.Hash = locked.SHA256
+		}
+		log.Logger.Infof("%s %s from %s", d.Name, locked.Version, locked.Origin)
+		return locked.Url, nil
+	}
+	var sigErr *SignatureError
+	if errors.As(err, &sigErr) {
+		return "", err
+	}
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		d.Warnings.Warnf("load package index error: %s", err)
+	}
 
-	d.GetPackageList(distro)
-	if len(d.Sources) > 0 {
-		return d.Sources[0].Url
-	} else {
-		log.Logger.Warnf("%s not found url, fallback to apt download", d.Name)
-		return AptDownload(d.Name)
+	// apt download 只能获取本机架构的包，并且需要访问网络
+	if arch != runtime.GOARCH || archive.Offline() {
+		return "", err
 	}
+	d.Warnings.Warnf("%s not found url, fallback to apt download", d.Name)
+	if url := AptDownload(d.Name); url != "" {
+		return url, nil
+	}
+	return "", err
 }
 
 func (d *Deb) CheckDebHash() bool {
@@ -99,216 +97,127 @@ func (d *Deb) CheckDebHash() bool {
 		return true
 	}
 	if err != nil {
-		log.Logger.Warn(err)
+		d.Warnings.Warnf("%s", err)
 		d.Hash = hash
 		return false
 	}
 	return hash == d.Hash
 }
 
-// FetchDebFile
-func (d *Deb) FetchDebFile(dstPath string) bool {
+// FetchDebFile 获取 deb 包，repo 类型的 http 地址和 local 类型的本地路径都由下载器处理，下载时校验 SHA256，
+// 下载的包加入全局缓存
+func (d *Deb) FetchDebFile(dstPath string) error {
 	log.Logger.Debugf("FetchDebFile %s,ts:%v type:%s", dstPath, d, d.Type)
 
-	if d.Type == "repo" {
-		fs.CreateDir(fs.GetFilePPath(dstPath))
-
-		if ret, msg, err := comm.ExecAndWait(1<<20, "wget", "-O", dstPath, d.Ref); err != nil {
-			log.Logger.Warnf("msg: %+v, out: %+v", msg, err, ret)
-			return false
-		} else {
-			log.Logger.Debugf("ret: %+v", ret)
-		}
-
-		if ret, err := fs.CheckFileExits(dstPath); ret {
-			d.Path = dstPath
-			return true
-		} else {
-			log.Logger.Warnf("downalod %s , err:%+v", dstPath, err)
-			return false
-		}
-	} else if d.Type == "local" {
-		if ret, err := fs.CheckFileExits(d.Ref); !ret {
-			log.Logger.Warnf("not exist ! %s , err:%+v", d.Ref, err)
-			return false
-		}
-
-		fs.CreateDir(fs.GetFilePPath(dstPath))
-		if ret, msg, err := comm.ExecAndWait(1<<8, "cp", "-v", d.Ref, dstPath); err != nil {
-			log.Logger.Fatalf("msg: %+v err:%+v, out: %+v", msg, err, ret)
-			return false
-		} else {
-			log.Logger.Debugf("ret: %+v", ret)
-		}
-
-		if ret, err := fs.CheckFileExits(dstPath); ret {
-			d.Path = dstPath
-			return true
-		} else {
-			log.Logger.Warnf("downalod %s , err:%+v", dstPath, err)
-			return false
-		}
+	if d.Type != "repo" && d.Type != "local" {
+		return comm.NewStageError(comm.StageFetch, d.Name, fmt.Errorf("unsupported type %q", d.Type))
 	}
-	return false
+	if err := fetchPackage(d.Ref, dstPath, d.Hash, &d.Warnings); err != nil {
+		return comm.NewStageError(comm.StageFetch, d.Name, err)
+	}
+	d.Path = dstPath
+	return nil
 }
 
-func (d *Deb) ExtractDeb() error {
-	if ret, err := AptShow(d.Path); err != nil {
+// 提取 deb 包的相关数据，policy 为版本号映射策略，arch 为转换的目标架构，Architecture 为 all 的包使用该架构
+func (d *Deb) ExtractDeb(policy VersionPolicy, arch string) error {
+	// 直接读取 deb 包中的 control 文件，不依赖 apt-cache
+	info, err := ReadDebControl(d.Path)
+	if err != nil {
+		log.Logger.Warnf("read control error: %s", err)
 		return err
-	} else {
-		// apt-cache show Unmarshal
-		info, err := control.ParseControl(bufio.NewReader(strings.NewReader(ret)), "")
-		if err != nil {
-			log.Logger.Warnf("parse control error: %s", err)
-			return err
-		}
-		d.Package = info.Source.Paragraph.Values["Package"]
-		// 格式化成玲珑使用的四位版本号，剔除非数字部分
-		d.Version = formatVersion(info.Source.Paragraph.Values["Version"])
-		d.SHA256 = info.Source.Paragraph.Values["SHA256"]
-		// 在描述信息里添加原包的版本号信息
-		d.Desc = fmt.Sprintf("convert from %s    %s", info.Source.Paragraph.Values["Version"], strings.ReplaceAll(info.Source.Paragraph.Values["Description"], "\n", ""))
-		d.Depends = info.Source.Paragraph.Values["Depends"]
-		if info.Source.Paragraph.Values["Architecture"] == "all" {
-			d.Architecture = runtime.GOARCH
-		} else {
-			d.Architecture = info.Source.Paragraph.Values["Architecture"]
-		}
-		d.Filename = info.Source.Paragraph.Values["Filename"]
 	}
-
-	// 解压 deb 包，部分内容需要从解开的包中获取
-	debDirPath := filepath.Join(filepath.Dir(d.Path), d.Name)
-	if ret, msg, err := comm.ExecAndWait(1<<20, "dpkg-deb", "-x", d.Path, debDirPath); err != nil {
-		log.Logger.Warnf("msg: %+v err:%+v, out: %+v", msg, err, ret)
+	d.Package = info.Values["Package"]
+	// 映射成玲珑使用的四位版本号，保证版本顺序不颠倒
+	mapped, err := policy.Map(info.Values["Version"])
+	if err != nil {
+		log.Logger.Warnf("map version error: %s", err)
 		return err
-	} else {
-		log.Logger.Debugf("ret: %+v", ret)
-		// 应用商店的 deb 包，包含 opt/apps 目录，针对该目录是否存在，判定是否为应用商店包
-		targetPath := filepath.Join(debDirPath, "opt/apps")
-		if ret, _ := fs.CheckFileExits(targetPath); ret {
-			log.Logger.Infof("%s is from app-store", d.Name)
-			d.FromAppStore = true
-		} else {
-			log.Logger.Infof("%s is not from app-store", d.Name)
-		}
 	}
-
-	if d.Type != "local" {
-		d.Sources = append(d.Sources, comm.Source{Kind: "file", Digest: d.Hash, Url: d.Ref})
+	for _, lossy := range mapped.Lossy {
+		log.Logger.Warnf("%s version %s => %s: %s", d.Name, mapped.Deb, mapped.Linglong, lossy)
+	}
+	d.Version = mapped.Linglong
+	d.Lossy = mapped.Lossy
+	d.SHA256 = info.Values["SHA256"]
+	// 在描述信息里添加原包的版本号信息
+	d.Desc = fmt.Sprintf("convert from %s    %s", info.Values["Version"], strings.ReplaceAll(info.Values["Description"], "\n", ""))
+	d.DebVersion = info.Values["Version"]
+	d.Depends = info.Values["Depends"]
+	d.PreDepends = info.Values["Pre-Depends"]
+	d.Provides = info.Values["Provides"]
+	if info.Values["Architecture"] == "all" {
+		d.Architecture = arch
+		if arch == "" {
+			d.Architecture = runtime.GOARCH
+		}
+	} else {
+		d.Architecture = info.Values["Architecture"]
 	}
+	d.Filename = info.Values["Filename"]
 
-	// 应用需要指定，四位版本号
-	parts := strings.Split(d.Version, ".")
-	numParts := len(parts)
-	// 补足缺失的部分，使其成为四位版本号
-	for numParts < 4 {
-		parts = append(parts, "0")
-		numParts++
+	// 分析维护者脚本，不支持的动作需要打包者检查
+	scripts, err := ReadDebScripts(d.Path)
+	if err != nil {
+		log.Logger.Warnf("read maintainer scripts error: %s", err)
+		return err
 	}
-	d.Version = strings.Join(parts[:4], ".") // 只取前四个部分组成新的版本号
-
-	return nil
-}
-
-// 解析依赖
-func (d *Deb) ResolveDepends(source, distro string, withDep bool) {
-	// 可能存在依赖为空的情况
-	if d.Depends == "" {
-		return
-	}
-
-	// mirror_update_args []string
-	// 玲珑作为单应用程序，不需要在意里面的版本冲突，直接选择最新版本
-	// 定义一个正则表达式，删除匹配括号及其中的内容
-	reParentheses := regexp.MustCompile(`\([^)]*\)`)
-	filter := strings.Replace(reParentheses.ReplaceAllString(d.Depends, ""), ",", "|", -1)
-	// 移除所有空格
-	reSpace := regexp.MustCompile(`\s+`)
-	filter = reSpace.ReplaceAllString(filter, "")
-
-	// 设置黑名单过滤包，不获取依赖
-	skipPackage := []string{"deepin-elf-verify", "systemd", "systemd-dev", "usrmerge", "xdg-utils", "dbus", "dbus-broker"}
-	cli := linglong.NewLinglongCli()
-	// 过滤掉 base 中安装过的包
-	skipPackage = append(skipPackage, cli.GetBaseInsPack()...)
-	// 过滤掉 runtime 中安装过的包
-	skipPackage = append(skipPackage, cli.GetRuntimeInsPack()...)
-	filterSlice := strings.Split(filter, ",")
-	d.DelMap = make(map[string]bool) // 初始化为每个Deb独立的map
-	for _, item := range skipPackage {
-		d.DelMap[item] = true
-	}
-	var result []string
-	for _, item := range filterSlice {
-		if !d.DelMap[item] {
-			result = append(result, item)
+	d.Scripts = nil
+	for _, name := range maintScripts {
+		if content, ok := scripts[name]; ok {
+			d.Scripts = append(d.Scripts, AnalyzeMaintScript(name, content)...)
 		}
 	}
-	filter = strings.Join(result, ",")
-
-	// 删除掉aptly缓存的内容
-	aptlyCache := comm.AptlyCachePath()
-	if ret, _ := fs.CheckFileExits(aptlyCache); ret {
-		log.Logger.Debugf("%s is existd!", aptlyCache)
-		if ret, err := fs.RemovePath(aptlyCache); err != nil {
-			log.Logger.Warnf("err:%+v, out: %+v", err, ret)
+	for _, action := range d.Scripts {
+		switch action.Kind {
+		case ActionUnsupported:
+			log.Logger.Warnf("%s %s:%d unsupported, please review: %s (%s)", d.Name, action.Script, action.Line, action.Command, action.Reason)
+		case ActionTranslatable:
+			log.Logger.Infof("%s %s:%d translated: %s", d.Name, action.Script, action.Line, action.Command)
+		default:
+			log.Logger.Debugf("%s %s:%d ignored: %s (%s)", d.Name, action.Script, action.Line, action.Command, action.Reason)
 		}
 	}
 
-	if d.Architecture == "" || d.Name == "" {
-		log.Logger.Errorf("arch or package name is empty")
-		return
-	}
-
-	// 依赖为空，不需要处理
-	if filter == "" {
-		return
+	// 解压 deb 包，部分内容需要从解开的包中获取
+	debDirPath := filepath.Join(filepath.Dir(d.Path), d.Name)
+	if err := ExtractDebData(d.Path, debDirPath); err != nil {
+		log.Logger.Warnf("extract %s error: %s", d.Path, err)
+		return err
 	}
-
-	root := cmd.RootCommand()
-	root.UsageLine = "aptly"
-
-	args := []string{
-		"mirror",
-		"create",
-		"-ignore-signatures",
-		"-architectures=" + d.Architecture,
-		"-filter=" + filter,
+	// 应用商店的 deb 包，包含 opt/apps 目录，针对该目录是否存在，判定是否为应用商店包
+	targetPath := filepath.Join(debDirPath, "opt/apps")
+	if ret, _ := fs.CheckFileExits(targetPath); ret {
+		log.Logger.Infof("%s is from app-store", d.Name)
+		d.FromAppStore = true
+	} else {
+		log.Logger.Infof("%s is not from app-store", d.Name)
 	}
 
-	if withDep {
-		args = append(args, "-filter-with-deps")
+	if d.Type != "local" {
+		d.Sources = append(d.Sources, comm.Source{Kind: "file", Digest: d.Hash, Url: d.Ref})
 	}
 
-	args = append(args, []string{
-		distro,
-		source,
-		distro,
-	}...)
-
-	cmd.Run(root, args, cmd.GetContext() == nil)
-
-	d.GetPackageList(distro)
+	return nil
 }
 
-func (d *Deb) GenerateBuildScript() {
-	d.Build = append(d.Build, []string{
+// 构建脚本的开头，设置源码目录和临时目录
+func buildScriptBegin() []string {
+	return []string{
 		"#>>> auto generate by ll-pica begin",
 		"set -x",
-	}...)
-
-	// 设置 linglong/sources 目录
-	d.Build = append(d.Build, []string{
+		// 设置 linglong/sources 目录
 		"# set the local sources directory",
 		fmt.Sprintf("EXTERNAL_DEB_SOURCES=\"%s\"", comm.LlLocalSourceDir),
 		"# set the linglong/sources directory",
 		fmt.Sprintf("SOURCES=\"%s\"", comm.LlSourceDir),
 		"OUT_DIR=\"$(mktemp -d)\"", // 临时目录，处理完内容再移动到$PREFIX
 		"DEPS_LIST=\"$OUT_DIR/DEPS.list\"",
-	}...)
+	}
+}
 
-	d.PackageKind = "app"
+// 直接修改解压目录中的 desktop 文件和脚本，同时从 desktop 文件中获取启动命令
+func (d *Deb) editScript() {
 	// linglong/sources 下解压 app 后的目录
 	debDirPath := filepath.Join(filepath.Dir(d.Path), d.Name)
 
@@ -317,91 +226,49 @@ func (d *Deb) GenerateBuildScript() {
 		// 删除多余的 desktop 文件
 		if ret, msg, err := comm.ExecAndWait(10, "sh", "-c",
 			fmt.Sprintf("find %s -name '*.desktop' | grep _uos | xargs -I {} rm {}", debDirPath)); err != nil {
-			log.Logger.Warnf("remove extra desktop file error: %+v", msg)
+			d.Warnings.Warnf("remove extra desktop file error: %+v", msg)
 		} else {
 			log.Logger.Debugf("remove extra desktop file: %+v", ret)
 		}
 	}
 
-	desktopFiles, msg, err := comm.ExecAndWait(10, "sh", "-c", fmt.Sprintf("find %s -name '*.desktop' | grep applications", debDirPath))
-	if err != nil {
-		log.Logger.Fatalf("find desktop error: %s out: %s", msg, desktopFiles)
-	}
+	// 图标安装到 hicolor 主题中，需要在改写 Icon 之前处理
+	d.Icons = collectIcons(debDirPath, d.FromAppStore, &d.Warnings)
 
-	// 读取desktop 文件
-	var desktopData fs.DesktopData
-	var status bool
-	var execLine, iconValue, realPackageName string
-
-	// 商店包存在包名和 内部 appid 名无法对应的情况，获取解包后真实路径
-	if entries, err := os.ReadDir(debDirPath + "/opt/apps"); err == nil {
-		realPackageName = entries[0].Name()
+	// 直接改写解压目录中的 desktop 文件，构建时随应用文件一起复制
+	d.Desktops, d.DesktopEdits = rewriteDesktops(debDirPath, d.Id, &d.Warnings)
+	for _, item := range d.Desktops {
+		log.Logger.Infof("desktop %s [%s]: %s", item.File, item.Group, strings.Join(item.Command, " "))
 	}
-
-	// 如果存在多个 desktop 文件进行循环, 生成对应的 sed 操作
-	for _, desktop := range strings.Split(desktopFiles, "\n") {
-		if desktop == "" {
-			continue
-		}
-		status, desktopData = fs.DesktopInit(desktop)
-		if !status {
-			log.Logger.Errorf("load desktop error: %s", desktop)
-			continue
-		}
-
-		//获取 desktop 文件，Exec 行的内容,并且对字符串做处理
-		pattern := regexp.MustCompile(`Exec=|"|\n`)
-		execLine = pattern.ReplaceAllLiteralString(desktopData["Desktop Entry"]["Exec"], "")
-
-		// 正则表达式，匹配"/usr/"或者"/opt/apps/$appid/file/"，参考 https://regex101.com/r/oyo0YX/1
-		pattern = regexp.MustCompile(`/usr/|/opt/apps/[^/]+/files/`)
-
-		// 使用正则表达式找到匹配的部分并替换
-		execLine = pattern.ReplaceAllLiteralString(execLine, fmt.Sprintf("/opt/apps/%s/files/", d.Id))
-
-		iconValue = fs.TransIconToLl(desktopData["Desktop Entry"]["Icon"])
-		index := strings.Index(desktop, comm.LlLocalSourceDir)
-		if index != -1 {
-			// 如果找到了子串，则移除它及其之前的部分
-			modiDesktopPath := "$EXTERNAL_DEB_SOURCES" + desktop[index+len(comm.LlLocalSourceDir):]
-			d.Build = append(d.Build, []string{
-				"# modify desktop, Exec and Icon should not contanin absolut paths",
-				fmt.Sprintf("sed -i '/Exec*/c\\Exec=%s' %s", execLine, modiDesktopPath),
-				fmt.Sprintf("sed -i '/Icon*/c\\Icon=%s' %s", iconValue, modiDesktopPath),
-			}...)
-		}
+	for _, item := range d.DesktopEdits {
+		log.Logger.Debugf("desktop %s [%s] %s: %s => %s", item.File, item.Group, item.Key, item.Old, item.New)
 	}
 
-	// 以 sh 后缀的脚本，替换脚本中的路径，考虑到deb包定义包名和玲珑id名不一样的情况
-	if execFiles, _, err := comm.ExecAndWait(10, "sh", "-c",
-		// 找到可执行文件，以 .sh 后缀的脚本。统一将内部的原包名替换为设置的玲珑id，少部分存在没写 .sh 后缀的人工判断，其他方式很难判断该脚本为shell.
-		fmt.Sprintf("find %s -name '*.sh'", debDirPath)); err == nil {
-		for _, execFile := range strings.Split(execFiles, "\n") {
-			if execFile == "" {
-				continue
-			}
-			index := strings.Index(execFile, comm.LlLocalSourceDir)
-			if index != -1 {
-				// 如果找到了子串，则移除它及其之前的部分
-				modiExecFilePath := "$EXTERNAL_DEB_SOURCES" + execFile[index+len(comm.LlLocalSourceDir):]
-				d.Build = append(d.Build, []string{
-					fmt.Sprintf("sed -i 's/%s/%s/g' %s", d.Name, d.Id, modiExecFilePath),
-				}...)
-			}
-		}
-	}
+	// 按 shebang 和内容识别启动脚本，只改写包内文件的路径和旧的应用目录
+	d.Rewrites = rewriteScripts(debDirPath, d.Name, d.Id)
+
+	d.Command = mainDesktopCommand(d.Desktops)
+}
 
-	if len(d.Sources) > 0 {
-		d.Build = append(d.Build, []string{
+// 解压所有 deb 包（包括依赖）并安装到 $PREFIX，hasSources 表示是否存在依赖包
+func depsScript(hasSources bool) []string {
+	var build []string
+	if hasSources {
+		build = append(build, []string{
 			"find $SOURCES -type f -name \"*.deb\" >> $DEPS_LIST || exit 1",
 		}...)
 	}
 
 	// 玲珑内部的 /opt/apps 路径拼接的是 linglong-id
-	d.Build = append(d.Build, []string{
+	build = append(build, []string{
 		"find $EXTERNAL_DEB_SOURCES -type f -name \"*.deb\" >> $DEPS_LIST || exit 1",
 		"DATA_LIST_DIR=\"$OUT_DIR/data\"", // 包数据存放的临时目录
-		"mkdir -p /tmp/deb-source-file",   // 用于记录安装的所有文件来自哪个包
+		// 优先使用转包时复制到 sources 目录的 ll-pica，其次是构建环境中安装的 ll-pica
+		fmt.Sprintf("PICA=\"$EXTERNAL_DEB_SOURCES/%s\"", StagedPica),
+		"if ! [ -x \"$PICA\" ]; then",
+		fmt.Sprintf("    PICA=$(PATH=$PATH:%s command -v ll-pica) || { echo \"ll-pica not found in the build environment\" >&2; exit 1; }", helperDir),
+		"fi",
+		"mkdir -p /tmp/deb-source-file", // 用于记录安装的所有文件来自哪个包
 		"while IFS= read -r file",
 		"do",
 		"    CONTROL_FILE=$(ar -t $file | grep control.tar)", // 提取control文件
@@ -413,27 +280,9 @@ func (d *Deb) GenerateBuildScript() {
 		"    mkdir -p $DATA_LIST_DIR",
 		"    tar -xvf $DATA_FILE -C $DATA_LIST_DIR >> \"/tmp/deb-source-file/$(basename $file).list\"", // 解压data.tar文件到输出目录
 		"    rm -rf $DATA_FILE 2>/dev/null || true",
-		"    rm -r ${DATA_LIST_DIR:?}/usr/share/applications* 2>/dev/null || true",                           // 清理不需要复制的目录
-		"    sed -i \"s#/usr#$PREFIX#g\" $DATA_LIST_DIR/usr/lib/$TRIPLET/pkgconfig/*.pc 2>/dev/null || true", // # 修改pc文件的prefix
-		"    sed -i \"s#/usr#$PREFIX#g\" $DATA_LIST_DIR/usr/share/pkgconfig/*.pc 2>/dev/null || true",
-		"    find $DATA_LIST_DIR -type l | while IFS= read -r file; do", // 修改指向/lib的绝对路径的软链接
-		"        Link_Target=$(readlink $file)",
-		"        if echo $Link_Target | grep -q ^/lib && ! [ -f $Link_Target ]; then", // 如果指向的路径以/lib开头，并且文件不存在，则添加 /runtime 前缀, 部分 dev 包会创建 so 文件的绝对链接指向 /lib 目录下
-		"            ln -sf $PREFIX$Link_Target $file",
-		"            echo \"    FIX LINK $Link_Target => $PREFIX$Link_Target\"",
-		"        fi",
-		"    done",
-		"    find $DATA_LIST_DIR -type f -exec file {} \\; | grep 'shared object' | awk -F: '{print $1}' | while IFS= read -r file; do", // 修复动态库的RUNPATH
-		"        runpath=$(readelf -d $file | grep RUNPATH |  awk '{print $NF}')",
-		"        if echo $runpath | grep -q '^\\[/'; then", // 如果RUNPATH使用绝对路径，则添加/runtime前缀
-		"            runpath=${runpath#[}",
-		"            runpath=${runpath%]}",
-		"            newRunpath=${runpath//usr\\/lib/runtime\\/lib}",
-		"            newRunpath=${newRunpath//usr/runtime}",
-		"            patchelf --set-rpath $newRunpath $file",
-		"            echo \"    FIX RUNPATH $file $runpath => $newRunpath\"",
-		"        fi",
-		"    done",
+		"    rm -r ${DATA_LIST_DIR:?}/usr/share/applications* 2>/dev/null || true", // 清理不需要复制的目录
+		// 按前缀映射改写 pc 文件、指向包内或不存在文件的绝对软链接以及 ELF 的 RUNPATH，报告与文件列表放在一起
+		"    \"$PICA\" relocate $DATA_LIST_DIR --map /usr=$PREFIX --map /lib=$PREFIX/lib --map /bin=$PREFIX/bin -o \"/tmp/deb-source-file/$(basename $file).relocate.json\" || exit 1",
 		"    cp -rP $DATA_LIST_DIR/lib $PREFIX 2>/dev/null || true",
 		"    cp -rP $DATA_LIST_DIR/bin $PREFIX 2>/dev/null || true",
 		"    cp -rP $DATA_LIST_DIR/usr/* $PREFIX 2>/dev/null || true",
@@ -441,15 +290,66 @@ func (d *Deb) GenerateBuildScript() {
 		"rm -r $OUT_DIR || true", // # 清理临时目录
 	}...)
 
-	d.Build = append(d.Build, []string{
+	build = append(build, []string{
 		"",
 		"install -d $PREFIX/share",
 		"install -d $PREFIX/bin",
 		"install -d $PREFIX/lib",
 	}...)
+	return build
+}
+
+// 构建环境中通常没有安装 ll-pica，将当前的 ll-pica 复制到应用的 sources 目录，构建脚本使用它重定位依赖包。
+// 只能复制本机架构的程序，转换其他架构时构建环境中需要安装 ll-pica
+func StagePica(sourceDir, arch string) error {
+	dst := filepath.Join(sourceDir, StagedPica)
+	os.Remove(dst)
+	if arch != runtime.GOARCH {
+		return fmt.Errorf("ll-pica for %s cannot be staged on %s, install ll-pica in the build environment", arch, runtime.GOARCH)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	// 优先使用硬链接，不在同一个文件系统时复制
+	if err := os.Link(exe, dst); err == nil {
+		return nil
+	}
+	_, err = fs.CopyFile(exe, dst)
+	return err
+}
+
+// 维护者脚本中翻译后的构建步骤，需要在移动文件之后执行
+func (d *Deb) maintScript() []string {
+	var build []string
+	for _, action := range d.Scripts {
+		if action.Kind != ActionTranslatable {
+			continue
+		}
+		build = append(build, fmt.Sprintf("# %s: %s", action.Script, action.Command))
+		build = append(build, action.Build...)
+	}
+	if len(build) > 0 {
+		build = append([]string{"", fmt.Sprintf("# translated from maintainer scripts of %s", d.Name)}, build...)
+	}
+	return build
+}
+
+// 将 deb 包中应用的文件移动到 $PREFIX
+func (d *Deb) moveScript() []string {
+	var build []string
+	debDirPath := filepath.Join(filepath.Dir(d.Path), d.Name)
 
 	if d.FromAppStore {
-		d.Build = append(d.Build, []string{
+		// 商店包存在包名和 内部 appid 名无法对应的情况，获取解包后真实路径
+		var realPackageName string
+		if entries, err := os.ReadDir(debDirPath + "/opt/apps"); err == nil {
+			realPackageName = entries[0].Name()
+		}
+		build = append(build, []string{
 			"",
 			"# move files",
 			fmt.Sprintf("cp -r $EXTERNAL_DEB_SOURCES/%s/opt/apps/%s/entries/* $PREFIX/share", d.Name, realPackageName),
@@ -458,234 +358,80 @@ func (d *Deb) GenerateBuildScript() {
 	}
 
 	if _, err := os.ReadDir(debDirPath + "/usr"); err == nil {
-		d.Build = append(d.Build, []string{
+		build = append(build, []string{
 			"",
 			"# move files",
 			fmt.Sprintf("cp -r $EXTERNAL_DEB_SOURCES/%s/usr/* $PREFIX", d.Name),
 		}...)
 	}
-
-	d.Build = append(d.Build, "#>>> auto generate by ll-pica end")
-
-	d.Command = strings.Split(execLine, " ")
+	return build
 }
 
-// 获取 deb 包
-func (d *Deb) GetPackageList(distro string) {
-	context := cmd.GetContext()
-	defer context.Shutdown()
-	collectionFactory := context.NewCollectionFactory()
-	repo, err := collectionFactory.RemoteRepoCollection().ByName(distro)
-
-	if err != nil {
-		log.Logger.Errorf("unable to update: %s", err)
-	}
-
-	err = collectionFactory.RemoteRepoCollection().LoadComplete(repo)
-	if err != nil {
-		log.Logger.Errorf("unable to update: %s", err)
-	}
-
-	verifier, err := getVerifier(context.Flags())
-	if err != nil {
-		log.Logger.Errorf("unable to initialize GPG verifier: %s", err)
-	}
-
-	err = repo.Fetch(context.Downloader(), verifier)
-	if err != nil {
-		log.Logger.Errorf("unable to update: %s", err)
-	}
-
-	context.Progress().Printf("Downloading & parsing package files...\n")
-	err = repo.DownloadPackageIndexes(context.Progress(), context.Downloader(), verifier, collectionFactory, false)
-	if err != nil {
-		log.Logger.Errorf("unable to update: %s", err)
-	}
-
-	if repo.Filter != "" {
-		context.Progress().Printf("Applying filter...\n")
-		var filterQuery deb.PackageQuery
-
-		filterQuery, err = query.Parse(repo.Filter)
-		if err != nil {
-			log.Logger.Errorf("unable to update: %s", err)
-		}
-
-		var oldLen, newLen int
-		oldLen, newLen, err = repo.ApplyFilter(context.DependencyOptions(), filterQuery, context.Progress())
-		if err != nil {
-			log.Logger.Errorf("unable to update: %s", err)
-		}
-		context.Progress().Printf("Packages filtered: %d -> %d.\n", oldLen, newLen)
-	}
-
-	var (
-		downloadSize int64
-		queue        []deb.PackageDownloadTask
-	)
-
-	context.Progress().Printf("Building download queue...\n")
-	queue, downloadSize, err = repo.BuildDownloadQueue(context.PackagePool(), collectionFactory.PackageCollection(),
-		collectionFactory.ChecksumCollection(nil), false)
-
-	if err != nil {
-		log.Logger.Errorf("unable to update: %s", err)
-	}
-
+// 获取所有仓库的包索引并合并。远程仓库使用 profile 中持久化的 aptly 镜像，有效期内不访问网络，
+// Release 的签名按各仓库的 keyring 校验后才会下载索引。签名错误时返回 SignatureError，
+// 单个仓库加载失败时跳过，所有仓库都失败时返回最后一个 RepositoryError
+func LoadPackageIndex(repos []*Repository, arch string) (*PackageIndex, error) {
+	states := make(map[string]*aptlyState)
 	defer func() {
-		// on any interruption, unlock the mirror
-		err = context.ReOpenDatabase()
-		if err == nil {
-			repo.MarkAsIdle()
-			collectionFactory.RemoteRepoCollection().Update(repo)
+		for _, state := range states {
+			state.Close()
 		}
 	}()
 
-	repo.MarkAsUpdating()
-	err = collectionFactory.RemoteRepoCollection().Update(repo)
-	if err != nil {
-		log.Logger.Errorf("unable to update: %s", err)
-	}
-
-	err = context.CloseDatabase()
-	if err != nil {
-		log.Logger.Errorf("unable to update: %s", err)
-	}
-
-	context.GoContextHandleSignals()
-
-	count := len(queue)
-	context.Progress().Printf("Download queue: %d items (%s)\n", count, utils.HumanBytes(downloadSize))
-
-	// Download from the queue
-	context.Progress().InitBar(downloadSize, true, aptly.BarMirrorUpdateDownloadPackages)
-
-	downloadQueue := make(chan int)
-
-	var (
-		errors  []string
-		errLock sync.Mutex
-	)
-
-	pushError := func(err error) {
-		errLock.Lock()
-		errors = append(errors, err.Error())
-		errLock.Unlock()
-	}
-
-	go func() {
-		for idx := range queue {
-			select {
-			case downloadQueue <- idx:
-			case <-context.Done():
-				return
-			}
+	index := NewPackageIndex()
+	var lastErr error
+	var warnings Warnings
+	loaded := 0
+	for _, repo := range repos {
+		if !repo.HasArch(arch) {
+			log.Logger.Debugf("skip repository %s, %s not in %s", repo.Name, arch, strings.Join(repo.Architectures, ", "))
+			continue
 		}
-		close(downloadQueue)
-	}()
-
-	var wg sync.WaitGroup
-
-	for i := 0; i < context.Config().DownloadConcurrency; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for {
-				select {
-				case idx, ok := <-downloadQueue:
-					if !ok {
-						return
-					}
-
-					task := &queue[idx]
-
-					var e error
-
-					// 跳过黑名单
-					if d.DelMap[strings.Split(task.File.Filename, "_")[0]] {
-						continue
-					}
-
-					source := comm.Source{
-						Kind:   "file",
-						Url:    repo.PackageURL(task.File.DownloadURL()).String(),
-						Digest: task.File.Checksums.SHA256,
-					}
-					// 返回 sources 列表，记录 kind, url, hash
-					d.Sources = append(d.Sources, source)
-
-					if e != nil {
-						pushError(e)
-						continue
-					}
-
-					task.Done = true
-
-				case <-context.Done():
-					return
-				}
+		list, err := repo.loadPackages(states, arch)
+		if err != nil {
+			// 签名错误时直接返回，不能回退到 apt download
+			var sigErr *SignatureError
+			if errors.As(err, &sigErr) {
+				return nil, err
 			}
-		}()
-	}
-
-	// Wait for all download goroutines to finish
-	wg.Wait()
-
-	context.Progress().ShutdownBar()
-}
-
-func getVerifier(flags *flag.FlagSet) (pgp.Verifier, error) {
-	context := cmd.GetContext()
-	if cmd.LookupOption(context.Config().GpgDisableVerify, flags, "ignore-signatures") {
-		return nil, nil
-	}
-
-	keyRings := flags.Lookup("keyring").Value.Get().([]string)
-
-	verifier := context.GetVerifier()
-	for _, keyRing := range keyRings {
-		verifier.AddKeyring(keyRing)
+			warnings.Warnf("load repository %s error: %s", repo.Name, err)
+			lastErr = &RepositoryError{Repo: repo.Name, Err: err}
+			continue
+		}
+		index.Merge(repo, list)
+		loaded++
 	}
-
-	err := verifier.InitKeyring()
-	if err != nil {
-		return nil, err
+	if loaded == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no repository for %s", arch)
+		}
+		return nil, lastErr
 	}
-
-	return verifier, nil
+	index.Warnings = warnings
+	return index, nil
 }
 
-// 将从包里获取的版本号格式化成四位数
-func formatVersion(versionStr string) string {
-	// 先尝试直接按点分割，处理常规的版本号格式
-	parts := strings.Split(versionStr, ".")
-
-	var digits []string
-	for _, part := range parts {
-		// 将字符串转换成数字，如果没有报错，说明是纯数字
-		if _, err := strconv.Atoi(part); err == nil {
-			// 大于 1 位数字，去除前导零
-			if len(part) > 1 {
-				digits = append(digits, strings.TrimLeft(part, "0"))
-			} else {
-				digits = append(digits, part)
-			}
-		} else {
-			// 查找并提取非数字部分后的数字
-			re := regexp.MustCompile(`\d+`)
-			match := re.FindString(part)
-			if match != "" {
-				digits = append(digits, strings.TrimLeft(match, "0"))
-			}
+// 加载仓库的包，本地仓库由 ll-pica 自己建立索引，远程仓库按 profile 打开 aptly 状态目录
+func (r *Repository) loadPackages(states map[string]*aptlyState, arch string) (*deb.PackageList, error) {
+	if r.Local() {
+		unlock, err := lockFile(filepath.Join(r.cacheDir(), "lock"))
+		if err != nil {
+			return nil, err
 		}
+		defer unlock()
+		return r.loadLocal(arch)
 	}
 
-	// 确保版本号至少有四个段，不足则用0填充
-	for len(digits) < 4 {
-		digits = append(digits, "0")
+	state, ok := states[r.Profile]
+	if !ok {
+		var err error
+		if state, err = openAptly(r.Profile); err != nil {
+			return nil, fmt.Errorf("open aptly state: %w", err)
+		}
+		states[r.Profile] = state
 	}
-
-	// 截取前四个有效数字段进行格式化
-	formattedVersion := strings.Join(digits[:4], ".")
-	return formattedVersion
+	if err := r.syncMirror(state, arch); err != nil {
+		return nil, err
+	}
+	return r.mirrorPackages(state)
 }
@@ -0,0 +1,291 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pault.ag/go/debian/control"
+	pdeb "pault.ag/go/debian/deb"
+)
+
+// deb 包内的成员名前缀，后缀为压缩格式（.gz .xz .zst 或者无压缩）
+const (
+	debControlMember = "control.tar"
+	debDataMember    = "data.tar"
+)
+
+// 遍历 deb 包(ar 格式)，找到以 prefix 开头的 tar 成员并交给 handler 处理
+func walkDebMember(path, prefix string, handler func(*tar.Reader) error) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	archive, err := pdeb.LoadAr(fd)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", path, err)
+	}
+
+	for {
+		entry, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		if !strings.HasPrefix(entry.Name, prefix) {
+			continue
+		}
+
+		reader, closer, err := entry.Tarfile()
+		if err != nil {
+			return fmt.Errorf("open %s in %s: %w", entry.Name, path, err)
+		}
+		defer closer.Close()
+		return handler(reader)
+	}
+	return fmt.Errorf("%s not found in %s", prefix, path)
+}
+
+// 读取 deb 包中 control.tar 里的 control 文件
+func ReadDebControl(path string) (*control.Paragraph, error) {
+	var paragraph *control.Paragraph
+	err := walkDebMember(path, debControlMember, func(reader *tar.Reader) error {
+		for {
+			hdr, err := reader.Next()
+			if err == io.EOF {
+				return fmt.Errorf("control not found in %s", path)
+			}
+			if err != nil {
+				return err
+			}
+			if filepath.Clean(hdr.Name) != "control" {
+				continue
+			}
+			paragraphReader, err := control.NewParagraphReader(reader, nil)
+			if err != nil {
+				return err
+			}
+			paragraph, err = paragraphReader.Next()
+			return err
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if paragraph == nil {
+		return nil, fmt.Errorf("control of %s is empty", path)
+	}
+	return paragraph, nil
+}
+
+// 维护者脚本
+var maintScripts = []string{"preinst", "postinst", "prerm", "postrm"}
+
+// 读取 deb 包中 control.tar 里的维护者脚本，返回 脚本名 -> 脚本内容
+func ReadDebScripts(path string) (map[string]string, error) {
+	scripts := make(map[string]string)
+	err := walkDebMember(path, debControlMember, func(reader *tar.Reader) error {
+		for {
+			hdr, err := reader.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			name := filepath.Clean(hdr.Name)
+			for _, script := range maintScripts {
+				if name != script {
+					continue
+				}
+				data, err := io.ReadAll(reader)
+				if err != nil {
+					return err
+				}
+				scripts[name] = string(data)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scripts, nil
+}
+
+// 解压 deb 包中 data.tar 的内容到 dst 目录，保留文件权限、软链接和硬链接
+func ExtractDebData(path, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	return walkDebMember(path, debDataMember, func(reader *tar.Reader) error {
+		return extractTar(reader, dst)
+	})
+}
+
+func extractTar(reader *tar.Reader, dst string) error {
+	// 目录权限最后设置，避免只读目录导致后续文件无法写入
+	dirModes := make(map[string]os.FileMode)
+
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := securePath(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		// 目录本身也不能是软链接，否则创建和修改权限时会作用到解压目录之外
+		parent := filepath.Dir(target)
+		if hdr.Typeflag == tar.TypeDir {
+			parent = target
+		}
+		if err := checkSymlinks(dst, parent); err != nil {
+			return err
+		}
+		mode := hdr.FileInfo().Mode()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			dirModes[target] = mode.Perm()
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := writeTarFile(reader, target, mode); err != nil {
+				return err
+			}
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := securePath(dst, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := checkSymlinks(dst, filepath.Dir(source)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		default:
+			// 设备文件、管道等在 deb 包中没有意义，直接跳过
+			continue
+		}
+	}
+
+	for dir, mode := range dirModes {
+		if err := os.Chmod(dir, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTarFile(reader io.Reader, target string, mode os.FileMode) error {
+	// 已存在的只读文件无法直接覆盖，先删除
+	os.Remove(target)
+	fd, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fd, reader); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	// 通过 Chmod 设置权限，不受 umask 影响，并保留 setuid 等特殊位
+	return os.Chmod(target, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+}
+
+// 拼接解压路径，防止 ../ 逃逸出解压目录
+func securePath(dst, name string) (string, error) {
+	target := filepath.Join(dst, filepath.Clean("/"+name))
+	if target != filepath.Clean(dst) && !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+		return "", errors.New("illegal path in archive: " + name)
+	}
+	return target, nil
+}
+
+// 解析 dst 到 path 之间已经存在的软链接，包内的相对软链接（例如 usr/lib64 -> lib）可以使用，
+// 绝对路径或者指向 dst 之外的软链接（例如 usr/lib -> /etc）会写到解压目录之外，返回错误
+func checkSymlinks(dst, path string) error {
+	dst = filepath.Clean(dst)
+	rel, err := filepath.Rel(dst, path)
+	if err != nil || rel == "." {
+		return err
+	}
+	current, link := dst, ""
+	parts := strings.Split(rel, string(os.PathSeparator))
+	for links := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if current == dst {
+				return fmt.Errorf("illegal path in archive: symlink %s points outside", link)
+			}
+			current = filepath.Dir(current)
+			continue
+		}
+		next := filepath.Join(current, part)
+		fi, err := os.Lstat(next)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+		link = strings.TrimPrefix(next, dst+string(os.PathSeparator))
+		if links++; links > 255 {
+			return fmt.Errorf("illegal path in archive: too many levels of symlinks at %s", link)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(target) {
+			return fmt.Errorf("illegal path in archive: symlink %s points to %s", link, target)
+		}
+		// 继续解析软链接指向的路径
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return nil
+}
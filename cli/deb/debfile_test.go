@@ -0,0 +1,263 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarItem struct {
+	hdr  tar.Header
+	data string
+}
+
+func buildTar(items []tarItem, compress bool) []byte {
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gw)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	for _, item := range items {
+		hdr := item.hdr
+		hdr.Size = int64(len(item.data))
+		tw.WriteHeader(&hdr)
+		tw.Write([]byte(item.data))
+	}
+	tw.Close()
+	if gw != nil {
+		gw.Close()
+	}
+	return buf.Bytes()
+}
+
+// 按 ar 格式拼接 deb 包
+func buildDeb(members map[string][]byte, order []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for _, name := range order {
+		data := members[name]
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", name, 0, 0, 0, "100644", len(data))
+		buf.Write(data)
+		if len(data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+const testControl = `Package: demo
+Version: 1:2.3~rc1-4
+Architecture: amd64
+Depends: libc6 (>= 2.28), libfoo1 | libbar1
+Description: demo package
+ long description
+`
+
+func TestReadDebControlAndExtract(t *testing.T) {
+	dir := t.TempDir()
+	control := buildTar([]tarItem{
+		{hdr: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "./control", Typeflag: tar.TypeReg, Mode: 0644}, data: testControl},
+		{hdr: tar.Header{Name: "./postinst", Typeflag: tar.TypeReg, Mode: 0755}, data: "#!/bin/sh\nldconfig\n"},
+	}, true)
+	data := buildTar([]tarItem{
+		{hdr: tar.Header{Name: "./usr/bin/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "./usr/bin/demo", Typeflag: tar.TypeReg, Mode: 0755}, data: "#!/bin/sh\n"},
+		{hdr: tar.Header{Name: "./usr/bin/demo-link", Typeflag: tar.TypeSymlink, Linkname: "demo"}},
+		{hdr: tar.Header{Name: "./usr/bin/demo-hard", Typeflag: tar.TypeLink, Linkname: "./usr/bin/demo"}},
+		{hdr: tar.Header{Name: "./usr/share/doc/demo/copyright", Typeflag: tar.TypeReg, Mode: 0600}, data: "c"},
+	}, false)
+	debPath := filepath.Join(dir, "demo.deb")
+	err := os.WriteFile(debPath, buildDeb(map[string][]byte{
+		"debian-binary":  []byte("2.0\n"),
+		"control.tar.gz": control,
+		"data.tar":       data,
+	}, []string{"debian-binary", "control.tar.gz", "data.tar"}), 0644)
+	if err != nil {
+		t.Fatalf("Failed test for ReadDebControl! Error: write deb %v", err)
+	}
+
+	info, err := ReadDebControl(debPath)
+	if err != nil {
+		t.Fatalf("Failed test for ReadDebControl! Error: %v", err)
+	}
+	if info.Values["Package"] != "demo" || info.Values["Version"] != "1:2.3~rc1-4" {
+		t.Errorf("Failed test for ReadDebControl! Error: unexpected control %+v", info.Values)
+	}
+
+	scripts, err := ReadDebScripts(debPath)
+	if err != nil || scripts["postinst"] != "#!/bin/sh\nldconfig\n" || len(scripts) != 1 {
+		t.Errorf("Failed test for ReadDebScripts! Error: %v %v", scripts, err)
+	}
+
+	dst := filepath.Join(dir, "demo")
+	if err := ExtractDebData(debPath, dst); err != nil {
+		t.Fatalf("Failed test for ExtractDebData! Error: %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "usr/bin/demo")); err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("Failed test for ExtractDebData! Error: mode of demo %v %v", fi, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "usr/share/doc/demo/copyright")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Failed test for ExtractDebData! Error: mode of copyright %v %v", fi, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "usr/bin/demo-link")); err != nil || link != "demo" {
+		t.Errorf("Failed test for ExtractDebData! Error: symlink %s %v", link, err)
+	}
+	a, _ := os.Stat(filepath.Join(dst, "usr/bin/demo"))
+	b, err := os.Stat(filepath.Join(dst, "usr/bin/demo-hard"))
+	if err != nil || !os.SameFile(a, b) {
+		t.Errorf("Failed test for ExtractDebData! Error: hardlink %v", err)
+	}
+}
+
+func TestSecurePath(t *testing.T) {
+	if p, err := securePath("/tmp/dst", "../../etc/passwd"); err != nil || p != "/tmp/dst/etc/passwd" {
+		t.Errorf("Failed test for securePath! Error: %s %v", p, err)
+	}
+}
+
+var testDataExtractSymlink = []struct {
+	name  string
+	items []tarItem
+}{
+	// 通过软链接的父目录写入文件
+	{"file", []tarItem{
+		{hdr: tar.Header{Name: "./usr/lib", Typeflag: tar.TypeSymlink, Linkname: "%s"}},
+		{hdr: tar.Header{Name: "./usr/lib/x", Typeflag: tar.TypeReg, Mode: 0644}, data: "x"},
+	}},
+	// 目录条目本身是软链接，设置权限时会修改外部目录
+	{"dir", []tarItem{
+		{hdr: tar.Header{Name: "./usr/lib", Typeflag: tar.TypeSymlink, Linkname: "%s"}},
+		{hdr: tar.Header{Name: "./usr/lib/", Typeflag: tar.TypeDir, Mode: 0700}},
+	}},
+	// 硬链接的源路径经过软链接
+	{"hardlink", []tarItem{
+		{hdr: tar.Header{Name: "./usr/lib", Typeflag: tar.TypeSymlink, Linkname: "%s"}},
+		{hdr: tar.Header{Name: "./usr/share/x", Typeflag: tar.TypeLink, Linkname: "./usr/lib/secret"}},
+	}},
+	// 相对软链接指向解压目录之外
+	{"relative", []tarItem{
+		{hdr: tar.Header{Name: "./usr/lib", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+		{hdr: tar.Header{Name: "./usr/lib/x", Typeflag: tar.TypeReg, Mode: 0644}, data: "x"},
+	}},
+	// 包内的软链接再经过指向外部的软链接
+	{"chain", []tarItem{
+		{hdr: tar.Header{Name: "./usr/lib", Typeflag: tar.TypeSymlink, Linkname: "%s"}},
+		{hdr: tar.Header{Name: "./usr/lib64", Typeflag: tar.TypeSymlink, Linkname: "lib"}},
+		{hdr: tar.Header{Name: "./usr/lib64/x", Typeflag: tar.TypeReg, Mode: 0644}, data: "x"},
+	}},
+}
+
+func TestExtractSymlinkParent(t *testing.T) {
+	for _, tds := range testDataExtractSymlink {
+		outside := t.TempDir()
+		os.Chmod(outside, 0755)
+		os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600)
+		var items []tarItem
+		for _, item := range tds.items {
+			if item.hdr.Linkname == "%s" {
+				item.hdr.Linkname = outside
+			}
+			items = append(items, item)
+		}
+		dst := t.TempDir()
+		err := extractTar(tar.NewReader(bytes.NewReader(buildTar(items, false))), dst)
+		if err == nil {
+			t.Errorf("Failed test for extractTar %s! Error: symlinked parent accepted", tds.name)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "x")); err == nil {
+			t.Errorf("Failed test for extractTar %s! Error: file written outside", tds.name)
+		}
+		if fi, err := os.Stat(outside); err != nil || fi.Mode().Perm() == 0700 {
+			t.Errorf("Failed test for extractTar %s! Error: mode of outside changed", tds.name)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "usr/share/x")); err == nil {
+			t.Errorf("Failed test for extractTar %s! Error: outside file linked", tds.name)
+		}
+	}
+}
+
+// 包内的相对软链接，例如 usr/lib64 -> lib
+var testDataSymlinkInTree = []tarItem{
+	{hdr: tar.Header{Name: "./usr/lib/", Typeflag: tar.TypeDir, Mode: 0755}},
+	{hdr: tar.Header{Name: "./usr/lib64", Typeflag: tar.TypeSymlink, Linkname: "lib"}},
+	{hdr: tar.Header{Name: "./usr/lib64/x", Typeflag: tar.TypeReg, Mode: 0644}, data: "x"},
+}
+
+func TestExtractSymlinkInTree(t *testing.T) {
+	items := append(testDataSymlinkInTree,
+		tarItem{hdr: tar.Header{Name: "./usr/lib64/", Typeflag: tar.TypeDir, Mode: 0755}},
+		tarItem{hdr: tar.Header{Name: "./usr/share/y", Typeflag: tar.TypeLink, Linkname: "./usr/lib64/x"}},
+		tarItem{hdr: tar.Header{Name: "./usr/share/lib", Typeflag: tar.TypeSymlink, Linkname: "../lib64/../lib"}},
+		tarItem{hdr: tar.Header{Name: "./usr/share/lib/w", Typeflag: tar.TypeReg, Mode: 0644}, data: "w"},
+	)
+	dst := t.TempDir()
+	if err := extractTar(tar.NewReader(bytes.NewReader(buildTar(items, false))), dst); err != nil {
+		t.Fatalf("Failed test for extractTar! Error: %v", err)
+	}
+	for _, name := range []string{"usr/lib/x", "usr/share/y", "usr/lib/w"} {
+		if fi, err := os.Lstat(filepath.Join(dst, name)); err != nil || !fi.Mode().IsRegular() {
+			t.Errorf("Failed test for extractTar! Error: %s not extracted %v", name, err)
+		}
+	}
+}
+
+// 使用 xz -9e --check=crc32 和 zstd -19 压缩的 testDataSymlinkInTree
+const (
+	testDataTarXz = "/Td6WFoAAAFpIt42BMBygBghARwAAAAAAAAAAKXPrf/gC/8Aal0AFwvLJ4ny7SPeX44s38DMcpY2" +
+		"QCjDSI07Fr44g4LDov7JRl0QNV7D8ZPxJs52pTw7Kh9qQk4yi9SPbg7rGbGudw/IVhZijWzFAMS7" +
+		"h6IZUBYuSUGRg/8k/79my9e7nHzF2Z7gA5uPwV2bgAAAAAq6GX8AAYoBgBgAACCOcr4+MA2LAgAA" +
+		"AAABWVo="
+	testDataTarZst = "KLUv/WQACy0DANKDDBGwuQFAC/SOGlpmd7aknWRBU1436yaqhnWkmDSLVdTg32ckpLxmTHG8d8V9" +
+		"pJg7SB0IEyBQKywuNvudH4MNUC3kCgeaMJqKNAADFxMHFEFKCsBmsEkH5PSODzhg0ACzac0BitQi" +
+		"zA=="
+)
+
+func TestExtractDebDataCompress(t *testing.T) {
+	xzData, _ := base64.StdEncoding.DecodeString(testDataTarXz)
+	zstData, _ := base64.StdEncoding.DecodeString(testDataTarZst)
+	members := map[string][]byte{
+		"data.tar":     buildTar(testDataSymlinkInTree, false),
+		"data.tar.gz":  buildTar(testDataSymlinkInTree, true),
+		"data.tar.xz":  xzData,
+		"data.tar.zst": zstData,
+	}
+	control := buildTar([]tarItem{
+		{hdr: tar.Header{Name: "./control", Typeflag: tar.TypeReg, Mode: 0644}, data: testControl},
+	}, true)
+	for member, data := range members {
+		dir := t.TempDir()
+		debPath := filepath.Join(dir, "demo.deb")
+		os.WriteFile(debPath, buildDeb(map[string][]byte{
+			"debian-binary":  []byte("2.0\n"),
+			"control.tar.gz": control,
+			member:           data,
+		}, []string{"debian-binary", "control.tar.gz", member}), 0644)
+		dst := filepath.Join(dir, "demo")
+		if err := ExtractDebData(debPath, dst); err != nil {
+			t.Errorf("Failed test for ExtractDebData %s! Error: %v", member, err)
+			continue
+		}
+		if data, err := os.ReadFile(filepath.Join(dst, "usr/lib/x")); err != nil || string(data) != "x" {
+			t.Errorf("Failed test for ExtractDebData %s! Error: usr/lib/x %q %v", member, data, err)
+		}
+		if link, err := os.Readlink(filepath.Join(dst, "usr/lib64")); err != nil || link != "lib" {
+			t.Errorf("Failed test for ExtractDebData %s! Error: symlink %s %v", member, link, err)
+		}
+	}
+}
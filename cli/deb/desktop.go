@@ -0,0 +1,149 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"pkg.deepin.com/linglong/pica/tools/fs/desktop"
+	"pkg.deepin.com/linglong/pica/tools/fs/icon"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// desktop 文件中的启动命令
+type DesktopCommand struct {
+	File    string   // 相对于解压目录的路径
+	Group   string   // Desktop Entry 或者 Desktop Action xxx
+	Command []string // 去掉域代码后的启动命令
+	Hidden  bool     // NoDisplay=true 或者 Hidden=true
+}
+
+// 匹配参数开头或者 VAR= 后面的 /usr/ 和 /opt/apps/$appid/files/，参考 https://regex101.com/r/oyo0YX/1
+var appPathPattern = regexp.MustCompile(`^([^/]*=)?(/usr/|/opt/apps/[^/]+/files/)`)
+
+// 查找解压目录中 applications 目录下的 desktop 文件
+func findDesktopFiles(dir string) []string {
+	var files []string
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(path, ".desktop") && strings.Contains(path, "/applications/") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// desktop 文件中一个键的改写
+type DesktopChange struct {
+	File string // 相对于解压目录的路径
+	desktop.Change
+}
+
+// 改写解压目录中的 desktop 文件，Exec、TryExec 和 Icon 不能包含宿主机上的绝对路径，返回每个 desktop 的启动命令和改写过的键
+func rewriteDesktops(dir, appId string, warnings *Warnings) ([]DesktopCommand, []DesktopChange) {
+	var commands []DesktopCommand
+	var changes []DesktopChange
+	for _, file := range findDesktopFiles(dir) {
+		items, fileChanges, err := RewriteDesktopFile(file, appId, warnings)
+		if err != nil {
+			log.Logger.Errorf("rewrite desktop error: %s", err)
+			continue
+		}
+		rel, _ := filepath.Rel(dir, file)
+		for idx := range items {
+			items[idx].File = rel
+		}
+		commands = append(commands, items...)
+		for _, change := range fileChanges {
+			changes = append(changes, DesktopChange{File: rel, Change: change})
+		}
+	}
+	return commands, changes
+}
+
+// 只修改 [Desktop Entry] 和 [Desktop Action xxx] 中的 Exec、TryExec 和 Icon，其他行保持不变
+func RewriteDesktopFile(path, appId string, warnings *Warnings) ([]DesktopCommand, []desktop.Change, error) {
+	file, err := desktop.ParseFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, problem := range file.Validate() {
+		log.Logger.Debugf("%s %s", path, problem)
+	}
+
+	changes, problems := file.Rewrite(desktop.RewriteOptions{
+		MapPath: func(arg string) string { return rewriteAppPath(arg, appId) },
+		MapIcon: icon.Name,
+	})
+	for _, problem := range problems {
+		warnings.Warnf("%s %s", path, problem)
+	}
+
+	// 改写后的 Exec 去掉域代码作为启动命令，同一个组中有多个 Exec 时使用最后一个
+	var commands []DesktopCommand
+	hidden := false
+	if entry := file.Entry(); entry != nil {
+		hidden = entry.Bool("NoDisplay") || entry.Bool("Hidden")
+	}
+	for _, group := range file.Groups {
+		if group.Name != desktop.EntryGroup && !strings.HasPrefix(group.Name, desktop.ActionGroupPrefix) {
+			continue
+		}
+		var current *DesktopCommand
+		for _, line := range group.Entries() {
+			if line.Key != "Exec" || line.Locale != "" {
+				continue
+			}
+			args, err := desktop.ParseExec(line.Value)
+			if err != nil {
+				continue
+			}
+			if current == nil {
+				commands = append(commands, DesktopCommand{Group: group.Name, Hidden: hidden})
+				current = &commands[len(commands)-1]
+			}
+			current.Command = desktop.CommandFromExec(args)
+		}
+	}
+
+	if len(changes) == 0 {
+		return commands, nil, nil
+	}
+	if err := file.Save(path); err != nil {
+		return nil, nil, err
+	}
+	return commands, changes, nil
+}
+
+// 选择应用的启动命令，优先使用显示在启动器中的 [Desktop Entry]
+func mainDesktopCommand(commands []DesktopCommand) []string {
+	for _, item := range commands {
+		if item.Group == "Desktop Entry" && !item.Hidden && len(item.Command) > 0 {
+			return item.Command
+		}
+	}
+	for _, item := range commands {
+		if item.Group == "Desktop Entry" && len(item.Command) > 0 {
+			return item.Command
+		}
+	}
+	return nil
+}
+
+// 将 /usr/ 和 /opt/apps/$appid/files/ 开头的路径改写为玲珑应用内的路径
+func rewriteAppPath(arg, appId string) string {
+	return appPathPattern.ReplaceAllString(arg, fmt.Sprintf("${1}/opt/apps/%s/files/", appId))
+}
@@ -0,0 +1,73 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDesktop = `[Desktop Entry]
+Name=Foo
+Name[zh_CN]=福
+Exec=env FOO_HOME=/usr/share/foo /usr/bin/foo %U
+TryExec=/usr/bin/foo
+X-Exec=/usr/bin/other
+Icon=/usr/share/icons/hicolor/scalable/apps/foo.svg
+Actions=new-window;
+
+[Desktop Action new-window]
+Name=New Window
+Exec="/opt/apps/foo/files/bin/foo" --new-window
+
+[X-Custom]
+Exec=/usr/bin/untouched
+`
+
+func TestRewriteDesktopFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "usr/share/applications/foo.desktop")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte(testDesktop), 0644)
+
+	commands, changes := rewriteDesktops(dir, "org.foo", nil)
+	if len(commands) != 2 || commands[0].File != "usr/share/applications/foo.desktop" {
+		t.Fatalf("Failed test for RewriteDesktopFile! Error: %+v", commands)
+	}
+	if ret := strings.Join(mainDesktopCommand(commands), " "); ret != "env FOO_HOME=/opt/apps/org.foo/files/share/foo /opt/apps/org.foo/files/bin/foo" {
+		t.Errorf("Failed test for RewriteDesktopFile! Error: command %s", ret)
+	}
+	if ret := strings.Join(commands[1].Command, " "); ret != "/opt/apps/org.foo/files/bin/foo --new-window" {
+		t.Errorf("Failed test for RewriteDesktopFile! Error: action command %s", ret)
+	}
+	// 记录每个改写过的键的旧值和新值
+	var keys []string
+	for _, change := range changes {
+		keys = append(keys, change.Group+"/"+change.Key)
+	}
+	if ret := strings.Join(keys, ","); ret != "Desktop Entry/Exec,Desktop Entry/TryExec,Desktop Entry/Icon,Desktop Action new-window/Exec" ||
+		changes[0].File != "usr/share/applications/foo.desktop" || changes[0].Old != "env FOO_HOME=/usr/share/foo /usr/bin/foo %U" ||
+		changes[2].New != "foo" {
+		t.Errorf("Failed test for RewriteDesktopFile! Error: changes %+v", changes)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, line := range []string{
+		"Exec=env FOO_HOME=/opt/apps/org.foo/files/share/foo /opt/apps/org.foo/files/bin/foo %U",
+		"TryExec=/opt/apps/org.foo/files/bin/foo",
+		"X-Exec=/usr/bin/other",
+		"Icon=foo",
+		"Name[zh_CN]=福",
+		"Exec=/usr/bin/untouched",
+	} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Errorf("Failed test for RewriteDesktopFile! Error: %s not found in\n%s", line, data)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/tools/cache"
+	"pkg.deepin.com/linglong/pica/tools/download"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 下载 deb 包、Release 和 Contents 使用的下载器，转换前通过 ConfigureDownload 设置代理和镜像
+var downloader, _ = download.New(download.Options{Progress: logProgress})
+
+// 按 runtime 配置设置代理和各个仓库的镜像
+func ConfigureDownload(config *comm.Config) error {
+	options := download.Options{Proxy: config.Proxy, Progress: logProgress}
+	for _, source := range config.AptSources() {
+		if len(source.Mirrors) > 0 {
+			options.Mirrors = append(options.Mirrors, download.Mirror{Source: source.Url, Urls: source.Mirrors})
+		}
+	}
+	d, err := download.New(options)
+	if err != nil {
+		return err
+	}
+	downloader = d
+	// aptly 下载包索引时使用环境变量中的代理
+	if config.Proxy != "" {
+		os.Setenv("http_proxy", config.Proxy)
+		os.Setenv("https_proxy", config.Proxy)
+	}
+	return nil
+}
+
+func logProgress(progress download.Progress) {
+	if progress.Total > 0 {
+		log.Logger.Debugf("download %s %d/%d (%d%%)", progress.Url, progress.Downloaded, progress.Total, progress.Downloaded*100/progress.Total)
+	} else {
+		log.Logger.Debugf("download %s %d", progress.Url, progress.Downloaded)
+	}
+}
+
+// 下载文件，本地路径和 file:// 地址直接复制
+func fetch(url, dst, sha256 string) error {
+	return downloader.Fetch(download.Request{Url: url, Dest: dst, SHA256: sha256})
+}
+
+// 获取 deb 包，全局缓存中存在时直接链接到 dst，否则下载后加入缓存；本地文件不加入缓存。缓存出错时记录到 warnings
+func fetchPackage(url, dst, sha256 string, warnings *Warnings) error {
+	packageCache := cache.New(comm.PackageCachePath())
+	if ok, err := packageCache.Link(sha256, dst); err != nil {
+		warnings.Warnf("use package cache error: %s", err)
+	} else if ok {
+		log.Logger.Debugf("use cached %s for %s", sha256, url)
+		return nil
+	}
+	if err := fetch(url, dst, sha256); err != nil {
+		return err
+	}
+	if strings.HasPrefix(url, "file://") || !strings.Contains(url, "://") {
+		return nil
+	}
+	if _, err := packageCache.Put(dst, sha256, cache.Entry{Name: filepath.Base(dst), Url: url}); err != nil {
+		warnings.Warnf("add %s to package cache error: %s", dst, err)
+	}
+	return nil
+}
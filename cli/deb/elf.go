@@ -0,0 +1,126 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 动态库所在的目录，例如 lib、usr/lib64、usr/lib/x86_64-linux-gnu
+var libraryDirPattern = regexp.MustCompile(`^(usr/)?lib(32|64|x32)?(/[^/]+-linux-[^/]+)?$`)
+
+// 解压目录中 ELF 文件的扫描结果
+type ElfScan struct {
+	Needed   map[string][]string // DT_NEEDED 中的 soname -> 需要它的文件，路径相对于解压目录
+	Provided map[string]bool     // 包内提供的库，包括库文件名和 DT_SONAME
+}
+
+func NewElfScan() *ElfScan {
+	return &ElfScan{
+		Needed:   make(map[string][]string),
+		Provided: make(map[string]bool),
+	}
+}
+
+// 遍历目录中所有的 ELF 文件，收集 DT_NEEDED 和包内提供的库
+func (s *ElfScan) Scan(dir string) {
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		name := entry.Name()
+		if strings.Contains(name, ".so") {
+			s.Provided[name] = true
+		}
+		if !entry.Type().IsRegular() || !isElf(path) {
+			return nil
+		}
+		file, err := elf.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+		rel, _ := filepath.Rel(dir, path)
+		if sonames, err := file.DynString(elf.DT_SONAME); err == nil {
+			for _, soname := range sonames {
+				s.Provided[soname] = true
+			}
+		}
+		needed, err := file.DynString(elf.DT_NEEDED)
+		if err != nil {
+			return nil
+		}
+		for _, soname := range needed {
+			s.Needed[soname] = append(s.Needed[soname], rel)
+		}
+		return nil
+	})
+}
+
+// 包内以及 installed 中都不存在的库，按名称排序
+func (s *ElfScan) Missing(installed map[string]bool) []string {
+	var missing []string
+	for soname := range s.Needed {
+		if !s.Provided[soname] && !installed[soname] {
+			missing = append(missing, soname)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func isElf(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, []byte(elf.ELFMAG))
+}
+
+// 根文件系统中动态库目录下的库文件名，用于检查 base 和 runtime 中已经存在的库
+func LibrarySonames(root string) map[string]bool {
+	sonames := make(map[string]bool)
+	if root == "" {
+		return sonames
+	}
+	for _, dir := range []string{"lib", "lib32", "lib64", "usr/lib", "usr/lib32", "usr/lib64"} {
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if libraryDirPattern.MatchString(dir + "/" + name) {
+				// 多架构目录，例如 usr/lib/x86_64-linux-gnu
+				sub, _ := os.ReadDir(filepath.Join(root, dir, name))
+				for _, item := range sub {
+					if strings.Contains(item.Name(), ".so") {
+						sonames[item.Name()] = true
+					}
+				}
+				continue
+			}
+			if strings.Contains(name, ".so") {
+				sonames[name] = true
+			}
+		}
+	}
+	return sonames
+}
@@ -0,0 +1,91 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"compress/gzip"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestElfScan(t *testing.T) {
+	file, err := elf.Open("/bin/ls")
+	if err != nil {
+		t.Skip("no dynamic /bin/ls")
+	}
+	needed, _ := file.DynString(elf.DT_NEEDED)
+	file.Close()
+	if len(needed) == 0 {
+		t.Skip("no dynamic /bin/ls")
+	}
+
+	dir := t.TempDir()
+	data, _ := os.ReadFile("/bin/ls")
+	os.MkdirAll(filepath.Join(dir, "usr/bin"), 0755)
+	os.WriteFile(filepath.Join(dir, "usr/bin/ls"), data, 0755)
+	// 包内自带第一个库
+	os.MkdirAll(filepath.Join(dir, "usr/lib"), 0755)
+	os.WriteFile(filepath.Join(dir, "usr/lib", needed[0]), nil, 0644)
+
+	scan := NewElfScan()
+	scan.Scan(dir)
+	if files := scan.Needed[needed[0]]; len(files) != 1 || files[0] != "usr/bin/ls" {
+		t.Errorf("Failed test for ElfScan! Error: needed %+v", scan.Needed)
+	}
+	missing := scan.Missing(nil)
+	if len(missing) != len(needed)-1 {
+		t.Errorf("Failed test for ElfScan! Error: missing %v, needed %v", missing, needed)
+	}
+	if len(scan.Missing(map[string]bool{needed[len(needed)-1]: true})) != len(needed)-2 && len(needed) > 1 {
+		t.Errorf("Failed test for ElfScan! Error: installed library is missing")
+	}
+}
+
+const testRelease = `Origin: Deepin
+Codename: beige
+MD5Sum:
+ 0123 100 main/Contents-amd64.gz
+SHA256:
+ aaaa 100 main/Contents-amd64.gz
+ bbbb 200 main/Contents-arm64.gz
+ cccc 300 main/Contents-udeb-amd64.gz
+ dddd 400 non-free/Contents-amd64.gz
+`
+
+const testContents = `usr/lib/x86_64-linux-gnu/libfoo.so.1    libs/libfoo1
+usr/lib/x86_64-linux-gnu/libbar.so.2    libs/libbar2,oldlibs/libbar2-compat
+usr/share/doc/libfoo.so.1    doc/foo-doc
+usr/lib/my app/libfoo.so.1    libs/weird
+lib/libbaz.so.3 libs/libbaz3
+`
+
+func TestContentsIndex(t *testing.T) {
+	files := contentsFromRelease(testRelease, "amd64")
+	if len(files) != 2 || files[0].Path != "main/Contents-amd64.gz" || files[0].SHA256 != "aaaa" || files[1].Path != "non-free/Contents-amd64.gz" {
+		t.Errorf("Failed test for contentsFromRelease! Error: %+v", files)
+	}
+
+	path := filepath.Join(t.TempDir(), "Contents-amd64.gz")
+	fd, _ := os.Create(path)
+	writer := gzip.NewWriter(fd)
+	writer.Write([]byte(testContents))
+	writer.Close()
+	fd.Close()
+
+	ret, err := LookupContents([]string{path}, map[string]bool{"libfoo.so.1": true, "libbar.so.2": true, "libbaz.so.3": true, "libnone.so": true})
+	if err != nil {
+		t.Fatalf("Failed test for LookupContents! Error: %s", err)
+	}
+	for soname, want := range map[string]string{"libfoo.so.1": "libfoo1", "libbar.so.2": "libbar2,libbar2-compat", "libbaz.so.3": "libbaz3", "libnone.so": ""} {
+		if got := strings.Join(ret[soname], ","); got != want {
+			t.Errorf("Failed test for LookupContents! Error: %s got %s, expect %s", soname, got, want)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/cli/linglong"
+	pfs "pkg.deepin.com/linglong/pica/tools/fs"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 组内包之间满足的依赖
+const SkipReasonGroup = "group"
+
+// package.yaml 中 id 相同的一组 deb 包，合并为一个玲珑应用，例如 foo、foo-data、foo-plugins
+type DebGroup struct {
+	Id          string
+	Debs        []*Deb // 第一个为主包，版本号、描述等信息取自主包
+	PackageKind string
+	Command     []string
+	Sources     []comm.Source
+	Build       []string
+	Skipped     []SkippedDepend   // 解析依赖时跳过的包以及原因
+	Providers   []ProviderChoice  // 虚包选择的提供者
+	Unsatisfied []string          // 无法满足的依赖关系
+	Conflicts   []FileConflict    // 组内包之间内容不同的同名文件
+	Packages    []string          // 从仓库获取的依赖包
+	Origins     map[string]string // 依赖包来自的仓库
+	Depends     []LockedPackage   // 从仓库获取的依赖包的锁定信息
+	Lock        *Lock             // 上次转换的锁定文件，没有时为 nil
+	Update      LockUpdate        // 不使用锁定版本、重新解析的包
+	Replayed    bool              // 依赖取自锁定文件，没有重新解析
+	Libraries   []MissingLibrary  // ELF 文件需要但是包内、base、runtime 和依赖中都没有的库
+	Extra       []string          // 根据缺失的库补充的依赖包
+	Warnings    Warnings          // 解析依赖等步骤中需要检查的警告
+}
+
+// 缺失的库以及 Contents 索引中提供它的包
+type MissingLibrary struct {
+	Soname   string
+	NeededBy []string
+	Packages []string
+}
+
+// 组内多个包中存在的同名文件，后面的包覆盖前面的包
+type FileConflict struct {
+	Path     string
+	Packages []string
+}
+
+// 按 id 将 deb 包分组，保持 package.yaml 中的顺序
+func GroupDebs(debs []Deb) []*DebGroup {
+	var groups []*DebGroup
+	index := make(map[string]*DebGroup)
+	for idx := range debs {
+		group, ok := index[debs[idx].Id]
+		if !ok {
+			group = &DebGroup{Id: debs[idx].Id}
+			index[debs[idx].Id] = group
+			groups = append(groups, group)
+		}
+		group.Debs = append(group.Debs, &debs[idx])
+	}
+	return groups
+}
+
+// 主包
+func (g *DebGroup) Main() *Deb {
+	return g.Debs[0]
+}
+
+// 组内所有包的名称
+func (g *DebGroup) Names() []string {
+	var names []string
+	for _, d := range g.Debs {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// 依赖解析的选项
+type ResolveOptions struct {
+	WithDeps  bool              // 是否递归解析依赖树
+	Options   int               // aptly 的 DependencyOptions
+	Providers map[string]string // 虚包的首选提供者
+	Installed []InstalledSet    // base 和 runtime 中安装的包，为 nil 时通过 LoadInstalled 获取
+}
+
+// 合并组内所有包的依赖一起解析，组内包之间的依赖不再获取。无法满足的依赖记录在 Unsatisfied 中，
+// 仓库加载失败时返回错误
+func (g *DebGroup) ResolveDepends(archive Archive, options ResolveOptions) error {
+	main := g.Main()
+	// 组内包本身的 sources，补充依赖后会重新解析
+	g.Sources = nil
+	g.Packages = nil
+	g.Origins = nil
+	g.Depends = nil
+	g.Replayed = false
+	for _, d := range g.Debs {
+		g.Sources = append(g.Sources, d.Sources...)
+	}
+
+	fields := []string{strings.Join(g.Extra, ", ")}
+	members := NewPackageIndex()
+	for _, d := range g.Debs {
+		fields = append(fields, d.PreDepends, d.Depends)
+		stanza := deb.Stanza{
+			"Package":      d.Package,
+			"Version":      d.DebVersion,
+			"Architecture": d.Architecture,
+		}
+		if d.Provides != "" {
+			stanza["Provides"] = d.Provides
+		}
+		members.Add(deb.NewPackageFromControlFile(stanza))
+	}
+
+	// 可能存在依赖为空的情况
+	if strings.TrimSpace(strings.Join(fields, "")) == "" {
+		return nil
+	}
+
+	if main.Architecture == "" || main.Name == "" {
+		return fmt.Errorf("arch or package name is empty")
+	}
+
+	// 锁定文件中已经包含了所有依赖时直接使用，不访问仓库
+	if g.replayLock() {
+		log.Logger.Infof("%s: use %d depends from %s", g.Id, len(g.Depends), LockFile)
+		return nil
+	}
+
+	index, err := archive.PackageIndex(main.Architecture)
+	if err != nil {
+		return err
+	}
+	// 加载索引时跳过的仓库，索引可能被多个应用共用，每个应用都记录
+	g.Warnings.add(index.Warnings...)
+	// 部分更新时其他包保持锁定的版本，索引可能被多个应用共用，在副本中添加锁定的包
+	if g.Lock != nil && !g.Update.All {
+		index = index.Clone()
+		g.Lock.pinDepends(index, g.Update)
+	}
+
+	resolver := NewResolver(main.Architecture, index)
+	resolver.WithDeps = options.WithDeps
+	resolver.Options = options.Options
+	for _, item := range skipPackage {
+		resolver.Skip[item] = true
+	}
+	for virtual, name := range options.Providers {
+		resolver.Providers[virtual] = name
+	}
+	// 过滤掉组内的包以及 base 和 runtime 中安装过的包
+	installed := options.Installed
+	if installed == nil {
+		installed = LoadInstalled([]string{main.Architecture})[main.Architecture]
+	}
+	resolver.Installed = append([]InstalledSet{{Name: SkipReasonGroup, Index: members}}, installed...)
+
+	res := resolver.Resolve(fields...)
+	g.Skipped = res.Skipped
+	g.Unsatisfied = res.Unsatisfiable
+	g.Providers = res.Providers
+	for _, item := range res.Skipped {
+		log.Logger.Debugf("skip %s by %s (%s)", item.Relation, item.Package, item.Reason)
+	}
+	for _, item := range res.Providers {
+		if item.Preferred {
+			log.Logger.Infof("virtual package %s provided by %s (preferred)", item.Virtual, item.Package)
+		} else if preferred, ok := options.Providers[item.Virtual]; ok {
+			g.Warnings.Warnf("preferred provider %s of %s not found, use %s, candidates: %s", preferred, item.Virtual, item.Package, strings.Join(item.Candidates, ", "))
+		} else {
+			log.Logger.Infof("virtual package %s provided by %s, candidates: %s", item.Virtual, item.Package, strings.Join(item.Candidates, ", "))
+		}
+	}
+	for _, item := range res.Unsatisfiable {
+		log.Logger.Warnf("%s unsatisfiable depend: %s", g.Id, item)
+	}
+
+	for _, p := range res.Packages {
+		locked := index.Origin(p).Locked(p)
+		log.Logger.Debugf("%s %s from %s", p.Name, p.Version, locked.Origin)
+		g.addDepend(locked)
+	}
+	return nil
+}
+
+// 记录依赖包，返回 sources 列表，记录 kind, url, hash 以及包来自的仓库和校验仓库签名的 key
+func (g *DebGroup) addDepend(locked LockedPackage) {
+	if g.Origins == nil {
+		g.Origins = make(map[string]string)
+	}
+	g.Packages = append(g.Packages, locked.Name)
+	g.Origins[locked.Name] = locked.Origin
+	g.Depends = append(g.Depends, locked)
+	// 本地仓库的包可以复制到应用的 sources 目录，构建时与组内的包一起安装
+	if local, ok := strings.CutPrefix(locked.Url, "file://"); ok && locked.Copy {
+		dst := filepath.Join(filepath.Dir(g.Main().Path), filepath.Base(local))
+		if err := fetchPackage(locked.Url, dst, locked.SHA256, &g.Warnings); err != nil {
+			log.Logger.Errorf("copy %s error: %s", local, err)
+		}
+		return
+	}
+	g.Sources = append(g.Sources, locked.Source())
+}
+
+// 没有需要更新的包、组内的包与锁定时相同并且补充的依赖都已经锁定时，使用锁定文件中的依赖
+func (g *DebGroup) replayLock() bool {
+	if g.Lock == nil || g.Update.All || len(g.Update.Names) > 0 {
+		return false
+	}
+	if len(g.Lock.Packages) != len(g.Debs) {
+		log.Logger.Infof("%s: packages changed since %s, resolve depends again", g.Id, LockFile)
+		return false
+	}
+	for _, d := range g.Debs {
+		locked := g.Lock.Package(d.Name)
+		if locked == nil || locked.Version != d.DebVersion || locked.SHA256 != d.Hash {
+			log.Logger.Infof("%s: %s %s changed since %s, resolve depends again", g.Id, d.Name, d.DebVersion, LockFile)
+			return false
+		}
+	}
+	for _, name := range g.Extra {
+		if g.Lock.Depend(name) == nil {
+			return false
+		}
+	}
+	for _, locked := range g.Lock.Depends {
+		g.addDepend(locked)
+	}
+	g.Replayed = true
+	return true
+}
+
+// base 和 runtime 中安装的包，本机只能安装本机架构的 base 和 runtime，
+// 转换其他架构时假定对应架构的 base 和 runtime 安装了同样的包，将包的架构改为目标架构
+// 通过 ll-cli 获取 base 和 runtime 中安装的包，返回各架构的索引，批量转换时只需要加载一次。
+// 本机架构同时读取 base 和 runtime 中的库文件名，其他架构的库只能按包名检查
+func LoadInstalled(archs []string) map[string][]InstalledSet {
+	cli := linglong.NewLinglongCli()
+	basePackages := cli.GetBaseInsPack()
+	runtimePackages := cli.GetRuntimeInsPack()
+	var baseLibraries, runtimeLibraries map[string]bool
+	if contains(archs, runtime.GOARCH) {
+		baseLibraries = LibrarySonames(cli.GetBaseFilesDir())
+		runtimeLibraries = LibrarySonames(cli.GetRuntimeFilesDir())
+	}
+	result := make(map[string][]InstalledSet)
+	for _, arch := range archs {
+		base := InstalledSet{Name: SkipReasonBase, Index: installedIndex(basePackages, arch)}
+		runtimeSet := InstalledSet{Name: SkipReasonRuntime, Index: installedIndex(runtimePackages, arch)}
+		if arch == runtime.GOARCH {
+			base.Libraries, runtimeSet.Libraries = baseLibraries, runtimeLibraries
+		}
+		result[arch] = []InstalledSet{base, runtimeSet}
+	}
+	return result
+}
+
+func installedIndex(list *deb.PackageList, arch string) *PackageIndex {
+	if arch == runtime.GOARCH {
+		return NewPackageIndexFromList(list)
+	}
+	index := NewPackageIndex()
+	list.ForEach(func(p *deb.Package) error {
+		stanza := p.Stanza()
+		if stanza["Architecture"] != "all" {
+			stanza["Architecture"] = arch
+		}
+		index.Add(deb.NewPackageFromControlFile(stanza))
+		return nil
+	})
+	return index
+}
+
+// 扫描组内所有包的 ELF 文件，检查 DT_NEEDED 中的库是否存在，缺失的库通过仓库的 Contents 索引查找提供它的包。
+// installed 为目标架构的 base 和 runtime，由 LoadInstalled 获取。add 为 true 时将提供者加入 Extra，需要重新解析依赖
+func (g *DebGroup) ScanLibraries(archive Archive, installed []InstalledSet, add bool) error {
+	scan := NewElfScan()
+	for _, d := range g.Debs {
+		scan.Scan(filepath.Join(filepath.Dir(d.Path), d.Name))
+	}
+
+	libraries := make(map[string]bool)
+	for _, set := range installed {
+		for soname := range set.Libraries {
+			libraries[soname] = true
+		}
+	}
+	missing := scan.Missing(libraries)
+	g.Libraries = nil
+	if len(missing) == 0 {
+		log.Logger.Debugf("%s: all needed libraries found", g.Id)
+		return nil
+	}
+
+	wanted := make(map[string]bool)
+	for _, soname := range missing {
+		wanted[soname] = true
+	}
+	providers, err := archive.LookupLibraries(g.Main().Architecture, wanted)
+	if err != nil {
+		var sigErr *SignatureError
+		if errors.As(err, &sigErr) {
+			return err
+		}
+		g.Warnings.Warnf("lookup contents index error: %s", err)
+	}
+
+	// 已经获取的依赖包或者 base/runtime 中的包提供的库不算缺失
+	satisfied := make(map[string]bool)
+	for _, name := range g.Packages {
+		satisfied[name] = true
+	}
+	for _, item := range g.Skipped {
+		name, _, _ := strings.Cut(item.Package, "=")
+		satisfied[name] = true
+	}
+	for _, set := range installed {
+		for _, name := range set.Index.Names() {
+			satisfied[name] = true
+		}
+	}
+
+	for _, soname := range missing {
+		lib := MissingLibrary{Soname: soname, NeededBy: scan.Needed[soname], Packages: providers[soname]}
+		found := false
+		for _, p := range lib.Packages {
+			if satisfied[p] {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		g.Libraries = append(g.Libraries, lib)
+		if len(lib.Packages) == 0 {
+			log.Logger.Warnf("%s needed by %s not found in repository", soname, strings.Join(lib.NeededBy, ", "))
+			continue
+		}
+		if add {
+			if !contains(g.Extra, lib.Packages[0]) {
+				g.Extra = append(g.Extra, lib.Packages[0])
+			}
+			log.Logger.Infof("%s needed by %s, add %s", soname, strings.Join(lib.NeededBy, ", "), lib.Packages[0])
+		} else {
+			log.Logger.Warnf("%s needed by %s, provided by %s", soname, strings.Join(lib.NeededBy, ", "), strings.Join(lib.Packages, ", "))
+		}
+	}
+	return nil
+}
+
+// 检查组内包解压后的同名文件，内容相同的文件不算冲突
+func (g *DebGroup) CheckConflicts() []FileConflict {
+	type owner struct {
+		name string
+		hash string
+	}
+	owners := make(map[string][]owner)
+	for _, d := range g.Debs {
+		debDirPath := filepath.Join(filepath.Dir(d.Path), d.Name)
+		filepath.WalkDir(debDirPath, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(debDirPath, path)
+			var hash string
+			if entry.Type()&os.ModeSymlink != 0 {
+				target, _ := os.Readlink(path)
+				hash = "link:" + target
+			} else {
+				hash, _ = pfs.GetFileSha256(path)
+			}
+			owners[rel] = append(owners[rel], owner{name: d.Name, hash: hash})
+			return nil
+		})
+	}
+
+	g.Conflicts = nil
+	for path, items := range owners {
+		if len(items) < 2 {
+			continue
+		}
+		conflict := FileConflict{Path: path}
+		same := true
+		for _, item := range items {
+			conflict.Packages = append(conflict.Packages, item.name)
+			if item.hash != items[0].hash {
+				same = false
+			}
+		}
+		if !same {
+			g.Conflicts = append(g.Conflicts, conflict)
+		}
+	}
+	sort.Slice(g.Conflicts, func(i, j int) bool {
+		return g.Conflicts[i].Path < g.Conflicts[j].Path
+	})
+	for _, conflict := range g.Conflicts {
+		log.Logger.Warnf("%s conflicts between %s, use the one from %s", conflict.Path,
+			strings.Join(conflict.Packages, ", "), conflict.Packages[len(conflict.Packages)-1])
+	}
+	return g.Conflicts
+}
+
+// 生成构建脚本，组内的包按顺序移动文件，后面的包覆盖前面包的同名文件
+func (g *DebGroup) GenerateBuildScript() {
+	g.PackageKind = "app"
+	g.Build = append(g.Build, buildScriptBegin()...)
+	for _, d := range g.Debs {
+		d.editScript()
+	}
+	g.Build = append(g.Build, depsScript(len(g.Sources) > 0)...)
+	for _, d := range g.Debs {
+		g.Build = append(g.Build, d.moveScript()...)
+	}
+	for _, d := range g.Debs {
+		g.Build = append(g.Build, d.maintScript()...)
+	}
+	g.Build = append(g.Build, "#>>> auto generate by ll-pica end")
+
+	// 优先使用主包的启动命令
+	for _, d := range g.Debs {
+		if len(d.Command) > 0 {
+			g.Command = d.Command
+			break
+		}
+	}
+	if g.Command == nil {
+		g.Command = []string{""}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aptly-dev/aptly/deb"
+)
+
+func TestGroupDebs(t *testing.T) {
+	groups := GroupDebs([]Deb{
+		{Id: "org.foo", Name: "foo"},
+		{Id: "org.bar", Name: "bar"},
+		{Id: "org.foo", Name: "foo-data"},
+	})
+	if len(groups) != 2 || groups[0].Id != "org.foo" || strings.Join(groups[0].Names(), ",") != "foo,foo-data" {
+		t.Errorf("Failed test for GroupDebs! Error: unexpected groups %+v", groups)
+	}
+}
+
+func TestCheckConflicts(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"foo/usr/bin/foo":                      "foo",
+		"foo/usr/share/doc/foo/copyright":      "same",
+		"foo/usr/share/foo/data":               "old",
+		"foo-data/usr/share/doc/foo/copyright": "same",
+		"foo-data/usr/share/foo/data":          "new",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(data), 0644)
+	}
+
+	group := GroupDebs([]Deb{
+		{Id: "org.foo", Name: "foo", Path: filepath.Join(dir, "foo.deb")},
+		{Id: "org.foo", Name: "foo-data", Path: filepath.Join(dir, "foo-data.deb")},
+	})[0]
+	conflicts := group.CheckConflicts()
+	if len(conflicts) != 1 || conflicts[0].Path != "usr/share/foo/data" || strings.Join(conflicts[0].Packages, ",") != "foo,foo-data" {
+		t.Errorf("Failed test for CheckConflicts! Error: unexpected conflicts %+v", conflicts)
+	}
+}
+
+func TestInstalledIndex(t *testing.T) {
+	target := "arm64"
+	if runtime.GOARCH == target {
+		target = "amd64"
+	}
+	list := deb.NewPackageList()
+	list.Add(deb.NewPackageFromControlFile(deb.Stanza{"Package": "libc6", "Version": "2.36-1", "Architecture": runtime.GOARCH}))
+	list.Add(deb.NewPackageFromControlFile(deb.Stanza{"Package": "tzdata", "Version": "2024a-1", "Architecture": "all"}))
+
+	index := installedIndex(list, target)
+	if len(index.Lookup("libc6", target)) != 1 || len(index.Lookup("libc6", runtime.GOARCH)) != 0 {
+		t.Errorf("Failed test for installedIndex! Error: libc6 not retargeted to %s", target)
+	}
+	if len(index.Lookup("tzdata", target)) != 1 {
+		t.Errorf("Failed test for installedIndex! Error: tzdata not found for %s", target)
+	}
+}
+
+func TestScanLibraries(t *testing.T) {
+	file, err := elf.Open("/bin/ls")
+	if err != nil {
+		t.Skip("no dynamic /bin/ls")
+	}
+	needed, _ := file.DynString(elf.DT_NEEDED)
+	file.Close()
+	if len(needed) < 2 {
+		t.Skip("/bin/ls needs less than 2 libraries")
+	}
+
+	dir := t.TempDir()
+	data, _ := os.ReadFile("/bin/ls")
+	os.MkdirAll(filepath.Join(dir, "demo/usr/bin"), 0755)
+	os.WriteFile(filepath.Join(dir, "demo/usr/bin/ls"), data, 0755)
+
+	// 第一个库在 base 的库目录中，第二个库由 base 中安装的包提供，其他的库需要补充
+	base := NewPackageIndex()
+	base.Add(newTestPackage("libbase", "1.0", "arm64", ""))
+	installed := []InstalledSet{{Name: SkipReasonBase, Index: base, Libraries: map[string]bool{needed[0]: true}}}
+	archive := NewFakeArchive("/srv/repo")
+	archive.Libraries[needed[1]] = []string{"libbase"}
+	for _, soname := range needed[2:] {
+		archive.Libraries[soname] = []string{"libextra"}
+	}
+
+	group := &DebGroup{Id: "org.demo", Debs: []*Deb{{Name: "demo", Path: filepath.Join(dir, "demo.deb"), Architecture: "arm64"}}}
+	if err := group.ScanLibraries(archive, installed, true); err != nil {
+		t.Fatalf("Failed test for ScanLibraries! Error: %v", err)
+	}
+	if len(group.Libraries) != len(needed)-2 {
+		t.Errorf("Failed test for ScanLibraries! Error: missing %+v, needed %v", group.Libraries, needed)
+	}
+	if len(needed) > 2 && strings.Join(group.Extra, ",") != "libextra" {
+		t.Errorf("Failed test for ScanLibraries! Error: extra %v", group.Extra)
+	}
+
+	// 没有 base 时第一个库也缺失
+	group.Extra = nil
+	if err := group.ScanLibraries(archive, nil, false); err != nil || len(group.Libraries) != len(needed) || len(group.Extra) != 0 {
+		t.Errorf("Failed test for ScanLibraries! Error: missing %+v, extra %v, %v", group.Libraries, group.Extra, err)
+	}
+}
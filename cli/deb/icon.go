@@ -0,0 +1,189 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"pkg.deepin.com/linglong/pica/tools/fs/desktop"
+	"pkg.deepin.com/linglong/pica/tools/fs/icon"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// desktop 文件中 Icon 的解析结果，路径都相对于解压目录
+type IconResult struct {
+	Desktop   string
+	Value     string // Icon 的原始值
+	Source    string // 找到的图标文件
+	Installed string // 安装到 hicolor 主题中的路径，已经在 hicolor 中时为空
+	Info      string // 格式和尺寸
+	Error     string // 无法解析的原因
+}
+
+// 构建时会安装到 $PREFIX/share/icons/hicolor 的目录，商店包的 entries 目录会复制到 $PREFIX/share
+var (
+	hicolorPattern        = regexp.MustCompile(`^usr/share/icons/hicolor/`)
+	storeHicolorPattern   = regexp.MustCompile(`^opt/apps/[^/]+/entries/icons/hicolor/`)
+	iconSearchDirsPattern = regexp.MustCompile(`(^|/)(icons|pixmaps)/`)
+)
+
+// 解析解压目录中所有 desktop 文件的 Icon，不在 hicolor 主题中的图标安装到 usr/share/icons/hicolor
+func collectIcons(dir string, fromAppStore bool, warnings *Warnings) []IconResult {
+	var results []IconResult
+	for _, file := range findDesktopFiles(dir) {
+		rel, _ := filepath.Rel(dir, file)
+		entry, err := desktop.ParseFile(file)
+		if err != nil {
+			warnings.Warnf("parse desktop %s error: %s", rel, err)
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, group := range entry.Groups {
+			if group.Name != desktop.EntryGroup && !strings.HasPrefix(group.Name, desktop.ActionGroupPrefix) {
+				continue
+			}
+			for _, line := range group.Entries() {
+				if line.Key != "Icon" || seen[line.Value] {
+					continue
+				}
+				seen[line.Value] = true
+				result := IconResult{Desktop: rel, Value: line.Value}
+				if err := installIcon(dir, fromAppStore, &result, warnings); err != nil {
+					result.Error = err.Error()
+					log.Logger.Warnf("%s: icon %s cannot be resolved: %s", rel, line.Value, err)
+				} else if result.Installed != "" {
+					log.Logger.Infof("%s: icon %s (%s) installed to %s", rel, result.Source, result.Info, result.Installed)
+				} else {
+					log.Logger.Debugf("%s: icon %s found in %s", rel, line.Value, result.Source)
+				}
+				results = append(results, result)
+			}
+		}
+	}
+	return results
+}
+
+// 查找图标文件，识别格式和尺寸后复制到 hicolor 主题目录
+func installIcon(dir string, fromAppStore bool, result *IconResult, warnings *Warnings) error {
+	source, err := resolveIcon(dir, result.Value, fromAppStore)
+	if err != nil {
+		return err
+	}
+	result.Source = source
+	info, err := icon.Detect(filepath.Join(dir, source))
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	result.Info = info.String()
+	if !info.Square() {
+		warnings.Warnf("%s: icon %s is not square (%s)", result.Desktop, source, info)
+	}
+
+	name := icon.Name(result.Value)
+	if (hicolorPattern.MatchString(source) || fromAppStore && storeHicolorPattern.MatchString(source)) &&
+		icon.Name(source) == name {
+		return nil
+	}
+	dest := filepath.Join("usr", icon.HicolorPath(name, info))
+	if _, err := os.Stat(filepath.Join(dir, dest)); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, source))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, dest)), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, dest), data, 0644); err != nil {
+		return err
+	}
+	result.Installed = dest
+	return nil
+}
+
+// Icon 为绝对路径时在解压目录中查找对应的文件，为图标名时在 icons 和 pixmaps 目录中查找，
+// 优先使用 hicolor 中已有的图标，其次是 svg，最后是尺寸最大的位图
+func resolveIcon(dir, value string, fromAppStore bool) (string, error) {
+	if value == "" {
+		return "", fmt.Errorf("empty Icon")
+	}
+	if filepath.IsAbs(value) {
+		path, err := resolveInRoot(dir, value)
+		if err != nil {
+			return "", fmt.Errorf("icon file %s not found in package: %w", value, err)
+		}
+		return path, nil
+	}
+
+	name := icon.Name(value)
+	var best string
+	var bestScore int
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if !iconSearchDirsPattern.MatchString(rel) || icon.Name(rel) != name || filepath.Base(rel) == name {
+			return nil
+		}
+		resolved, err := resolveInRoot(dir, "/"+rel)
+		if err != nil {
+			return nil
+		}
+		info, err := icon.Detect(filepath.Join(dir, resolved))
+		if err != nil {
+			return nil
+		}
+		score := info.Width
+		if info.Format == icon.FormatSVG {
+			score = 1 << 20
+		}
+		if hicolorPattern.MatchString(rel) || fromAppStore && storeHicolorPattern.MatchString(rel) {
+			score += 1 << 21
+		}
+		if score > bestScore {
+			best, bestScore = rel, score
+		}
+		return nil
+	})
+	if best == "" {
+		return "", fmt.Errorf("icon %s not found in package, it may be provided by base or runtime", value)
+	}
+	return best, nil
+}
+
+// 在解压目录中解析路径，绝对路径的符号链接指向解压目录内部，返回相对于解压目录的路径
+func resolveInRoot(dir, path string) (string, error) {
+	for i := 0; i < 16; i++ {
+		full := filepath.Join(dir, path)
+		info, err := os.Lstat(full)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			if !info.Mode().IsRegular() {
+				return "", fmt.Errorf("%s is not a regular file", path)
+			}
+			return strings.TrimPrefix(filepath.Clean(path), "/"), nil
+		}
+		target, err := os.Readlink(full)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = filepath.Clean("/" + target)
+	}
+	return "", fmt.Errorf("too many levels of symbolic links in %s", path)
+}
@@ -0,0 +1,52 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectIcons(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"usr/share/applications/foo.desktop":            "[Desktop Entry]\nName=Foo\nIcon=foo\n[Desktop Action new]\nIcon=/usr/share/pixmaps/bar.xpm\n",
+		"usr/share/applications/baz.desktop":            "[Desktop Entry]\nName=Baz\nIcon=baz\n",
+		"usr/share/applications/qux.desktop":            "[Desktop Entry]\nName=Qux\nIcon=qux\n",
+		"usr/share/pixmaps/bar.xpm":                     "/* XPM */\nstatic char *bar[] = {\n\"32 32 16 1\",\n",
+		"usr/share/pixmaps/foo.xpm":                     "/* XPM */\nstatic char *foo[] = {\n\"16 16 16 1\",\n",
+		"opt/apps/foo/entries/icons/foo.svg":            "<svg xmlns=\"http://www.w3.org/2000/svg\"/>",
+		"usr/share/icons/hicolor/scalable/apps/baz.svg": "<svg/>",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	expect := map[string]IconResult{
+		"foo":                        {Source: "opt/apps/foo/entries/icons/foo.svg", Installed: "usr/share/icons/hicolor/scalable/apps/foo.svg"},
+		"/usr/share/pixmaps/bar.xpm": {Source: "usr/share/pixmaps/bar.xpm", Installed: "usr/share/icons/hicolor/32x32/apps/bar.xpm"},
+		"baz":                        {Source: "usr/share/icons/hicolor/scalable/apps/baz.svg"},
+		"qux":                        {},
+	}
+	results := collectIcons(dir, false, nil)
+	if len(results) != len(expect) {
+		t.Fatalf("Failed test for collectIcons! Error: %+v", results)
+	}
+	for _, ret := range results {
+		want := expect[ret.Value]
+		if ret.Source != want.Source || ret.Installed != want.Installed || (want.Source == "") != (ret.Error != "") {
+			t.Errorf("Failed test for collectIcons! Error: %s got %+v", ret.Value, ret)
+		}
+		if ret.Installed != "" {
+			if _, err := os.Stat(filepath.Join(dir, ret.Installed)); err != nil {
+				t.Errorf("Failed test for collectIcons! Error: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"sort"
+
+	"github.com/aptly-dev/aptly/deb"
+	"pault.ag/go/debian/dependency"
+)
+
+// 软件包索引，按包名和 Provides 建立索引，同名包按仓库优先级和版本从高到低排序
+type PackageIndex struct {
+	packages map[string][]*deb.Package
+	provides map[string][]Provider
+	origins  map[*deb.Package]*Repository // 包来自的仓库，合并多个仓库的索引时设置
+	Warnings Warnings                     // 加载时跳过的仓库
+}
+
+// 提供虚包的软件包
+type Provider struct {
+	Package *deb.Package
+	Version string // 带版本的 Provides，例如 Provides: foo (= 1.0)，不带版本时为空
+}
+
+func NewPackageIndex() *PackageIndex {
+	return &PackageIndex{
+		packages: make(map[string][]*deb.Package),
+		provides: make(map[string][]Provider),
+		origins:  make(map[*deb.Package]*Repository),
+	}
+}
+
+// 从 aptly 的 PackageList 构造索引
+func NewPackageIndexFromList(list *deb.PackageList) *PackageIndex {
+	idx := NewPackageIndex()
+	if list == nil {
+		return idx
+	}
+	list.ForEach(func(p *deb.Package) error {
+		idx.Add(p)
+		return nil
+	})
+	return idx
+}
+
+func (idx *PackageIndex) Add(p *deb.Package) {
+	list := append(idx.packages[p.Name], p)
+	sort.SliceStable(list, func(i, j int) bool {
+		return idx.before(list[i], list[j])
+	})
+	idx.packages[p.Name] = list
+
+	for _, item := range p.Provides {
+		provides, err := dependency.Parse(item)
+		if err != nil {
+			continue
+		}
+		for _, possibility := range provides.GetAllPossibilities() {
+			provider := Provider{Package: p}
+			if possibility.Version != nil && possibility.Version.Operator == "=" {
+				provider.Version = possibility.Version.Number
+			}
+			providers := append(idx.provides[possibility.Name], provider)
+			// 按包名排序，同名包按仓库优先级和版本从高到低排序，保证选择结果稳定
+			sort.SliceStable(providers, func(i, j int) bool {
+				if providers[i].Package.Name != providers[j].Package.Name {
+					return providers[i].Package.Name < providers[j].Package.Name
+				}
+				return idx.before(providers[i].Package, providers[j].Package)
+			})
+			idx.provides[possibility.Name] = providers
+		}
+	}
+}
+
+// 添加来自仓库的包，优先级高的仓库中的包排在前面，与 apt pin 一样不考虑版本高低
+func (idx *PackageIndex) AddFrom(p *deb.Package, repo *Repository) {
+	idx.origins[p] = repo
+	idx.Add(p)
+}
+
+// 合并仓库的包，仓库的包索引需要已经加载
+func (idx *PackageIndex) Merge(repo *Repository, list *deb.PackageList) {
+	if list == nil {
+		return
+	}
+	list.ForEach(func(p *deb.Package) error {
+		idx.AddFrom(p, repo)
+		return nil
+	})
+}
+
+// 复制索引，向复制的索引添加包不影响原来的索引
+func (idx *PackageIndex) Clone() *PackageIndex {
+	clone := NewPackageIndex()
+	for name, list := range idx.packages {
+		clone.packages[name] = append([]*deb.Package(nil), list...)
+	}
+	for name, list := range idx.provides {
+		clone.provides[name] = append([]Provider(nil), list...)
+	}
+	for p, repo := range idx.origins {
+		clone.origins[p] = repo
+	}
+	clone.Warnings = append(Warnings(nil), idx.Warnings...)
+	return clone
+}
+
+// 包来自的仓库，不是通过 AddFrom 添加的包返回 nil
+func (idx *PackageIndex) Origin(p *deb.Package) *Repository {
+	return idx.origins[p]
+}
+
+func (idx *PackageIndex) priority(p *deb.Package) int {
+	if repo := idx.origins[p]; repo != nil {
+		return repo.Priority
+	}
+	return 0
+}
+
+// a 是否排在 b 前面
+func (idx *PackageIndex) before(a, b *deb.Package) bool {
+	if pa, pb := idx.priority(a), idx.priority(b); pa != pb {
+		return pa > pb
+	}
+	return deb.CompareVersions(a.Version, b.Version) > 0
+}
+
+func (idx *PackageIndex) Len() int {
+	count := 0
+	for _, list := range idx.packages {
+		count += len(list)
+	}
+	return count
+}
+
+// 返回架构匹配的同名包，arch 为空时不限制架构
+func (idx *PackageIndex) Lookup(name, arch string) []*deb.Package {
+	var result []*deb.Package
+	for _, p := range idx.packages[name] {
+		if arch == "" || p.MatchesArchitecture(arch) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// 返回架构匹配的虚包提供者
+func (idx *PackageIndex) Providers(name, arch string) []Provider {
+	var result []Provider
+	for _, provider := range idx.provides[name] {
+		if arch == "" || provider.Package.MatchesArchitecture(arch) {
+			result = append(result, provider)
+		}
+	}
+	return result
+}
+
+// 返回索引中所有的包名
+func (idx *PackageIndex) Names() []string {
+	names := make([]string, 0, len(idx.packages))
+	for name := range idx.packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 返回满足查询条件的包，按仓库优先级和版本从高到低排序
+func (idx *PackageIndex) Query(q deb.PackageQuery) []*deb.Package {
+	var result []*deb.Package
+	for _, name := range idx.Names() {
+		for _, p := range idx.packages[name] {
+			if q.Matches(p) {
+				result = append(result, p)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return idx.before(result[i], result[j])
+	})
+	return result
+}
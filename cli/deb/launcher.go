@@ -0,0 +1,234 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 启动脚本的类型
+const (
+	ScriptShell  = "shell"
+	ScriptPython = "python"
+	ScriptPerl   = "perl"
+)
+
+// 超过该大小的文件不当作脚本处理
+const maxScriptSize = 1 << 20
+
+// 启动脚本中改写的一行
+type LineChange struct {
+	Line int
+	Old  string
+	New  string
+}
+
+// 改写过的启动脚本，路径相对于解压目录
+type ScriptRewrite struct {
+	File    string
+	Kind    string
+	Changes []LineChange
+}
+
+// 解释器名称对应的脚本类型，例如 python3.11 取 python
+var interpreters = map[string]string{
+	"sh": ScriptShell, "bash": ScriptShell, "dash": ScriptShell, "zsh": ScriptShell, "ksh": ScriptShell,
+	"python": ScriptPython, "perl": ScriptPerl,
+}
+
+// 没有 shebang 时按后缀判断
+var scriptSuffixes = map[string]string{
+	".sh": ScriptShell, ".bash": ScriptShell, ".py": ScriptPython, ".pl": ScriptPerl, ".pm": ScriptPerl,
+}
+
+// 没有 shebang 和后缀的可执行文本文件，按内容中的特征判断
+var scriptSniffers = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{ScriptShell, regexp.MustCompile(`(?m)^\s*(exec|export|cd|\.|source|case|if \[|for \w+ in)\s|"\$@"|\$\{?0\}?`)},
+	{ScriptPython, regexp.MustCompile(`(?m)^(import \w+|from [\w.]+ import |def \w+\(|if __name__ == )`)},
+	{ScriptPerl, regexp.MustCompile(`(?m)^(use strict;|use warnings;|my [$@%]\w+)`)},
+}
+
+// 脚本中的 /usr/ 和 /opt/apps/ 路径，前面不能是路径中的字符，例如 /foo/usr/bin 不匹配
+var scriptPathPattern = regexp.MustCompile(`(^|[^A-Za-z0-9._/-])(/(?:usr|opt/apps)/[A-Za-z0-9._+@%/-]*)`)
+
+// 多个包共用的目录，目录存在于包中不代表下面的文件都来自这个包
+var sharedDirs = map[string]bool{
+	"applications": true, "icons": true, "pixmaps": true, "doc": true, "man": true, "info": true,
+	"locale": true, "mime": true, "metainfo": true, "appdata": true, "glib-2.0": true, "dbus-1": true,
+	"fonts": true, "themes": true, "lintian": true, "bash-completion": true, "zsh": true, "menu": true,
+	"help": true, "polkit-1": true, "systemd": true, "pkgconfig": true, "locales": true, "python3": true,
+	"python3-dist-packages": true, "perl5": true, "perl": true,
+}
+
+// 根据 shebang、后缀和内容判断文件是否为启动脚本，返回脚本类型
+func DetectScript(path string, data []byte, mode fs.FileMode) string {
+	if bytes.HasPrefix(data, []byte("\x7fELF")) || bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return ""
+	}
+	if bytes.HasPrefix(data, []byte("#!")) {
+		line, _, _ := strings.Cut(string(data[2:]), "\n")
+		return shebangKind(line)
+	}
+	if kind, ok := scriptSuffixes[filepath.Ext(path)]; ok {
+		return kind
+	}
+	if mode&0111 == 0 || filepath.Ext(path) != "" {
+		return ""
+	}
+	for _, sniffer := range scriptSniffers {
+		if sniffer.pattern.Match(data) {
+			return sniffer.kind
+		}
+	}
+	return ""
+}
+
+// 解析 shebang 中的解释器，支持 /usr/bin/env python3 的写法
+func shebangKind(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	name := filepath.Base(fields[0])
+	if name == "env" {
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				name = field
+				break
+			}
+		}
+	}
+	name = strings.TrimRight(name, "0123456789.")
+	return interpreters[name]
+}
+
+// 检测解压目录中的启动脚本，将包内文件的路径改写为玲珑应用内的路径
+func rewriteScripts(dir, name, appId string) []ScriptRewrite {
+	// 旧的应用目录，商店包内部的目录名可能和包名不同
+	oldNames := map[string]bool{name: true}
+	if entries, err := os.ReadDir(filepath.Join(dir, "opt/apps")); err == nil {
+		for _, entry := range entries {
+			oldNames[entry.Name()] = true
+		}
+	}
+	delete(oldNames, appId)
+
+	var rewrites []ScriptRewrite
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() > maxScriptSize {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		// desktop 文件单独处理
+		if strings.HasSuffix(rel, ".desktop") || strings.HasPrefix(rel, "DEBIAN/") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		kind := DetectScript(rel, data, info.Mode())
+		if kind == "" {
+			return nil
+		}
+		content, changes := rewriteScriptContent(string(data), func(p string) string {
+			return mapScriptPath(dir, p, appId, oldNames)
+		})
+		if len(changes) == 0 {
+			return nil
+		}
+		if err := os.WriteFile(path, []byte(content), info.Mode().Perm()); err != nil {
+			log.Logger.Errorf("rewrite script %s error: %s", rel, err)
+			return nil
+		}
+		rewrites = append(rewrites, ScriptRewrite{File: rel, Kind: kind, Changes: changes})
+		return nil
+	})
+
+	for _, item := range rewrites {
+		log.Logger.Infof("rewrite %s script %s: %d lines changed", item.Kind, item.File, len(item.Changes))
+		for _, change := range item.Changes {
+			log.Logger.Infof("  %d: - %s", change.Line, strings.TrimSpace(change.Old))
+			log.Logger.Infof("  %d: + %s", change.Line, strings.TrimSpace(change.New))
+		}
+	}
+	return rewrites
+}
+
+// 逐行替换脚本中的路径，返回新的内容和改变的行
+func rewriteScriptContent(content string, mapPath func(string) string) (string, []LineChange) {
+	var changes []LineChange
+	lines := strings.Split(content, "\n")
+	for idx, line := range lines {
+		newLine := scriptPathPattern.ReplaceAllStringFunc(line, func(match string) string {
+			sub := scriptPathPattern.FindStringSubmatch(match)
+			return sub[1] + mapPath(sub[2])
+		})
+		if newLine != line {
+			changes = append(changes, LineChange{Line: idx + 1, Old: line, New: newLine})
+			lines[idx] = newLine
+		}
+	}
+	return strings.Join(lines, "\n"), changes
+}
+
+// 旧的应用目录 /opt/apps/<包名>/ 改为 /opt/apps/<玲珑id>/，包内存在的 /usr/ 路径改为 /opt/apps/<玲珑id>/files/，其他路径不变
+func mapScriptPath(dir, path, appId string, oldNames map[string]bool) string {
+	if rest, ok := strings.CutPrefix(path, "/opt/apps/"); ok {
+		name, sub, _ := strings.Cut(rest, "/")
+		if oldNames[name] {
+			if sub == "" && !strings.HasSuffix(rest, "/") {
+				return "/opt/apps/" + appId
+			}
+			return "/opt/apps/" + appId + "/" + sub
+		}
+		return path
+	}
+	if inPayload(dir, path) {
+		return "/opt/apps/" + appId + "/files" + strings.TrimPrefix(path, "/usr")
+	}
+	return path
+}
+
+// 路径是否来自包内，文件本身存在，或者属于包内独有的目录，例如 /usr/share/foo/ 下的文件
+func inPayload(dir, path string) bool {
+	clean := filepath.Clean(path)
+	// 目录需要按是否为包内独有的目录判断，例如 /usr/bin 不能改写
+	if info, err := os.Lstat(filepath.Join(dir, clean)); err == nil && !info.IsDir() {
+		return true
+	}
+	parts := strings.Split(strings.TrimPrefix(clean, "/"), "/")
+	if len(parts) < 3 {
+		return false
+	}
+	switch parts[1] {
+	case "lib", "lib64", "lib32", "libexec", "share":
+	default:
+		return false
+	}
+	owned := parts[2]
+	if sharedDirs[owned] || strings.Contains(owned, "-linux-") {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(dir, parts[0], parts[1], owned))
+	return err == nil && info.IsDir()
+}
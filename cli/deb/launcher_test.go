@@ -0,0 +1,74 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testDataDetectScript = []struct {
+	path string
+	data string
+	mode os.FileMode
+	kind string
+}{
+	{"usr/bin/foo", "#!/bin/bash\necho hi\n", 0755, ScriptShell},
+	{"usr/bin/foo", "#!/usr/bin/env -S python3.11 -u\n", 0755, ScriptPython},
+	{"usr/bin/foo", "#! /usr/bin/perl -w\n", 0755, ScriptPerl},
+	{"usr/bin/foo", "#!/usr/bin/node\n", 0755, ""},
+	{"usr/share/foo/run.sh", "cd /usr/share/foo\n", 0644, ScriptShell},
+	{"usr/bin/foo", "export A=1\nexec /usr/share/foo/foo \"$@\"\n", 0755, ScriptShell},
+	{"usr/bin/foo", "import sys\n", 0755, ScriptPython},
+	{"usr/share/foo/README", "export A=1\n", 0644, ""},
+	{"usr/bin/foo", "\x7fELF\x02\x01", 0755, ""},
+}
+
+func TestDetectScript(t *testing.T) {
+	for _, tds := range testDataDetectScript {
+		if ret := DetectScript(tds.path, []byte(tds.data), tds.mode); ret != tds.kind {
+			t.Errorf("Failed test for DetectScript! Error: %q got %s, expect %s", tds.data, ret, tds.kind)
+		}
+	}
+}
+
+func TestRewriteScripts(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+export PATH=/usr/bin:$PATH
+cd /opt/apps/foo/files/lib
+LD_LIBRARY_PATH=/usr/lib/foo:/usr/lib/x86_64-linux-gnu/other exec /usr/share/foo/bin/foo "$@"
+/usr/bin/python3 /usr/share/foo/main.py
+`
+	files := map[string]string{
+		"usr/bin/foo":             script,
+		"usr/share/foo/bin/foo":   "\x7fELF",
+		"usr/share/foo/main.py":   "import os\n",
+		"usr/lib/foo/libfoo.so.1": "\x7fELF",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0755)
+	}
+
+	rewrites := rewriteScripts(dir, "foo", "org.foo")
+	if len(rewrites) != 1 || rewrites[0].File != "usr/bin/foo" || len(rewrites[0].Changes) != 3 {
+		t.Fatalf("Failed test for rewriteScripts! Error: %+v", rewrites)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "usr/bin/foo"))
+	expect := `#!/bin/sh
+export PATH=/usr/bin:$PATH
+cd /opt/apps/org.foo/files/lib
+LD_LIBRARY_PATH=/opt/apps/org.foo/files/lib/foo:/usr/lib/x86_64-linux-gnu/other exec /opt/apps/org.foo/files/share/foo/bin/foo "$@"
+/usr/bin/python3 /opt/apps/org.foo/files/share/foo/main.py
+`
+	if string(data) != expect {
+		t.Errorf("Failed test for rewriteScripts! Error:\n%s", strings.TrimSpace(string(data)))
+	}
+}
@@ -0,0 +1,313 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	pfs "pkg.deepin.com/linglong/pica/tools/fs"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 本地仓库的目录，地址为 file:// 或者绝对路径时为本地仓库
+func localRoot(source string) (string, bool) {
+	if strings.HasPrefix(source, "file://") {
+		return filepath.Clean(strings.TrimPrefix(source, "file://")), true
+	}
+	if filepath.IsAbs(source) {
+		return filepath.Clean(source), true
+	}
+	return "", false
+}
+
+// 本地文件的 file:// 地址
+func fileURL(path string) string {
+	return "file://" + filepath.ToSlash(path)
+}
+
+// 是否为本地仓库，本地仓库不使用 aptly，由 ll-pica 自己建立索引
+func (r *Repository) Local() bool {
+	_, ok := localRoot(r.Source)
+	return ok
+}
+
+// 本地仓库存在 dists/<suite> 时为 apt 仓库，否则为存放 deb 包的普通目录
+func (r *Repository) flat() bool {
+	root, _ := localRoot(r.Source)
+	if r.Distro == "" {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(root, "dists", r.Distro))
+	return err != nil || !info.IsDir()
+}
+
+// 所有仓库都是本地仓库时不访问网络
+func offline(repos []*Repository) bool {
+	for _, repo := range repos {
+		if !repo.Local() {
+			return false
+		}
+	}
+	return len(repos) > 0
+}
+
+// 加载本地仓库的包索引，普通目录先生成 Packages
+func (r *Repository) loadLocal(arch string) (*deb.PackageList, error) {
+	root, _ := localRoot(r.Source)
+	r.setState(func() { r.root = root })
+	var files []string
+	if r.flat() {
+		packagesPath := filepath.Join(r.cacheDir(), "Packages")
+		if err := GeneratePackages(root, packagesPath); err != nil {
+			return nil, err
+		}
+		files = []string{packagesPath}
+	} else {
+		var err error
+		if files, err = r.localPackagesFiles(arch); err != nil {
+			return nil, err
+		}
+	}
+
+	list := deb.NewPackageList()
+	for _, file := range files {
+		if err := readPackages(file, list); err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+	}
+	return list, nil
+}
+
+// 本地 apt 仓库中对应组件和架构的 Packages，Release 的签名校验通过后按其中的校验值检查
+func (r *Repository) localPackagesFiles(arch string) ([]string, error) {
+	data, err := r.FetchRelease(r.cacheDir())
+	if err != nil {
+		return nil, err
+	}
+	release := string(data)
+	components := r.Components
+	if len(components) == 0 {
+		components = releaseComponents(release)
+	}
+
+	checksums := make(map[string]string)
+	for _, file := range releaseFiles(release) {
+		checksums[file.Path] = file.SHA256
+	}
+	var result []string
+	for _, component := range components {
+		found := false
+		for _, name := range []string{"Packages.gz", "Packages"} {
+			rel := path.Join(component, "binary-"+arch, name)
+			local := filepath.Join(r.root, "dists", r.Distro, filepath.FromSlash(rel))
+			if _, err := os.Stat(local); err != nil {
+				continue
+			}
+			if sum, ok := checksums[rel]; ok {
+				if hash, _ := pfs.GetFileSha256(local); hash != sum {
+					return nil, fmt.Errorf("checksum mismatch for %s", local)
+				}
+			} else if !r.IgnoreSignatures {
+				return nil, fmt.Errorf("%s not listed in Release", local)
+			}
+			result = append(result, local)
+			found = true
+			break
+		}
+		if !found {
+			log.Logger.Warnf("no Packages for %s/%s in %s", component, arch, r.DistURL())
+		}
+	}
+	return result, nil
+}
+
+// Release 中的 Components 字段
+func releaseComponents(release string) []string {
+	for _, line := range strings.Split(release, "\n") {
+		if value, ok := strings.CutPrefix(line, "Components:"); ok {
+			return strings.Fields(value)
+		}
+	}
+	return nil
+}
+
+// 读取 Packages 文件，支持 gzip 压缩
+func readPackages(file string, list *deb.PackageList) error {
+	fd, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	var reader io.Reader = fd
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(fd)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	controlReader := deb.NewControlFileReader(reader, false, false)
+	for {
+		stanza, err := controlReader.ReadStanza()
+		if err != nil {
+			return err
+		}
+		if stanza == nil {
+			return nil
+		}
+		// 同一个包出现多次时保留第一个
+		list.Add(deb.NewPackageFromControlFile(stanza))
+	}
+}
+
+// 目录下所有的 deb 包，按相对路径排序
+func findDebs(root string) ([]string, error) {
+	var debs []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".deb") {
+			rel, _ := filepath.Rel(root, path)
+			debs = append(debs, rel)
+		}
+		return nil
+	})
+	sort.Strings(debs)
+	return debs, err
+}
+
+// 为存放 deb 包的目录生成 Packages，与 dpkg-scanpackages 一样 Filename 为相对于目录的路径
+func GeneratePackages(root, dst string) error {
+	debs, err := findDebs(root)
+	if err != nil {
+		return err
+	}
+	if len(debs) == 0 {
+		return fmt.Errorf("no deb found in %s", root)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer := bufio.NewWriter(out)
+
+	for _, rel := range debs {
+		file := filepath.Join(root, rel)
+		paragraph, err := ReadDebControl(file)
+		if err != nil {
+			log.Logger.Warnf("skip %s: %s", file, err)
+			continue
+		}
+		size, md5sum, sha256sum, err := debChecksums(file)
+		if err != nil {
+			return err
+		}
+		for _, key := range paragraph.Order {
+			// 多行的值续行以空格开头，空行写为 " ."
+			lines := strings.Split(strings.TrimRight(paragraph.Values[key], "\n"), "\n")
+			for idx := 1; idx < len(lines); idx++ {
+				if strings.TrimSpace(lines[idx]) == "" {
+					lines[idx] = "."
+				}
+			}
+			fmt.Fprintf(writer, "%s: %s\n", key, strings.Join(lines, "\n "))
+		}
+		fmt.Fprintf(writer, "Filename: %s\nSize: %d\nMD5sum: %s\nSHA256: %s\n\n", filepath.ToSlash(rel), size, md5sum, sha256sum)
+	}
+	return writer.Flush()
+}
+
+func debChecksums(file string) (int64, string, string, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer fd.Close()
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), fd)
+	if err != nil {
+		return 0, "", "", err
+	}
+	return size, hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}
+
+// 为存放 deb 包的目录生成 Contents-<arch>.gz，格式与仓库中的 Contents 相同
+func GenerateContents(root, arch, dst string) error {
+	debs, err := findDebs(root)
+	if err != nil {
+		return err
+	}
+	owners := make(map[string][]string)
+	for _, rel := range debs {
+		file := filepath.Join(root, rel)
+		paragraph, err := ReadDebControl(file)
+		if err != nil {
+			continue
+		}
+		if debArch := paragraph.Values["Architecture"]; debArch != arch && debArch != "all" {
+			continue
+		}
+		name := paragraph.Values["Package"]
+		walkDebMember(file, debDataMember, func(reader *tar.Reader) error {
+			for {
+				hdr, err := reader.Next()
+				if err != nil {
+					return nil
+				}
+				if hdr.Typeflag == tar.TypeDir {
+					continue
+				}
+				item := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+				if !contains(owners[item], name) {
+					owners[item] = append(owners[item], name)
+				}
+			}
+		})
+	}
+
+	paths := make([]string, 0, len(owners))
+	for item := range owners {
+		paths = append(paths, item)
+	}
+	sort.Strings(paths)
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	for _, item := range paths {
+		fmt.Fprintf(gz, "%s %s\n", item, strings.Join(owners[item], ","))
+	}
+	return gz.Close()
+}
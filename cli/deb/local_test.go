@@ -0,0 +1,76 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+)
+
+func writeTestDeb(t *testing.T, path, name, depends, lib string) {
+	control := fmt.Sprintf("Package: %s\nVersion: 1.0\nArchitecture: amd64\nDescription: %s\n long description\n .\n second paragraph\n", name, name)
+	if depends != "" {
+		control += "Depends: " + depends + "\n"
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	err := os.WriteFile(path, buildDeb(map[string][]byte{
+		"debian-binary": []byte("2.0\n"),
+		"control.tar.gz": buildTar([]tarItem{
+			{hdr: tar.Header{Name: "./control", Typeflag: tar.TypeReg, Mode: 0644}, data: control},
+		}, true),
+		"data.tar": buildTar([]tarItem{
+			{hdr: tar.Header{Name: "./usr/lib/x86_64-linux-gnu/" + lib, Typeflag: tar.TypeReg, Mode: 0644}, data: "lib"},
+		}, false),
+	}, []string{"debian-binary", "control.tar.gz", "data.tar"}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalRepository(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	writeTestDeb(t, filepath.Join(dir, "pool/demo_1.0_amd64.deb"), "demo", "libfoo1", "libdemo.so.1")
+	writeTestDeb(t, filepath.Join(dir, "libfoo1_1.0_amd64.deb"), "libfoo1", "", "libfoo.so.1")
+
+	repo := NewRepository(comm.AptSource{Url: dir})
+	if !repo.Local() || !repo.flat() {
+		t.Fatalf("Failed test for Local! Error: %s is not a local directory", dir)
+	}
+	index, err := LoadPackageIndex([]*Repository{repo}, "amd64")
+	if err != nil {
+		t.Fatalf("Failed test for LoadPackageIndex! Error: %s", err)
+	}
+	resolver := NewResolver("amd64", index)
+	resolver.WithDeps = true
+	res := resolver.Resolve("demo")
+	if ret := strings.Join(packageNames(res.Packages), ","); ret != "demo=1.0,libfoo1=1.0" {
+		t.Fatalf("Failed test for Resolve! Error: got %s", ret)
+	}
+	demo := index.Lookup("demo", "amd64")[0]
+	if url := repo.PackageURL(demo); url != "file://"+filepath.Join(dir, "pool/demo_1.0_amd64.deb") {
+		t.Errorf("Failed test for PackageURL! Error: got %s", url)
+	}
+	if desc := demo.Stanza()["Description"]; !strings.Contains(desc, "second paragraph") {
+		t.Errorf("Failed test for GeneratePackages! Error: description %q", desc)
+	}
+
+	files, err := FetchContentsIndex(repo, "amd64")
+	if err != nil {
+		t.Fatalf("Failed test for FetchContentsIndex! Error: %s", err)
+	}
+	providers, err := LookupContents(files, map[string]bool{"libfoo.so.1": true})
+	if err != nil || strings.Join(providers["libfoo.so.1"], ",") != "libfoo1" {
+		t.Errorf("Failed test for LookupContents! Error: %v %v", providers, err)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/aptly-dev/aptly/deb"
+	"gopkg.in/yaml.v3"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+)
+
+// 与 linglong.yaml 放在同一目录的锁定文件
+const LockFile = "pica.lock"
+
+// 锁定文件记录上次转换使用的包，再次转换时使用同样的包
+type Lock struct {
+	Base     LockedLayer     `yaml:"base"`
+	Runtime  LockedLayer     `yaml:"runtime"`
+	Packages []LockedPackage `yaml:"packages"` // 组内的 deb 包
+	Depends  []LockedPackage `yaml:"depends"`  // 从仓库获取的依赖包
+}
+
+// 过滤依赖时使用的 base 或者 runtime
+type LockedLayer struct {
+	Id      string `yaml:"id"`
+	Version string `yaml:"version"`
+	Commit  string `yaml:"commit"`
+}
+
+type LockedPackage struct {
+	Name         string `yaml:"name"`
+	Version      string `yaml:"version"`
+	Architecture string `yaml:"architecture"`
+	Url          string `yaml:"url"`
+	SHA256       string `yaml:"sha256"`
+	Origin       string `yaml:"origin,omitempty"`    // 包来自的仓库
+	SignedBy     string `yaml:"signed_by,omitempty"` // 校验仓库签名的 key
+	Copy         bool   `yaml:"copy,omitempty"`      // 复制到应用的 sources 目录，不写入 linglong.yaml
+}
+
+// 需要更新的包，All 为 true 时忽略锁定文件重新解析所有包
+type LockUpdate struct {
+	All   bool
+	Names []string
+}
+
+func (u LockUpdate) Has(name string) bool {
+	return u.All || contains(u.Names, name)
+}
+
+// 读取锁定文件，文件不存在时返回 nil
+func ReadLock(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{}
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return lock, nil
+}
+
+func (l *Lock) Write(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte("# generated by ll-pica, do not edit\n"), data...), 0644)
+}
+
+// 按 config 中的 base 和 runtime 记录当前安装的 commit
+func NewLock(config *comm.Config) *Lock {
+	return &Lock{
+		Base: LockedLayer{
+			Id:      config.BaseId,
+			Version: config.BaseVersion,
+			Commit:  comm.GetBaseRuntimeCommit(config.BaseId, config.BaseVersion),
+		},
+		Runtime: LockedLayer{
+			Id:      config.Id,
+			Version: config.Version,
+			Commit:  comm.GetBaseRuntimeCommit(config.Id, config.Version),
+		},
+	}
+}
+
+func findLocked(list []LockedPackage, name string) *LockedPackage {
+	for idx := range list {
+		if list[idx].Name == name {
+			return &list[idx]
+		}
+	}
+	return nil
+}
+
+// 锁定的组内包
+func (l *Lock) Package(name string) *LockedPackage {
+	if l == nil {
+		return nil
+	}
+	return findLocked(l.Packages, name)
+}
+
+// 锁定的依赖包
+func (l *Lock) Depend(name string) *LockedPackage {
+	if l == nil {
+		return nil
+	}
+	return findLocked(l.Depends, name)
+}
+
+// 与锁定文件中的 base 和 runtime 不同时返回提示
+func (l *Lock) CheckLayers(current *Lock) []string {
+	var result []string
+	for _, item := range []struct{ locked, current LockedLayer }{
+		{l.Base, current.Base},
+		{l.Runtime, current.Runtime},
+	} {
+		if item.locked.Commit != item.current.Commit {
+			result = append(result, fmt.Sprintf("%s/%s locked at %s, installed %s",
+				item.locked.Id, item.locked.Version, item.locked.Commit, item.current.Commit))
+		}
+	}
+	return result
+}
+
+// 锁定的依赖转换为 sources
+func (p *LockedPackage) Source() comm.Source {
+	return comm.Source{
+		Kind:     "file",
+		Url:      p.Url,
+		Digest:   p.SHA256,
+		SignedBy: p.SignedBy,
+		Origin:   p.Origin,
+	}
+}
+
+// 部分更新时不更新的依赖作为优先级最高的仓库加入索引，约束允许时保持锁定的版本
+func (l *Lock) pinDepends(index *PackageIndex, update LockUpdate) {
+	repo := &Repository{Name: LockFile, Priority: math.MaxInt, urls: make(map[*deb.Package]*LockedPackage)}
+	for idx := range l.Depends {
+		item := &l.Depends[idx]
+		if update.Has(item.Name) {
+			continue
+		}
+		p := deb.NewPackageFromControlFile(deb.Stanza{
+			"Package":      item.Name,
+			"Version":      item.Version,
+			"Architecture": item.Architecture,
+		})
+		// 依赖关系取自仓库中的同版本包，仓库中已经没有时不再递归
+		for _, candidate := range index.Lookup(item.Name, item.Architecture) {
+			if candidate.Version == item.Version {
+				p = deb.NewPackageFromControlFile(candidate.Stanza())
+				break
+			}
+		}
+		repo.urls[p] = item
+		index.AddFrom(p, repo)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testDataLockPin = []struct {
+	depends  string
+	update   LockUpdate
+	packages string
+	url      string
+}{
+	// 保持锁定的版本
+	{"libfoo", LockUpdate{}, "libfoo=1.0", "https://example.com/libfoo_1.0.deb"},
+	// 更新指定的包
+	{"libfoo", LockUpdate{Names: []string{"libfoo"}}, "libfoo=2.0", ""},
+	// 锁定的版本不满足约束时使用仓库中的版本
+	{"libfoo (>= 2.0)", LockUpdate{}, "libfoo=2.0", ""},
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFile)
+	lock := &Lock{
+		Base: LockedLayer{Id: "org.deepin.base", Version: "25.2.1", Commit: "abc"},
+		Depends: []LockedPackage{
+			{Name: "libfoo", Version: "1.0", Architecture: "amd64", Url: "https://example.com/libfoo_1.0.deb", SHA256: "1234", Origin: "vendor"},
+		},
+	}
+	if err := lock.Write(path); err != nil {
+		t.Fatalf("Failed test for Write! Error: %s", err)
+	}
+	lock, err := ReadLock(path)
+	if err != nil || lock.Base.Commit != "abc" || lock.Depend("libfoo") == nil {
+		t.Fatalf("Failed test for ReadLock! Error: %v, %+v", err, lock)
+	}
+	if lock, err := ReadLock(filepath.Join(t.TempDir(), LockFile)); lock != nil || err != nil {
+		t.Errorf("Failed test for ReadLock! Error: missing file returns %v, %v", lock, err)
+	}
+
+	for _, tds := range testDataLockPin {
+		index := newTestIndex(
+			newTestPackage("libfoo", "1.0", "amd64", ""),
+			newTestPackage("libfoo", "2.0", "amd64", ""),
+		)
+		lock.pinDepends(index, tds.update)
+		res := NewResolver("amd64", index).Resolve(tds.depends)
+		if ret := strings.Join(packageNames(res.Packages), ","); ret != tds.packages {
+			t.Errorf("Failed test for pinDepends! Error: %s got %s, want %s", tds.depends, ret, tds.packages)
+			continue
+		}
+		if repo := index.Origin(res.Packages[0]); tds.url != "" && (repo == nil || repo.Locked(res.Packages[0]).Url != tds.url) {
+			t.Errorf("Failed test for pinDepends! Error: %s not locked", tds.depends)
+		}
+	}
+}
+
+var testDataReplayLock = []struct {
+	name    string
+	version string
+	hash    string
+	replay  bool
+}{
+	{"demo", "1.0", "abcd", true},
+	// 组内的包与锁定时不同时重新解析依赖
+	{"demo", "1.1", "abcd", false},
+	{"demo", "1.0", "ef01", false},
+	{"demo-data", "1.0", "abcd", false},
+}
+
+func TestReplayLock(t *testing.T) {
+	lock := &Lock{
+		Packages: []LockedPackage{{Name: "demo", Version: "1.0", Architecture: "amd64", SHA256: "abcd"}},
+		Depends:  []LockedPackage{{Name: "libfoo", Version: "1.0", Architecture: "amd64", Url: "https://example.com/libfoo_1.0.deb", SHA256: "1234"}},
+	}
+	for _, tds := range testDataReplayLock {
+		g := &DebGroup{Id: "org.demo.app", Lock: lock, Debs: []*Deb{{Name: tds.name, DebVersion: tds.version, Hash: tds.hash}}}
+		if ret := g.replayLock(); ret != tds.replay || (ret && (len(g.Depends) != 1 || !g.Replayed)) {
+			t.Errorf("Failed test for replayLock! Error: %s %s %s got %v, want %v", tds.name, tds.version, tds.hash, ret, tds.replay)
+		}
+	}
+}
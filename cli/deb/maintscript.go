@@ -0,0 +1,352 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 维护者脚本中动作的分类
+const (
+	ActionTranslatable = "translatable" // 可以翻译为构建脚本中等价的步骤
+	ActionIgnorable    = "ignorable"    // 玲珑应用中不需要执行
+	ActionUnsupported  = "unsupported"  // 无法翻译，需要打包者检查
+)
+
+// 维护者脚本中的一条命令以及分析结果
+type ScriptAction struct {
+	Script  string   // preinst、postinst、prerm、postrm
+	Line    int      // 命令所在的行号
+	Command string   // 原始命令
+	Kind    string   // 分类
+	Reason  string   // 分类的原因
+	Build   []string // 翻译后的构建步骤
+}
+
+// 控制结构和不影响安装结果的命令
+var ignorableCommands = map[string]string{
+	"if": "", "then": "", "else": "", "elif": "", "fi": "", "case": "", "esac": "",
+	"for": "", "while": "", "until": "", "do": "", "done": "", "{": "", "}": "", "!": "",
+	"set": "shell option", "exit": "shell control", "return": "shell control", "shift": "shell control",
+	"true": "shell control", "false": "shell control", ":": "shell control",
+	"[": "test", "test": "test", "which": "test", "command": "test",
+	"echo": "output", "printf": "output",
+	"dpkg-maintscript-helper": "dpkg database",
+	"dpkg-trigger":            "dpkg database",
+	"update-desktop-database": "handled by linglong",
+	"update-mime-database":    "handled by linglong",
+	"xdg-icon-resource":       "handled by linglong",
+	"xdg-desktop-menu":        "handled by linglong",
+	"systemctl":               "system service",
+	"deb-systemd-helper":      "system service",
+	"deb-systemd-invoke":      "system service",
+	"invoke-rc.d":             "system service",
+	"update-rc.d":             "system service",
+	"db_get":                  "debconf",
+	"db_input":                "debconf",
+	"db_go":                   "debconf",
+	"db_stop":                 "debconf",
+	".":                       "source file",
+}
+
+// 分析维护者脚本，对每一条命令分类，可以翻译的命令生成等价的构建步骤
+func AnalyzeMaintScript(script, content string) []ScriptAction {
+	var actions []ScriptAction
+	// update-alternatives 同名的链接只保留优先级最高的
+	type alternative struct {
+		index    int
+		priority int
+	}
+	alternatives := make(map[string]alternative)
+
+	for _, cmd := range splitScript(content) {
+		action := ScriptAction{Script: script, Line: cmd.line, Command: strings.Join(cmd.words, " ")}
+		words := cmd.words
+		// 去掉 if/then 等关键字，分析后面的命令
+		for len(words) > 1 {
+			if reason, ok := ignorableCommands[words[0]]; ok && reason == "" {
+				words = words[1:]
+				continue
+			}
+			break
+		}
+		// case 分支，例如 configure)
+		if strings.HasSuffix(words[0], ")") {
+			words = words[1:]
+			if len(words) == 0 {
+				continue
+			}
+		}
+
+		// 卸载脚本在玲珑应用中不会执行
+		if script == "prerm" || script == "postrm" {
+			action.Kind = ActionIgnorable
+			action.Reason = "removal script"
+			actions = append(actions, action)
+			continue
+		}
+
+		if reason, ok := ignorableCommands[words[0]]; ok {
+			action.Kind = ActionIgnorable
+			action.Reason = reason
+			if reason == "" {
+				action.Reason = "shell syntax"
+			}
+		} else if strings.Contains(words[0], "=") && !strings.HasPrefix(words[0], "=") {
+			action.Kind = ActionIgnorable
+			action.Reason = "variable assignment"
+		} else {
+			build, err := translateCommand(words)
+			if err != nil {
+				action.Kind = ActionUnsupported
+				action.Reason = err.Error()
+			} else {
+				action.Kind = ActionTranslatable
+				action.Build = build
+			}
+		}
+
+		if action.Kind == ActionTranslatable && words[0] == "update-alternatives" {
+			name := words[3]
+			priority, _ := strconv.Atoi(words[5])
+			if prev, ok := alternatives[name]; ok && prev.priority >= priority {
+				action.Kind = ActionIgnorable
+				action.Reason = "lower priority alternative"
+				action.Build = nil
+			} else {
+				if ok {
+					actions[prev.index].Kind = ActionIgnorable
+					actions[prev.index].Reason = "lower priority alternative"
+					actions[prev.index].Build = nil
+				}
+				alternatives[name] = alternative{index: len(actions), priority: priority}
+			}
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// 翻译可以在构建时执行的命令
+func translateCommand(words []string) ([]string, error) {
+	args := words[1:]
+	switch words[0] {
+	case "ln":
+		var flags, paths []string
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") {
+				flags = append(flags, arg)
+			} else {
+				paths = append(paths, arg)
+			}
+		}
+		if !strings.Contains(strings.Join(flags, ""), "s") || len(paths) != 2 {
+			return nil, fmt.Errorf("only ln -s with target and link name is supported")
+		}
+		target := paths[0]
+		if filepath.IsAbs(target) {
+			mapped, err := mapInstallPath(target)
+			if err != nil {
+				return nil, err
+			}
+			target = mapped
+		}
+		link, err := mapInstallPath(paths[1])
+		if err != nil {
+			return nil, err
+		}
+		return []string{
+			fmt.Sprintf("mkdir -p %s", filepath.Dir(link)),
+			fmt.Sprintf("ln -sf %s %s", target, link),
+		}, nil
+	case "mkdir":
+		var dirs []string
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") {
+				continue
+			}
+			dir, err := mapInstallPath(arg)
+			if err != nil {
+				return nil, err
+			}
+			dirs = append(dirs, dir)
+		}
+		if len(dirs) == 0 {
+			return nil, fmt.Errorf("mkdir without directory")
+		}
+		return []string{fmt.Sprintf("mkdir -p %s", strings.Join(dirs, " "))}, nil
+	case "update-alternatives":
+		// update-alternatives --install <link> <name> <path> <priority>
+		if len(args) < 5 || args[0] != "--install" {
+			return nil, fmt.Errorf("only update-alternatives --install is supported")
+		}
+		if _, err := strconv.Atoi(args[4]); err != nil {
+			return nil, fmt.Errorf("invalid priority %s", args[4])
+		}
+		link, err := mapInstallPath(args[1])
+		if err != nil {
+			return nil, err
+		}
+		target, err := mapInstallPath(args[3])
+		if err != nil {
+			return nil, err
+		}
+		return []string{
+			fmt.Sprintf("mkdir -p %s", filepath.Dir(link)),
+			fmt.Sprintf("ln -sf %s %s", target, link),
+		}, nil
+	case "glib-compile-schemas":
+		dir := "$PREFIX/share/glib-2.0/schemas"
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				mapped, err := mapInstallPath(arg)
+				if err != nil {
+					return nil, err
+				}
+				dir = mapped
+			}
+		}
+		return []string{fmt.Sprintf("glib-compile-schemas %s || true", dir)}, nil
+	case "gtk-update-icon-cache":
+		dir := "$PREFIX/share/icons/hicolor"
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				mapped, err := mapInstallPath(arg)
+				if err != nil {
+					return nil, err
+				}
+				dir = mapped
+			}
+		}
+		return []string{fmt.Sprintf("gtk-update-icon-cache -f -t %s || true", dir)}, nil
+	case "ldconfig":
+		// 只为应用自带的库创建 soname 链接，不更新系统缓存
+		return []string{"ldconfig -n $PREFIX/lib $PREFIX/lib/$TRIPLET 2>/dev/null || true"}, nil
+	}
+	return nil, fmt.Errorf("command %s is not supported", words[0])
+}
+
+// 将安装后的绝对路径映射到 $PREFIX 下，应用目录以外的路径无法映射
+func mapInstallPath(path string) (string, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "${DPKG_ROOT}"), "$DPKG_ROOT")
+	if strings.Contains(path, "$") || strings.Contains(path, "`") {
+		return "", fmt.Errorf("path %s uses shell variable", path)
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path %s is not absolute", path)
+	}
+	path = filepath.Clean(path)
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	switch {
+	case parts[0] == "usr":
+		return filepath.Join(append([]string{"$PREFIX"}, parts[1:]...)...), nil
+	case parts[0] == "lib" || parts[0] == "bin":
+		return filepath.Join(append([]string{"$PREFIX"}, parts...)...), nil
+	case len(parts) > 3 && parts[0] == "opt" && parts[1] == "apps" && parts[3] == "files":
+		return filepath.Join(append([]string{"$PREFIX"}, parts[4:]...)...), nil
+	case len(parts) > 3 && parts[0] == "opt" && parts[1] == "apps" && parts[3] == "entries":
+		return filepath.Join(append([]string{"$PREFIX", "share"}, parts[4:]...)...), nil
+	}
+	return "", fmt.Errorf("path %s is outside of the application", path)
+}
+
+type scriptCommand struct {
+	line  int
+	words []string
+}
+
+// 按 shell 的语法将脚本拆分为命令，处理引号、注释、续行以及 ; && || 分隔符，重定向会被去掉
+func splitScript(content string) []scriptCommand {
+	var commands []scriptCommand
+	var words []string
+	var word strings.Builder
+	inWord := false
+	redirect := false
+	var quote rune
+	line, start := 1, 1
+
+	endWord := func() {
+		if inWord {
+			// 去掉重定向，例如 >/dev/null、2>&1、> /dev/null
+			w := word.String()
+			if redirect {
+				redirect = false
+			} else if strings.TrimLeft(w, "012&") != w || strings.HasPrefix(w, ">") || strings.HasPrefix(w, "<") {
+				op := strings.TrimLeft(w, "012&")
+				if strings.HasPrefix(op, ">") || strings.HasPrefix(op, "<") {
+					redirect = strings.Trim(op, "<>&") == ""
+				} else {
+					words = append(words, w)
+				}
+			} else {
+				words = append(words, w)
+			}
+		}
+		word.Reset()
+		inWord = false
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, scriptCommand{line: start, words: words})
+		}
+		words = nil
+	}
+
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			} else {
+				if c == '\n' {
+					line++
+				}
+				word.WriteRune(c)
+			}
+			continue
+		}
+		switch {
+		case c == '\\' && i+1 < len(runes) && runes[i+1] == '\n':
+			// 续行
+			i++
+			line++
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '#' && !inWord:
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case c == '\n':
+			endCommand()
+			line++
+			start = line
+		case c == ';' || (c == '&' && i+1 < len(runes) && runes[i+1] == '&') || (c == '|' && i+1 < len(runes) && runes[i+1] == '|'):
+			if c != ';' {
+				i++
+			}
+			endCommand()
+			start = line
+		case c == ' ' || c == '\t':
+			endWord()
+		default:
+			if len(words) == 0 && !inWord {
+				start = line
+			}
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands
+}
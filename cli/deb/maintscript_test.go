@@ -0,0 +1,75 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPostinst = `#!/bin/sh
+set -e
+
+case "$1" in
+    configure)
+        ln -sf /opt/apps/org.foo/files/bin/foo /usr/bin/foo
+        mkdir -p /usr/share/foo/plugins
+        update-alternatives --install /usr/bin/x-www-browser x-www-browser /usr/bin/foo 40
+        update-alternatives --install /usr/bin/x-www-browser x-www-browser /usr/bin/foo-beta 10
+        glib-compile-schemas /usr/share/glib-2.0/schemas >/dev/null 2>&1 || true
+        if [ -x /usr/bin/gtk-update-icon-cache ]; then gtk-update-icon-cache -f -t /usr/share/icons/hicolor; fi
+        ldconfig
+        chown root:root /etc/foo.conf
+        useradd \
+            --system foo
+    ;;
+esac
+
+#DEBHELPER#
+exit 0
+`
+
+var testDataMaintScript = []struct {
+	command string
+	kind    string
+	build   string
+}{
+	{"ln -sf /opt/apps/org.foo/files/bin/foo /usr/bin/foo", ActionTranslatable, "mkdir -p $PREFIX/bin;ln -sf $PREFIX/bin/foo $PREFIX/bin/foo"},
+	{"mkdir -p /usr/share/foo/plugins", ActionTranslatable, "mkdir -p $PREFIX/share/foo/plugins"},
+	{"update-alternatives --install /usr/bin/x-www-browser x-www-browser /usr/bin/foo 40", ActionTranslatable, "mkdir -p $PREFIX/bin;ln -sf $PREFIX/bin/foo $PREFIX/bin/x-www-browser"},
+	{"update-alternatives --install /usr/bin/x-www-browser x-www-browser /usr/bin/foo-beta 10", ActionIgnorable, ""},
+	{"glib-compile-schemas /usr/share/glib-2.0/schemas", ActionTranslatable, "glib-compile-schemas $PREFIX/share/glib-2.0/schemas || true"},
+	{"then gtk-update-icon-cache -f -t /usr/share/icons/hicolor", ActionTranslatable, "gtk-update-icon-cache -f -t $PREFIX/share/icons/hicolor || true"},
+	{"ldconfig", ActionTranslatable, "ldconfig -n $PREFIX/lib $PREFIX/lib/$TRIPLET 2>/dev/null || true"},
+	{"chown root:root /etc/foo.conf", ActionUnsupported, ""},
+	{"useradd --system foo", ActionUnsupported, ""},
+	{"exit 0", ActionIgnorable, ""},
+}
+
+func TestAnalyzeMaintScript(t *testing.T) {
+	actions := make(map[string]ScriptAction)
+	for _, action := range AnalyzeMaintScript("postinst", testPostinst) {
+		actions[action.Command] = action
+	}
+	for _, tds := range testDataMaintScript {
+		action, ok := actions[tds.command]
+		if !ok {
+			t.Errorf("Failed test for AnalyzeMaintScript! Error: %s not found in %+v", tds.command, actions)
+			continue
+		}
+		if action.Kind != tds.kind || strings.Join(action.Build, ";") != tds.build {
+			t.Errorf("Failed test for AnalyzeMaintScript! Error: %s got %s %v", tds.command, action.Kind, action.Build)
+		}
+	}
+
+	// 卸载脚本中的动作全部忽略
+	for _, action := range AnalyzeMaintScript("prerm", "rm -f /usr/bin/foo\n") {
+		if action.Kind != ActionIgnorable {
+			t.Errorf("Failed test for AnalyzeMaintScript! Error: prerm %+v", action)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"pkg.deepin.com/linglong/pica/tools/fs"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 同时下载的依赖包数量
+const prefetchWorkers = 4
+
+// 依赖包在 ll-builder 下载目录中的文件名，与 ll-builder 获取 file 类型的 sources 时相同
+func prefetchName(locked LockedPackage) string {
+	return path.Base(locked.Url)
+}
+
+// 将解析出的依赖包下载到 dir 并按 SHA256 校验，已经存在且校验值一致时跳过。
+// dir 为 linglong/sources 时 ll-builder 构建时不再下载，可以离线构建
+func (g *DebGroup) Prefetch(dir string) error {
+	var items []LockedPackage
+	for _, locked := range g.Depends {
+		// 复制到应用 sources 目录的本地包不需要下载
+		if locked.Copy && strings.HasPrefix(locked.Url, "file://") {
+			continue
+		}
+		items = append(items, locked)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	queue := make(chan int)
+	errs := make([]error, len(items))
+	// 每个包单独记录警告，全部下载完成后按顺序合并
+	warnings := make([]Warnings, len(items))
+	var wg sync.WaitGroup
+	for i := 0; i < prefetchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				errs[idx] = prefetchDeb(items[idx], filepath.Join(dir, prefetchName(items[idx])), &warnings[idx])
+			}
+		}()
+	}
+	for idx := range items {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+	for _, items := range warnings {
+		g.Warnings = append(g.Warnings, items...)
+	}
+
+	// 所有包都尝试下载后报告第一个错误，其余的写入日志
+	var first error
+	for idx, err := range errs {
+		if err == nil {
+			continue
+		}
+		log.Logger.Errorf("prefetch %s error: %s", items[idx].Name, err)
+		if first == nil {
+			first = fmt.Errorf("prefetch %s: %w", items[idx].Name, err)
+		}
+	}
+	if first == nil {
+		log.Logger.Infof("%s: %d depends prefetched into %s", g.Id, len(items), dir)
+	}
+	return first
+}
+
+// 下载单个依赖包，下载时校验 SHA256
+func prefetchDeb(locked LockedPackage, dst string, warnings *Warnings) error {
+	if hash, err := fs.GetFileSha256(dst); err == nil && (locked.SHA256 == "" || hash == locked.SHA256) {
+		log.Logger.Debugf("use prefetched %s", dst)
+		return nil
+	}
+	return fetchPackage(locked.Url, dst, locked.SHA256, warnings)
+}
@@ -0,0 +1,52 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pkg.deepin.com/linglong/pica/tools/download"
+	pfs "pkg.deepin.com/linglong/pica/tools/fs"
+)
+
+func TestPrefetch(t *testing.T) {
+	repo := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "linglong/sources")
+	var depends []LockedPackage
+	for _, name := range []string{"libfoo", "libbar", "libbaz"} {
+		file := filepath.Join(repo, name+"_1.0_amd64.deb")
+		os.WriteFile(file, []byte(name), 0644)
+		depends = append(depends, LockedPackage{Name: name, Url: fileURL(file), SHA256: fmt.Sprintf("%x", sha256.Sum256([]byte(name)))})
+	}
+
+	group := &DebGroup{Id: "org.demo", Depends: depends}
+	if err := group.Prefetch(dir); err != nil {
+		t.Fatalf("Failed test for Prefetch! Error: %s", err)
+	}
+	for _, item := range depends {
+		if data, err := os.ReadFile(filepath.Join(dir, prefetchName(item))); err != nil || string(data) != item.Name {
+			t.Errorf("Failed test for Prefetch! Error: %s not prefetched", item.Name)
+		}
+	}
+
+	// 校验值不一致时返回错误，不保留文件
+	bad := filepath.Join(repo, "libbad_1.0_amd64.deb")
+	os.WriteFile(bad, []byte("changed"), 0644)
+	group.Depends = append(group.Depends, LockedPackage{Name: "libbad", Url: fileURL(bad), SHA256: "0000"})
+	var checksumErr *download.ChecksumError
+	if err := group.Prefetch(dir); !errors.As(err, &checksumErr) {
+		t.Errorf("Failed test for Prefetch! Error: want ChecksumError, got %v", err)
+	}
+	if ret, _ := pfs.CheckFileExits(filepath.Join(dir, "libbad_1.0_amd64.deb")); ret {
+		t.Errorf("Failed test for Prefetch! Error: file with bad checksum kept")
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+)
+
+// apt 仓库的地址、优先级以及签名校验的配置
+type Repository struct {
+	Name             string // aptly 镜像的名称
+	Source           string
+	Distro           string
+	Components       []string
+	Architectures    []string
+	Priority         int
+	Keyrings         []string      // 信任的 keyring，为空时使用 apt 信任的 keyring
+	IgnoreSignatures bool          // 显式关闭签名校验
+	SignedBy         string        // 校验 Release 签名的 key，校验通过后设置
+	Copy             bool          // 本地仓库的包复制到应用的 sources 目录，不写入 linglong.yaml
+	Profile          string        // aptly 状态目录的名称
+	TTL              time.Duration // 包索引的有效期
+	refresh          bool          // 忽略有效期，重新检查仓库
+
+	remote *deb.RemoteRepo                 // 加载索引后的 aptly 镜像，用于生成包的下载地址
+	urls   map[*deb.Package]*LockedPackage // 锁定文件中的包，不来自 aptly 镜像
+	root   string                          // 加载索引后的本地仓库目录
+}
+
+func NewRepository(source comm.AptSource) *Repository {
+	repo := &Repository{
+		Name:             source.Name,
+		Source:           source.Url,
+		Distro:           source.Suite,
+		Components:       source.Components,
+		Architectures:    source.Architectures,
+		Priority:         source.Priority,
+		Keyrings:         source.Keyrings,
+		IgnoreSignatures: source.IgnoreSignatures,
+		Copy:             source.Copy,
+	}
+	if repo.Name == "" {
+		repo.Name = cacheName(repo.DistURL())
+	}
+	if repo.Priority == 0 {
+		repo.Priority = comm.DefaultAptPriority
+	}
+	repo.Profile = comm.DefaultProfile
+	repo.TTL = comm.DefaultIndexTTL
+	return repo
+}
+
+// 按优先级从高到低排列的仓库，优先级相同时保持配置中的顺序
+func NewRepositories(config *comm.Config) Repositories {
+	var repos Repositories
+	names := make(map[string]int)
+	for _, source := range config.AptSources() {
+		repo := NewRepository(source)
+		repo.Profile = config.AptlyProfile()
+		repo.TTL = config.IndexMaxAge()
+		// 镜像名称不能重复
+		if count := names[repo.Name]; count > 0 {
+			repo.Name = fmt.Sprintf("%s-%d", repo.Name, count)
+		}
+		names[repo.Name]++
+		repos = append(repos, repo)
+	}
+	sort.SliceStable(repos, func(i, j int) bool {
+		return repos[i].Priority > repos[j].Priority
+	})
+	return repos
+}
+
+// 仓库的 dists 目录，本地仓库为 file:// 地址
+func (r *Repository) DistURL() string {
+	source := r.Source
+	if root, ok := localRoot(source); ok {
+		source = fileURL(root)
+	}
+	return strings.TrimSuffix(source, "/") + "/dists/" + r.Distro
+}
+
+// 仓库是否包含指定架构
+func (r *Repository) HasArch(arch string) bool {
+	source := comm.AptSource{Architectures: r.Architectures}
+	return source.HasArch(arch)
+}
+
+// 加载索引时设置的签名 key、aptly 镜像和本地仓库目录，批量转换时多个应用共用同一个仓库，读写时加锁
+var stateLock sync.RWMutex
+
+func (r *Repository) setState(fn func()) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	fn()
+}
+
+func (r *Repository) signedBy() string {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	return r.SignedBy
+}
+
+// 包在仓库中的下载地址
+func (r *Repository) PackageURL(p *deb.Package) string {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	return r.packageURL(p)
+}
+
+func (r *Repository) packageURL(p *deb.Package) string {
+	if locked, ok := r.urls[p]; ok {
+		return locked.Url
+	}
+	path := p.Files()[0].DownloadURL()
+	if r.root != "" {
+		return fileURL(filepath.Join(r.root, filepath.FromSlash(path)))
+	}
+	// 从 aptly 镜像加载的包使用同步时记录的 Filename
+	if filename := p.Extra()["Filename"]; filename != "" {
+		path = filename
+	}
+	return r.remote.PackageURL(path).String()
+}
+
+// 包的锁定信息，记录下载地址、校验值以及来自的仓库
+func (r *Repository) Locked(p *deb.Package) LockedPackage {
+	if locked, ok := r.urls[p]; ok {
+		return *locked
+	}
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+	return LockedPackage{
+		Name:         p.Name,
+		Version:      p.Version,
+		Architecture: p.Architecture,
+		Url:          r.packageURL(p),
+		SHA256:       p.Files()[0].Checksums.SHA256,
+		Origin:       r.Name,
+		SignedBy:     r.SignedBy,
+		Copy:         r.Copy,
+	}
+}
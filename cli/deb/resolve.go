@@ -0,0 +1,351 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aptly-dev/aptly/deb"
+	"pault.ag/go/debian/dependency"
+	"pault.ag/go/debian/version"
+)
+
+// 跳过依赖的原因
+const (
+	SkipReasonBlacklist = "blacklist"
+	SkipReasonBase      = "base"
+	SkipReasonRuntime   = "runtime"
+)
+
+// base/runtime 中已经安装的包
+type InstalledSet struct {
+	Name      string // base 或者 runtime，同时作为跳过依赖的原因
+	Index     *PackageIndex
+	Libraries map[string]bool // 动态库目录下的库文件名，为 nil 时只按已安装的包名检查缺失的库
+}
+
+// 被跳过的依赖关系
+type SkippedDepend struct {
+	Relation string
+	Package  string
+	Reason   string
+}
+
+// 虚包选择的提供者
+type ProviderChoice struct {
+	Virtual    string
+	Package    string
+	Candidates []string
+	Preferred  bool // 是否来自 package.yaml 中配置的首选提供者
+}
+
+// 依赖解析的结果
+type Resolution struct {
+	Packages      []*deb.Package   // 需要从仓库获取的包
+	Skipped       []SkippedDepend  // 已经满足或者被黑名单跳过的依赖
+	Providers     []ProviderChoice // 虚包选择的提供者
+	Unsatisfiable []string         // 无法满足的依赖关系
+}
+
+// 依赖解析器，按照 Depends/Pre-Depends 的语法解析版本约束、多选依赖和架构限定
+type Resolver struct {
+	Arch      string
+	Repo      *PackageIndex
+	Installed []InstalledSet
+	Skip      map[string]bool
+	Providers map[string]string // 虚包的首选提供者，虚包名 -> 包名
+	WithDeps  bool              // 是否递归解析依赖树
+	Options   int               // aptly 的 DependencyOptions，支持 Recommends、Suggests 和多选依赖的所有候选项
+
+	arch     *dependency.Arch
+	selected map[string]*deb.Package
+	seen     map[string]bool
+}
+
+func NewResolver(arch string, repo *PackageIndex) *Resolver {
+	return &Resolver{
+		Arch:      arch,
+		Repo:      repo,
+		Skip:      make(map[string]bool),
+		Providers: make(map[string]string),
+	}
+}
+
+// 解析依赖字段（Depends、Pre-Depends 格式）, 返回需要获取的包
+func (r *Resolver) Resolve(fields ...string) *Resolution {
+	res := &Resolution{}
+	r.selected = make(map[string]*deb.Package)
+	r.seen = make(map[string]bool)
+	if arch, err := dependency.ParseArch(r.Arch); err == nil {
+		r.arch = arch
+	} else {
+		r.arch = &dependency.Arch{CPU: r.Arch}
+	}
+	if r.Repo == nil {
+		r.Repo = NewPackageIndex()
+	}
+
+	queue := append([]string{}, fields...)
+	for len(queue) > 0 {
+		field := strings.TrimSpace(queue[0])
+		queue = queue[1:]
+		if field == "" {
+			continue
+		}
+
+		dep, err := dependency.Parse(field)
+		if err != nil {
+			res.Unsatisfiable = append(res.Unsatisfiable, fmt.Sprintf("%s: %s", field, err))
+			continue
+		}
+
+		for _, relation := range dep.Relations {
+			possibilities := r.possibilities(relation)
+			if len(possibilities) == 0 {
+				continue
+			}
+			key := relation.String()
+			if r.seen[key] {
+				continue
+			}
+			r.seen[key] = true
+
+			selected := []*deb.Package{r.resolveRelation(key, possibilities, res)}
+			// 多选依赖的其他候选项也获取，找不到时不算无法满足
+			if r.Options&deb.DepFollowAllVariants != 0 {
+				for _, possibility := range possibilities[1:] {
+					variant := &Resolution{}
+					selected = append(selected, r.resolveRelation(key, []dependency.Possibility{possibility}, variant))
+					res.Packages = append(res.Packages, variant.Packages...)
+					res.Skipped = append(res.Skipped, variant.Skipped...)
+					res.Providers = append(res.Providers, variant.Providers...)
+				}
+			}
+			if r.WithDeps {
+				for _, p := range selected {
+					if p != nil {
+						queue = append(queue, r.depends(p)...)
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// 需要递归解析的依赖字段
+func (r *Resolver) depends(p *deb.Package) []string {
+	deps := p.Deps()
+	fields := []string{strings.Join(deps.PreDepends, ", "), strings.Join(deps.Depends, ", ")}
+	if r.Options&deb.DepFollowRecommends != 0 {
+		fields = append(fields, strings.Join(deps.Recommends, ", "))
+	}
+	if r.Options&deb.DepFollowSuggests != 0 {
+		fields = append(fields, strings.Join(deps.Suggests, ", "))
+	}
+	return fields
+}
+
+// 过滤掉架构限定不匹配的候选项，例如 foo [!amd64]
+func (r *Resolver) possibilities(relation dependency.Relation) []dependency.Possibility {
+	var result []dependency.Possibility
+	for _, possibility := range relation.Possibilities {
+		if possibility.Substvar {
+			continue
+		}
+		if possibility.Architectures != nil && !possibility.Architectures.Matches(r.arch) {
+			continue
+		}
+		result = append(result, possibility)
+	}
+	return result
+}
+
+// 解析一组多选依赖，返回新选中的包，已满足或者无法满足时返回 nil
+func (r *Resolver) resolveRelation(relation string, possibilities []dependency.Possibility, res *Resolution) *deb.Package {
+	// 黑名单中的包不获取
+	for _, possibility := range possibilities {
+		if r.Skip[possibility.Name] {
+			res.Skipped = append(res.Skipped, SkippedDepend{Relation: relation, Package: possibility.Name, Reason: SkipReasonBlacklist})
+			return nil
+		}
+	}
+
+	// 优先使用 base/runtime 中已经满足条件的包，包括提供了对应虚包的包
+	for _, set := range r.Installed {
+		for _, possibility := range possibilities {
+			if p := r.match(set.Index, possibility); p != nil {
+				res.Skipped = append(res.Skipped, SkippedDepend{Relation: relation, Package: p.Name + "=" + p.Version, Reason: set.Name})
+				return nil
+			}
+			if providers := r.matchProviders(set.Index, possibility); len(providers) > 0 {
+				p := providers[0]
+				res.Skipped = append(res.Skipped, SkippedDepend{Relation: relation, Package: p.Name + "=" + p.Version, Reason: set.Name})
+				return nil
+			}
+		}
+	}
+
+	// 已经选中的包满足条件
+	for _, possibility := range possibilities {
+		if p, ok := r.selected[possibility.Name]; ok && r.satisfies(p, possibility) {
+			return nil
+		}
+		for _, p := range r.selected {
+			if r.provides(p, possibility) {
+				return nil
+			}
+		}
+	}
+
+	// 从仓库中选择满足约束的最高版本，没有实包时选择虚包的提供者
+	for _, possibility := range possibilities {
+		if _, ok := r.selected[possibility.Name]; ok {
+			continue
+		}
+		if p := r.match(r.Repo, possibility); p != nil {
+			r.selected[p.Name] = p
+			res.Packages = append(res.Packages, p)
+			return p
+		}
+		if providers := r.matchProviders(r.Repo, possibility); len(providers) > 0 {
+			p := r.chooseProvider(possibility.Name, providers, res)
+			r.selected[p.Name] = p
+			res.Packages = append(res.Packages, p)
+			return p
+		}
+	}
+
+	reason := "no candidate in repository"
+	for _, possibility := range possibilities {
+		if p, ok := r.selected[possibility.Name]; ok {
+			reason = fmt.Sprintf("conflicts with selected %s=%s", p.Name, p.Version)
+			break
+		}
+	}
+	res.Unsatisfiable = append(res.Unsatisfiable, fmt.Sprintf("%s: %s", relation, reason))
+	return nil
+}
+
+// 在索引中查找满足条件的最高版本
+func (r *Resolver) match(idx *PackageIndex, possibility dependency.Possibility) *deb.Package {
+	if idx == nil {
+		return nil
+	}
+	for _, p := range idx.Lookup(possibility.Name, r.possibilityArch(possibility)) {
+		if r.satisfies(p, possibility) {
+			return p
+		}
+	}
+	return nil
+}
+
+// 在索引中查找满足条件的虚包提供者
+func (r *Resolver) matchProviders(idx *PackageIndex, possibility dependency.Possibility) []*deb.Package {
+	if idx == nil {
+		return nil
+	}
+	var result []*deb.Package
+	seen := make(map[string]bool)
+	for _, provider := range idx.Providers(possibility.Name, r.possibilityArch(possibility)) {
+		if seen[provider.Package.Name] || !providerSatisfies(provider.Version, possibility) {
+			continue
+		}
+		// 同名的提供者只保留最高版本
+		seen[provider.Package.Name] = true
+		result = append(result, provider.Package)
+	}
+	return result
+}
+
+// 判断已经选中的包是否提供了对应的虚包
+func (r *Resolver) provides(p *deb.Package, possibility dependency.Possibility) bool {
+	for _, item := range p.Provides {
+		provides, err := dependency.Parse(item)
+		if err != nil {
+			continue
+		}
+		for _, provided := range provides.GetAllPossibilities() {
+			if provided.Name != possibility.Name {
+				continue
+			}
+			ver := ""
+			if provided.Version != nil && provided.Version.Operator == "=" {
+				ver = provided.Version.Number
+			}
+			if providerSatisfies(ver, possibility) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 优先选择 package.yaml 中配置的提供者，否则选择第一个提供者，并记录选择结果
+func (r *Resolver) chooseProvider(virtual string, providers []*deb.Package, res *Resolution) *deb.Package {
+	choice := ProviderChoice{Virtual: virtual}
+	for _, p := range providers {
+		choice.Candidates = append(choice.Candidates, p.Name)
+	}
+
+	chosen := providers[0]
+	if preferred, ok := r.Providers[virtual]; ok {
+		found := false
+		for _, p := range providers {
+			if p.Name == preferred {
+				chosen = p
+				found = true
+				break
+			}
+		}
+		choice.Preferred = found
+	}
+	choice.Package = chosen.Name + "=" + chosen.Version
+	res.Providers = append(res.Providers, choice)
+	return chosen
+}
+
+// 不带版本的 Provides 只能满足不带版本约束的依赖
+func providerSatisfies(providedVersion string, possibility dependency.Possibility) bool {
+	if possibility.Version == nil {
+		return true
+	}
+	if providedVersion == "" {
+		return false
+	}
+	return versionSatisfies(providedVersion, possibility.Version)
+}
+
+func (r *Resolver) satisfies(p *deb.Package, possibility dependency.Possibility) bool {
+	if possibility.Version == nil {
+		return true
+	}
+	return versionSatisfies(p.Version, possibility.Version)
+}
+
+// 架构限定，foo:any 不限制架构，foo:native 和未限定时使用目标架构
+func (r *Resolver) possibilityArch(possibility dependency.Possibility) string {
+	if possibility.Arch == nil {
+		return r.Arch
+	}
+	if possibility.Arch.IsWildcard() {
+		return ""
+	}
+	if possibility.Arch.CPU == "native" {
+		return r.Arch
+	}
+	return possibility.Arch.CPU
+}
+
+func versionSatisfies(ver string, relation *dependency.VersionRelation) bool {
+	v, err := version.Parse(ver)
+	if err != nil {
+		return false
+	}
+	return relation.SatisfiedBy(v)
+}
@@ -0,0 +1,200 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aptly-dev/aptly/deb"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+)
+
+func newTestPackage(name, ver, arch, depends string) *deb.Package {
+	stanza := deb.Stanza{
+		"Package":      name,
+		"Version":      ver,
+		"Architecture": arch,
+		"Filename":     "pool/main/" + name + "_" + ver + "_" + arch + ".deb",
+	}
+	if depends != "" {
+		stanza["Depends"] = depends
+	}
+	return deb.NewPackageFromControlFile(stanza)
+}
+
+func newTestIndex(packages ...*deb.Package) *PackageIndex {
+	idx := NewPackageIndex()
+	for _, p := range packages {
+		idx.Add(p)
+	}
+	return idx
+}
+
+func packageNames(packages []*deb.Package) []string {
+	var names []string
+	for _, p := range packages {
+		names = append(names, p.Name+"="+p.Version)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var testDataResolve = []struct {
+	depends       string
+	withDeps      bool
+	packages      string
+	unsatisfiable int
+}{
+	// 选择满足约束的最高版本
+	{"libfoo (>= 1.0)", false, "libfoo=2.0", 0},
+	// 版本约束不满足最新版本时回退到旧版本
+	{"libfoo (<< 2.0)", false, "libfoo=1.5", 0},
+	// base 中的版本满足约束时不获取
+	{"libc6 (>= 2.28)", false, "", 0},
+	// base 中的版本过旧时从仓库获取
+	{"libc6 (>= 2.36)", false, "libc6=2.36", 0},
+	// 多选依赖，优先使用已经安装的包
+	{"libbar1 | libc6", false, "", 0},
+	// 多选依赖，第一个不存在时选择后面的
+	{"libmissing | libbar1", false, "libbar1=1.0", 0},
+	// 架构限定
+	{"libfoo [!amd64], libbar1 [amd64]", false, "libbar1=1.0", 0},
+	{"libfoo:any", false, "libfoo=2.0", 0},
+	// 黑名单
+	{"systemd", false, "", 0},
+	// 无法满足的依赖需要报告
+	{"libfoo (>= 3.0), libmissing", false, "", 2},
+	// 递归解析依赖树
+	{"libbar1", true, "libbar1=1.0,libfoo=2.0", 0},
+}
+
+func TestResolve(t *testing.T) {
+	repo := newTestIndex(
+		newTestPackage("libfoo", "1.5", "amd64", ""),
+		newTestPackage("libfoo", "2.0", "amd64", ""),
+		newTestPackage("libc6", "2.36", "amd64", ""),
+		newTestPackage("libbar1", "1.0", "amd64", "libfoo (>= 1.0), libc6"),
+		newTestPackage("systemd", "255", "amd64", ""),
+	)
+	base := newTestIndex(newTestPackage("libc6", "2.28", "amd64", ""))
+
+	for _, tds := range testDataResolve {
+		resolver := NewResolver("amd64", repo)
+		resolver.WithDeps = tds.withDeps
+		resolver.Skip["systemd"] = true
+		resolver.Installed = []InstalledSet{{Name: SkipReasonBase, Index: base}}
+
+		res := resolver.Resolve(tds.depends)
+		if ret := strings.Join(packageNames(res.Packages), ","); ret != tds.packages {
+			t.Errorf("Failed test for Resolve! Error: %s got %s, want %s", tds.depends, ret, tds.packages)
+		}
+		if len(res.Unsatisfiable) != tds.unsatisfiable {
+			t.Errorf("Failed test for Resolve! Error: %s unsatisfiable %v", tds.depends, res.Unsatisfiable)
+		}
+	}
+}
+
+func newTestProvider(name, ver, provides string) *deb.Package {
+	return deb.NewPackageFromControlFile(deb.Stanza{
+		"Package":      name,
+		"Version":      ver,
+		"Architecture": "amd64",
+		"Provides":     provides,
+	})
+}
+
+var testDataResolveProviders = []struct {
+	depends   string
+	preferred map[string]string
+	packages  string
+	provider  string
+}{
+	// 只有一个提供者
+	{"default-dbus-session-bus", nil, "dbus-user-session=1.14", "dbus-user-session=1.14"},
+	// 多个提供者时使用稳定的顺序
+	{"x-terminal-emulator", nil, "deepin-terminal=6.0", "deepin-terminal=6.0"},
+	// 使用配置的首选提供者
+	{"x-terminal-emulator", map[string]string{"x-terminal-emulator": "xterm"}, "xterm=390", "xterm=390"},
+	// 带版本的依赖只能由带版本的 Provides 满足
+	{"libgl1-provider (>= 1.0)", nil, "libgl1-mesa=23.0", "libgl1-mesa=23.0"},
+	// base 中已经提供了虚包
+	{"libegl1-provider", nil, "", ""},
+}
+
+func TestResolveProviders(t *testing.T) {
+	repo := newTestIndex(
+		newTestProvider("dbus-user-session", "1.14", "default-dbus-session-bus"),
+		newTestProvider("xterm", "390", "x-terminal-emulator"),
+		newTestProvider("deepin-terminal", "6.0", "x-terminal-emulator"),
+		newTestProvider("libgl1-nvidia", "1.0", "libgl1-provider"),
+		newTestProvider("libgl1-mesa", "23.0", "libgl1-provider (= 1.2)"),
+	)
+	base := newTestIndex(newTestProvider("libegl1", "1.6", "libegl1-provider"))
+
+	for _, tds := range testDataResolveProviders {
+		resolver := NewResolver("amd64", repo)
+		resolver.Installed = []InstalledSet{{Name: SkipReasonBase, Index: base}}
+		for virtual, name := range tds.preferred {
+			resolver.Providers[virtual] = name
+		}
+
+		res := resolver.Resolve(tds.depends)
+		if ret := strings.Join(packageNames(res.Packages), ","); ret != tds.packages {
+			t.Errorf("Failed test for Resolve! Error: %s got %s, want %s", tds.depends, ret, tds.packages)
+		}
+		provider := ""
+		if len(res.Providers) > 0 {
+			provider = res.Providers[0].Package
+		}
+		if provider != tds.provider {
+			t.Errorf("Failed test for Resolve! Error: %s provider %s, want %s", tds.depends, provider, tds.provider)
+		}
+	}
+}
+
+var testDataResolvePriority = []struct {
+	depends  string
+	packages string
+	origin   string
+}{
+	// 优先级高的仓库优先，即使版本较低
+	{"libfoo", "libfoo=1.0", "vendor"},
+	// 优先级高的仓库中的版本不满足约束时使用其他仓库
+	{"libfoo (>= 2.0)", "libfoo=2.0", "community"},
+	// 只存在于优先级低的仓库
+	{"libbar", "libbar=1.0", "community"},
+}
+
+func TestResolvePriority(t *testing.T) {
+	config := &comm.Config{Sources: []comm.AptSource{
+		{Name: "community", Url: "https://example.com/community", Suite: "stable"},
+		{Name: "vendor", Url: "https://example.com/vendor", Suite: "stable", Priority: 900},
+	}}
+	repos := NewRepositories(config)
+	if repos[0].Name != "vendor" || repos[1].Priority != comm.DefaultAptPriority {
+		t.Fatalf("Failed test for NewRepositories! Error: unexpected order %s, %s", repos[0].Name, repos[1].Name)
+	}
+
+	idx := NewPackageIndex()
+	idx.AddFrom(newTestPackage("libfoo", "2.0", "amd64", ""), repos[1])
+	idx.AddFrom(newTestPackage("libbar", "1.0", "amd64", ""), repos[1])
+	idx.AddFrom(newTestPackage("libfoo", "1.0", "amd64", ""), repos[0])
+
+	for _, tds := range testDataResolvePriority {
+		res := NewResolver("amd64", idx).Resolve(tds.depends)
+		if ret := strings.Join(packageNames(res.Packages), ","); ret != tds.packages {
+			t.Errorf("Failed test for Resolve! Error: %s got %s, want %s", tds.depends, ret, tds.packages)
+			continue
+		}
+		if origin := idx.Origin(res.Packages[0]).Name; origin != tds.origin {
+			t.Errorf("Failed test for Origin! Error: %s from %s, want %s", tds.depends, origin, tds.origin)
+		}
+	}
+}
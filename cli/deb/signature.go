@@ -0,0 +1,276 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aptly-dev/aptly/pgp"
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/armor"  //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
+
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 没有配置 keyring 时使用 apt 信任的 keyring
+var aptKeyrings = []string{"/etc/apt/trusted.gpg", "/etc/apt/trusted.gpg.d/*.gpg"}
+
+// 签名校验失败，这类错误不能回退到其他获取方式
+type SignatureError struct {
+	Source string
+	Err    error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("verify signature of %s failed: %s", e.Source, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// 实际使用的 keyring 文件
+func (r *Repository) keyringFiles() []string {
+	if len(r.Keyrings) > 0 {
+		return r.Keyrings
+	}
+	var files []string
+	for _, pattern := range aptKeyrings {
+		matches, _ := filepath.Glob(pattern)
+		files = append(files, matches...)
+	}
+	return files
+}
+
+// 使用 aptly 内置的 openpgp 实现校验签名，不依赖 gpg 命令；关闭签名校验时返回 nil
+func (r *Repository) Verifier() (pgp.Verifier, error) {
+	if r.IgnoreSignatures {
+		return nil, nil
+	}
+	verifier := &pgp.GoVerifier{}
+	for _, keyring := range r.keyringFiles() {
+		verifier.AddKeyring(keyring)
+	}
+	if err := verifier.InitKeyring(); err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+// 校验通过的签名 key 与 Release 一起缓存
+const signedByFile = "signed-by"
+
+// 下载仓库的 Release 并校验签名，优先使用 InRelease，其次是 Release 和 Release.gpg，返回校验后的内容。
+// 有效期内直接使用缓存的 Release
+func (r *Repository) FetchRelease(dir string) ([]byte, error) {
+	root := r.DistURL()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if data, ok := r.cachedRelease(dir); ok {
+		return data, nil
+	}
+	releasePath := filepath.Join(dir, "Release")
+	os.Remove(filepath.Join(dir, signedByFile))
+	if r.IgnoreSignatures {
+		log.Logger.Warnf("signature verification of %s is disabled", root)
+		if err := fetch(root+"/Release", releasePath, ""); err != nil {
+			return nil, fmt.Errorf("download Release of %s: %w", root, err)
+		}
+		r.setState(func() { r.SignedBy = "" })
+		return os.ReadFile(releasePath)
+	}
+
+	verifier, err := r.Verifier()
+	if err != nil {
+		return nil, &SignatureError{Source: root, Err: err}
+	}
+	recorder := &keyRecorder{Verifier: verifier}
+
+	inReleasePath := filepath.Join(dir, "InRelease")
+	if err := fetch(root+"/InRelease", inReleasePath, ""); err == nil {
+		data, err := verifyClearsigned(recorder, inReleasePath)
+		if err != nil {
+			return nil, &SignatureError{Source: root + "/InRelease", Err: err}
+		}
+		signedBy := r.describeKeys(recorder.keys)
+		r.setState(func() { r.SignedBy = signedBy })
+		os.WriteFile(releasePath, data, 0644)
+		os.WriteFile(filepath.Join(dir, signedByFile), []byte(signedBy), 0644)
+		return data, nil
+	}
+
+	if err := fetch(root+"/Release", releasePath, ""); err != nil {
+		return nil, fmt.Errorf("download Release of %s: %w", root, err)
+	}
+	signaturePath := filepath.Join(dir, "Release.gpg")
+	if err := fetch(root+"/Release.gpg", signaturePath, ""); err != nil {
+		return nil, &SignatureError{Source: root, Err: fmt.Errorf("neither InRelease nor Release.gpg found")}
+	}
+	data, err := os.ReadFile(releasePath)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := recorder.VerifyDetachedSignature(bytes.NewReader(signature), bytes.NewReader(data), false); err != nil {
+		return nil, &SignatureError{Source: root + "/Release", Err: err}
+	}
+	signedBy := r.describeKeys(recorder.keys)
+	r.setState(func() { r.SignedBy = signedBy })
+	os.WriteFile(filepath.Join(dir, signedByFile), []byte(signedBy), 0644)
+	return data, nil
+}
+
+// 有效期内缓存的 Release，需要校验签名时只使用校验通过的 Release
+func (r *Repository) cachedRelease(dir string) ([]byte, bool) {
+	if r.refresh || r.TTL <= 0 || r.Local() {
+		return nil, false
+	}
+	releasePath := filepath.Join(dir, "Release")
+	info, err := os.Stat(releasePath)
+	if err != nil || time.Since(info.ModTime()) > r.TTL {
+		return nil, false
+	}
+	signedBy, err := os.ReadFile(filepath.Join(dir, signedByFile))
+	if !r.IgnoreSignatures && (err != nil || len(signedBy) == 0) {
+		return nil, false
+	}
+	data, err := os.ReadFile(releasePath)
+	if err != nil {
+		return nil, false
+	}
+	if r.IgnoreSignatures {
+		signedBy = nil
+	}
+	r.setState(func() { r.SignedBy = string(signedBy) })
+	return data, true
+}
+
+func verifyClearsigned(verifier pgp.Verifier, path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := verifier.VerifyClearsigned(file, false); err != nil {
+		return nil, err
+	}
+	file.Seek(0, io.SeekStart)
+	text, err := verifier.ExtractClearsigned(file)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(text.Name())
+	defer text.Close()
+	data, err := io.ReadAll(text)
+	if err != nil {
+		return nil, err
+	}
+	// 签名的文本使用 CRLF 换行
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), nil
+}
+
+// 记录校验通过的签名 key
+type keyRecorder struct {
+	pgp.Verifier
+	keys []pgp.Key
+}
+
+func (v *keyRecorder) VerifyClearsigned(clearsigned io.Reader, showKeyTip bool) (*pgp.KeyInfo, error) {
+	info, err := v.Verifier.VerifyClearsigned(clearsigned, showKeyTip)
+	if err == nil && info != nil {
+		v.keys = append(v.keys, info.GoodKeys...)
+	}
+	return info, err
+}
+
+func (v *keyRecorder) VerifyDetachedSignature(signature, cleartext io.Reader, showKeyTip bool) error {
+	// aptly 不返回分离签名的 key，先读出签名取出签名者再交给 aptly 校验
+	data, err := io.ReadAll(signature)
+	if err != nil {
+		return err
+	}
+	if err := v.Verifier.VerifyDetachedSignature(bytes.NewReader(data), cleartext, showKeyTip); err != nil {
+		return err
+	}
+	v.keys = append(v.keys, signatureIssuers(data)...)
+	return nil
+}
+
+// 分离签名中的签名者，签名可能是 ascii armor 格式
+func signatureIssuers(data []byte) []pgp.Key {
+	var reader io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		block, err := armor.Decode(reader)
+		if err != nil {
+			return nil
+		}
+		reader = block.Body
+	}
+	var keys []pgp.Key
+	packets := packet.NewReader(reader)
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			break
+		}
+		switch sig := p.(type) {
+		case *packet.Signature:
+			if sig.IssuerKeyId != nil {
+				keys = append(keys, pgp.KeyFromUint64(*sig.IssuerKeyId))
+			}
+		case *packet.SignatureV3:
+			keys = append(keys, pgp.KeyFromUint64(sig.IssuerKeyId))
+		}
+	}
+	return keys
+}
+
+// 签名 key 的描述，包含 key id 和 keyring 中的用户名，例如 1234567890ABCDEF (Deepin Archive Key)
+func (r *Repository) describeKeys(keys []pgp.Key) string {
+	var entities openpgp.EntityList
+	for _, file := range r.keyringFiles() {
+		fd, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		list, err := openpgp.ReadKeyRing(fd)
+		fd.Close()
+		if err == nil {
+			entities = append(entities, list...)
+		}
+	}
+
+	var result []string
+	for _, key := range keys {
+		desc := string(key)
+		if id, err := strconv.ParseUint(string(key), 16, 64); err == nil {
+			for _, item := range entities.KeysById(id) {
+				for name := range item.Entity.Identities {
+					desc = fmt.Sprintf("%s (%s)", key, name)
+					break
+				}
+				break
+			}
+		}
+		if !contains(result, desc) {
+			result = append(result, desc)
+		}
+	}
+	return strings.Join(result, ", ")
+}
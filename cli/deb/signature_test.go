@@ -0,0 +1,80 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"           //nolint:staticcheck
+	"golang.org/x/crypto/openpgp/clearsign" //nolint:staticcheck
+)
+
+func TestVerifyRelease(t *testing.T) {
+	dir := t.TempDir()
+	entity, err := openpgp.NewEntity("Pica Test", "", "pica@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyring bytes.Buffer
+	entity.Serialize(&keyring)
+	keyringPath := filepath.Join(dir, "trusted.gpg")
+	os.WriteFile(keyringPath, keyring.Bytes(), 0644)
+	repo := &Repository{Keyrings: []string{keyringPath}}
+
+	release := []byte("Origin: Test\nSuite: stable\n")
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, entity, bytes.NewReader(release), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := repo.Verifier()
+	if err != nil {
+		t.Fatalf("Failed test for Verifier! Error: %s", err)
+	}
+	recorder := &keyRecorder{Verifier: verifier}
+	if err := recorder.VerifyDetachedSignature(bytes.NewReader(signature.Bytes()), bytes.NewReader(release), false); err != nil {
+		t.Errorf("Failed test for VerifyDetachedSignature! Error: %s", err)
+	}
+	if desc := repo.describeKeys(recorder.keys); !strings.Contains(desc, "Pica Test <pica@example.com>") {
+		t.Errorf("Failed test for describeKeys! Error: unexpected %q", desc)
+	}
+
+	tampered := []byte("Origin: Evil\nSuite: stable\n")
+	if err := recorder.VerifyDetachedSignature(bytes.NewReader(signature.Bytes()), bytes.NewReader(tampered), false); err == nil {
+		t.Errorf("Failed test for VerifyDetachedSignature! Error: tampered Release accepted")
+	}
+
+	// InRelease 为 clearsign 格式
+	var clearsigned bytes.Buffer
+	writer, err := clearsign.Encode(&clearsigned, entity.PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(release)
+	writer.Close()
+	inRelease := filepath.Join(dir, "InRelease")
+	os.WriteFile(inRelease, clearsigned.Bytes(), 0644)
+	data, err := verifyClearsigned(&keyRecorder{Verifier: verifier}, inRelease)
+	if err != nil || !bytes.Equal(bytes.TrimSpace(data), bytes.TrimSpace(release)) {
+		t.Errorf("Failed test for verifyClearsigned! Error: %v, data %q", err, data)
+	}
+
+	// 不在 keyring 中的 key 签名的 InRelease 校验失败
+	other, _ := openpgp.NewEntity("Other", "", "other@example.com", nil)
+	clearsigned.Reset()
+	writer, _ = clearsign.Encode(&clearsigned, other.PrivateKey, nil)
+	writer.Write(release)
+	writer.Close()
+	os.WriteFile(inRelease, clearsigned.Bytes(), 0644)
+	if _, err := verifyClearsigned(&keyRecorder{Verifier: verifier}, inRelease); err == nil {
+		t.Errorf("Failed test for verifyClearsigned! Error: untrusted signature accepted")
+	}
+}
@@ -0,0 +1,318 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pault.ag/go/debian/version"
+)
+
+// 版本映射策略的取值
+const (
+	EpochMajor    = "major"  // epoch 累加到主版本号上，主版本号 = epoch*1000 + 主版本号
+	EpochReject   = "reject" // 存在 epoch 时报错
+	TildeOrder    = "order"  // 预发布版本排在正式版本之前，有第四位时记录在第四位中，否则与正式版本相同
+	TildeReject   = "reject" // 存在 ~ 时报错
+	RevisionDrop  = "drop"   // 丢弃 debian 修订号，上游版本号占用四位
+	RevisionBuild = "build"  // 预发布版本和修订号记录在第四位中，上游版本号占用三位
+)
+
+const (
+	epochBase   = 1000
+	maxRevision = 99
+	maxRebuild  = 99
+)
+
+// deb 版本号映射为玲珑四位版本号的策略
+type VersionPolicy struct {
+	Epoch    string `yaml:"epoch"`
+	Tilde    string `yaml:"tilde"`
+	Revision string `yaml:"revision"`
+	Rebuild  int    `yaml:"rebuild"` // pica 重新构建的次数，大于 0 时记录在第四位中
+}
+
+// 映射结果，Lossy 记录映射时丢失的信息，此时不同的 deb 版本可能映射为同一个玲珑版本，但不会颠倒顺序
+type MappedVersion struct {
+	Deb      string
+	Linglong string
+	Lossy    []string
+}
+
+func NewVersionPolicy() VersionPolicy {
+	return VersionPolicy{
+		Epoch:    EpochMajor,
+		Tilde:    TildeOrder,
+		Revision: RevisionBuild,
+	}
+}
+
+// 未配置的策略使用默认值
+func (p VersionPolicy) withDefaults() VersionPolicy {
+	def := NewVersionPolicy()
+	if p.Epoch == "" {
+		p.Epoch = def.Epoch
+	}
+	if p.Tilde == "" {
+		p.Tilde = def.Tilde
+	}
+	if p.Revision == "" {
+		p.Revision = def.Revision
+	}
+	return p
+}
+
+func (p VersionPolicy) Validate() error {
+	p = p.withDefaults()
+	if p.Epoch != EpochMajor && p.Epoch != EpochReject {
+		return fmt.Errorf("unknown epoch policy %q, expect %s or %s", p.Epoch, EpochMajor, EpochReject)
+	}
+	if p.Tilde != TildeOrder && p.Tilde != TildeReject {
+		return fmt.Errorf("unknown tilde policy %q, expect %s or %s", p.Tilde, TildeOrder, TildeReject)
+	}
+	if p.Revision != RevisionDrop && p.Revision != RevisionBuild {
+		return fmt.Errorf("unknown revision policy %q, expect %s or %s", p.Revision, RevisionDrop, RevisionBuild)
+	}
+	if p.Rebuild < 0 || p.Rebuild > maxRebuild {
+		return fmt.Errorf("rebuild %d out of range 0-%d", p.Rebuild, maxRebuild)
+	}
+	return nil
+}
+
+// 是否使用第四位记录构建信息
+func (p VersionPolicy) buildField() bool {
+	return p.Revision == RevisionBuild || p.Rebuild > 0
+}
+
+// 将 deb 版本号映射为玲珑四位版本号，保证 deb 版本 A < B 时映射后的版本不会颠倒。
+// 第四位用于构建信息时，由 上游版本的位置(1位)、修订号(2位)、重新构建次数(2位) 组成。
+func (p VersionPolicy) Map(debVersion string) (*MappedVersion, error) {
+	p = p.withDefaults()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	v, err := version.Parse(debVersion)
+	if err != nil {
+		return nil, fmt.Errorf("parse version %s: %w", debVersion, err)
+	}
+	res := &MappedVersion{Deb: debVersion}
+
+	if p.Tilde == TildeReject && strings.Contains(v.Version, "~") {
+		return nil, fmt.Errorf("version %s is a pre-release, rejected by tilde policy", debVersion)
+	}
+
+	fields := 4
+	if p.buildField() {
+		fields = 3
+	}
+	nums, lossy, err := upstreamNumbers(v.Version)
+	if err != nil {
+		return nil, fmt.Errorf("map version %s: %w", debVersion, err)
+	}
+	if lossy != "" {
+		res.Lossy = append(res.Lossy, lossy)
+	}
+	if len(nums) > fields {
+		nums = nums[:fields]
+	}
+	class := upstreamClass(v.Version, nums, fields)
+	parts := make([]uint64, fields)
+	copy(parts, nums)
+	if class%2 == 0 && lossy == "" {
+		res.Lossy = append(res.Lossy, fmt.Sprintf("upstream %s approximated as %s", v.Version, joinVersion(parts)))
+	}
+
+	if v.Epoch > 0 && p.Epoch == EpochReject {
+		return nil, fmt.Errorf("version %s has epoch %d, rejected by epoch policy", debVersion, v.Epoch)
+	}
+	if p.Epoch == EpochMajor && v.Epoch > 0 {
+		// 有 epoch 时主版本号不能超过 epoch 的进位。没有 epoch 的日期等版本号正常映射，
+		// 与有 epoch 的版本一起使用时可能颠倒顺序，由 CheckOrder 检查
+		if parts[0] >= epochBase {
+			return nil, fmt.Errorf("version %s: major %d is not less than %d, conflicts with epoch policy %s, use %s instead", debVersion, parts[0], epochBase, EpochMajor, EpochReject)
+		}
+		parts[0] += uint64(v.Epoch) * epochBase
+	}
+
+	if p.buildField() {
+		rev := 0
+		if p.Revision == RevisionBuild && class%2 == 1 {
+			var lossy string
+			rev, lossy = revisionNumber(v.Revision)
+			if lossy != "" {
+				res.Lossy = append(res.Lossy, lossy)
+			}
+		} else if v.Revision != "" && v.Revision != "0" {
+			// 上游版本不能精确表示时修订号无法保证顺序，只能丢弃
+			res.Lossy = append(res.Lossy, fmt.Sprintf("debian revision %s dropped", v.Revision))
+		}
+		parts = append(parts, uint64(class*10000+rev*100+p.Rebuild))
+	} else if v.Revision != "" && v.Revision != "0" {
+		res.Lossy = append(res.Lossy, fmt.Sprintf("debian revision %s dropped", v.Revision))
+	}
+
+	res.Linglong = joinVersion(parts)
+	return res, nil
+}
+
+// 提取上游版本开头的 N.N.N 数字部分，数字后面排在所有数字之后的后缀无法保证顺序，丢弃后作为提示返回
+func upstreamNumbers(upstream string) ([]uint64, string, error) {
+	var nums []uint64
+	i := 0
+	for {
+		j := i
+		for j < len(upstream) && isDigit(upstream[j]) {
+			j++
+		}
+		if j == i {
+			break
+		}
+		n, err := strconv.ParseUint(upstream[i:j], 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("component %s: %w", upstream[i:j], err)
+		}
+		nums = append(nums, n)
+		if j+1 < len(upstream) && upstream[j] == '.' && isDigit(upstream[j+1]) {
+			i = j + 1
+			continue
+		}
+		i = j
+		break
+	}
+	if len(nums) == 0 {
+		return nil, "", fmt.Errorf("upstream %s does not start with digit", upstream)
+	}
+	// 点后面跟着字母等字符时排在所有数字之后，例如 1.2.a > 1.2.9，只映射数字部分，映射后的顺序可能颠倒
+	rest := upstream[i:]
+	if strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[0] == '.' && rest[1] != '~') {
+		return nums, fmt.Sprintf("upstream suffix %s of %s sorts after numbers, dropped", rest, upstream), nil
+	}
+	return nums, "", nil
+}
+
+// 上游版本相对于同一数字部分的精确版本的位置，例如数字部分为 1.2 时，依次为
+// < 1.2、= 1.2、(1.2, 1.2.0)、= 1.2.0、... ，奇数表示可以精确表示，偶数表示丢失了后缀
+func upstreamClass(upstream string, nums []uint64, fields int) int {
+	trimmed := append([]uint64{}, nums...)
+	for len(trimmed) > 1 && trimmed[len(trimmed)-1] == 0 {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	u := version.Version{Version: upstream}
+	for j := 0; len(trimmed)+j <= fields; j++ {
+		exact := append(append([]uint64{}, trimmed...), make([]uint64, j)...)
+		ret := version.Compare(u, version.Version{Version: joinVersion(exact)})
+		if ret < 0 {
+			return 2 * j
+		}
+		if ret == 0 {
+			return 2*j + 1
+		}
+	}
+	return 2 * (fields - len(trimmed) + 1)
+}
+
+// 修订号的数字部分，以字母开头的修订号排在所有数字之后，以 ~ 开头的排在最前面
+func revisionNumber(revision string) (int, string) {
+	if revision == "" {
+		return 0, ""
+	}
+	j := 0
+	for j < len(revision) && isDigit(revision[j]) {
+		j++
+	}
+	if j == 0 {
+		if revision[0] == '~' {
+			return 0, fmt.Sprintf("debian revision %s mapped to 0", revision)
+		}
+		return maxRevision, fmt.Sprintf("debian revision %s mapped to %d", revision, maxRevision)
+	}
+	n, err := strconv.Atoi(revision[:j])
+	if err != nil || n > maxRevision {
+		return maxRevision, fmt.Sprintf("debian revision %s exceeds %d", revision, maxRevision)
+	}
+	if j < len(revision) {
+		return n, fmt.Sprintf("debian revision suffix %s dropped", revision[j:])
+	}
+	return n, ""
+}
+
+// 检查一组 deb 版本映射后的顺序，返回映射后颠倒顺序的版本和映射为同一个玲珑版本的版本
+func (p VersionPolicy) CheckOrder(debVersions []string) (inversions, collisions []string, err error) {
+	type item struct {
+		deb      version.Version
+		linglong string
+	}
+	var items []item
+	for _, ver := range debVersions {
+		v, err := version.Parse(ver)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse version %s: %w", ver, err)
+		}
+		m, err := p.Map(ver)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item{deb: v, linglong: m.Linglong})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return version.Compare(items[i].deb, items[j].deb) < 0
+	})
+
+	// 相邻的版本不颠倒即可保证整体的顺序
+	for i := 1; i < len(items); i++ {
+		a, b := items[i-1], items[i]
+		if version.Compare(a.deb, b.deb) == 0 {
+			continue
+		}
+		ret := CompareLinglongVersion(a.linglong, b.linglong)
+		pair := fmt.Sprintf("%s < %s => %s, %s", a.deb, b.deb, a.linglong, b.linglong)
+		if ret > 0 {
+			inversions = append(inversions, pair)
+		} else if ret == 0 {
+			collisions = append(collisions, pair)
+		}
+	}
+	return inversions, collisions, nil
+}
+
+// 比较玲珑版本号
+func CompareLinglongVersion(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for len(as) < len(bs) {
+		as = append(as, "0")
+	}
+	for len(bs) < len(as) {
+		bs = append(bs, "0")
+	}
+	for i := range as {
+		x, _ := strconv.ParseUint(as[i], 10, 64)
+		y, _ := strconv.ParseUint(bs[i], 10, 64)
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+func joinVersion(parts []uint64) string {
+	var items []string
+	for _, n := range parts {
+		items = append(items, strconv.FormatUint(n, 10))
+	}
+	return strings.Join(items, ".")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,107 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"testing"
+)
+
+var testDataMapVersion = []struct {
+	policy VersionPolicy
+	deb    string
+	want   string
+	lossy  bool
+}{
+	// 默认策略下预发布版本和修订号记录在第四位
+	{NewVersionPolicy(), "2.3", "2.3.0.10000", false},
+	{NewVersionPolicy(), "4.17.7-1", "4.17.7.10100", false},
+	{NewVersionPolicy(), "1.2.3.4.5", "1.2.3.20000", true},
+	// epoch 累加到主版本号
+	{NewVersionPolicy(), "1:2.3~rc1-4", "1002.3.0.0", true},
+	{NewVersionPolicy(), "2.3+dfsg", "2.3.0.20000", true},
+	// 排在数字之后的后缀只映射数字部分
+	{NewVersionPolicy(), "1.0.beta1", "1.0.0.60000", true},
+	{NewVersionPolicy(), "1.2.a", "1.2.0.40000", true},
+	// 日期等较大的主版本号没有 epoch 时正常映射
+	{NewVersionPolicy(), "20240101", "20240101.0.0.10000", false},
+	{NewVersionPolicy(), "2023.10.1", "2023.10.1.10000", false},
+	// 丢弃修订号时上游版本占用四位
+	{VersionPolicy{Revision: RevisionDrop}, "4.17.7-1", "4.17.7.0", true},
+	{VersionPolicy{Revision: RevisionDrop}, "1.2.3.4.5", "1.2.3.4", true},
+	// 修订号和重新构建次数记录在第四位
+	{VersionPolicy{Revision: RevisionBuild}, "2.3-1", "2.3.0.10100", false},
+	{VersionPolicy{Revision: RevisionBuild, Rebuild: 2}, "2.3-1", "2.3.0.10102", false},
+	{VersionPolicy{Revision: RevisionBuild}, "2.3~rc1-4", "2.3.0.0", true},
+	{VersionPolicy{Revision: RevisionBuild}, "2.3-0ubuntu1", "2.3.0.10000", true},
+	{VersionPolicy{Revision: RevisionDrop, Rebuild: 1}, "2.3-4", "2.3.0.10001", true},
+}
+
+func TestMapVersion(t *testing.T) {
+	for _, tds := range testDataMapVersion {
+		ret, err := tds.policy.Map(tds.deb)
+		if err != nil {
+			t.Errorf("Failed test for Map! Error: %s %v", tds.deb, err)
+			continue
+		}
+		if ret.Linglong != tds.want || (len(ret.Lossy) > 0) != tds.lossy {
+			t.Errorf("Failed test for Map! Error: %s got %s %v, want %s", tds.deb, ret.Linglong, ret.Lossy, tds.want)
+		}
+	}
+
+	// 无法保证顺序的版本需要报错
+	for _, tds := range []struct {
+		policy VersionPolicy
+		deb    string
+	}{
+		{VersionPolicy{Epoch: EpochReject}, "1:2.3"},
+		{NewVersionPolicy(), "1:1000.0"},
+		{VersionPolicy{Tilde: TildeReject}, "2.3~rc1"},
+	} {
+		if _, err := tds.policy.Map(tds.deb); err == nil {
+			t.Errorf("Failed test for Map! Error: %s should be rejected", tds.deb)
+		}
+	}
+}
+
+var testDataMapOrder = []struct {
+	a, b string
+}{
+	{"2.3~rc1-4", "2.3-1"},
+	{"2.3-1", "2.3-2"},
+	{"2.3-2", "2.3.1~beta"},
+	{"2.3~rc1", "2.3"},
+}
+
+// 默认策略下不同的 deb 版本映射为不同的玲珑版本，并且保持顺序
+func TestMapOrder(t *testing.T) {
+	for _, tds := range testDataMapOrder {
+		a, errA := NewVersionPolicy().Map(tds.a)
+		b, errB := NewVersionPolicy().Map(tds.b)
+		if errA != nil || errB != nil || CompareLinglongVersion(a.Linglong, b.Linglong) >= 0 {
+			t.Errorf("Failed test for Map! Error: %s => %v, %s => %v", tds.a, a, tds.b, b)
+		}
+	}
+}
+
+func TestCheckOrder(t *testing.T) {
+	versions := []string{"1:2.3~rc1-4", "2.3-1", "2.3~rc1-4", "2.3-2", "2.3.0-1", "2.3+dfsg-1", "2.3.1~beta", "2.10", "2.9.9.9.9"}
+	for _, policy := range []VersionPolicy{NewVersionPolicy(), {Revision: RevisionBuild}, {Rebuild: 3}} {
+		inversions, _, err := policy.CheckOrder(versions)
+		if err != nil || len(inversions) > 0 {
+			t.Errorf("Failed test for CheckOrder! Error: %+v %v %v", policy, inversions, err)
+		}
+	}
+	_, collisions, _ := VersionPolicy{Revision: RevisionBuild}.CheckOrder([]string{"2.3-1", "2.3-2"})
+	if len(collisions) != 0 {
+		t.Errorf("Failed test for CheckOrder! Error: %v", collisions)
+	}
+	// 没有 epoch 的大主版本号正常映射，与有 epoch 的版本一起使用时由 CheckOrder 给出颠倒的顺序
+	pair := []string{"20240101", "1:1.0"}
+	if inversions, _, err := NewVersionPolicy().CheckOrder(pair); err != nil || len(inversions) != 1 {
+		t.Errorf("Failed test for CheckOrder! Error: %v inversions %v %v", pair, inversions, err)
+	}
+}
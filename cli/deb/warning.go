@@ -0,0 +1,34 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package deb
+
+import (
+	"fmt"
+
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+// 转换时需要打包者检查的警告，输出到日志的同时记录下来，写入转换报告
+type Warnings []string
+
+// 输出警告日志并记录，w 为 nil 时只输出日志。依赖会解析多次，同样的警告只记录一次
+func (w *Warnings) Warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Logger.Warn(msg)
+	if w != nil {
+		w.add(msg)
+	}
+}
+
+// 添加已经输出过日志的警告，跳过重复的
+func (w *Warnings) add(msgs ...string) {
+	for _, msg := range msgs {
+		if !contains(*w, msg) {
+			*w = append(*w, msg)
+		}
+	}
+}
@@ -10,9 +10,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
 
+	"github.com/aptly-dev/aptly/deb"
 	"gopkg.in/yaml.v3"
 	"pkg.deepin.com/linglong/pica/cli/comm"
 	"pkg.deepin.com/linglong/pica/tools/fs"
@@ -83,6 +85,12 @@ sources:
   {{- else}}
     digest: {{.Digest}}
   {{- end}}
+  {{- if .Origin}}
+    # from {{.Origin}}
+  {{- end}}
+  {{- if .SignedBy}}
+    # signed by {{.SignedBy}}
+  {{- end}}
 {{end}}
 {{- end}}
 build: |
@@ -116,30 +124,26 @@ func NewLinglongCli() *LinglongCli {
 }
 
 // create linglong.yaml
-func (ts *LinglongBuilder) CreateLinglongYaml(path string) bool {
-
+func (ts *LinglongBuilder) CreateLinglongYaml(path string) error {
 	tpl, err := template.New("linglong").Parse(LinglongBuilderTMPL)
-
 	if err != nil {
-		log.Logger.Fatalf("parse deb shell template failed! ", err)
-		return false
+		return comm.NewStageError(comm.StageGenerate, path, fmt.Errorf("parse template: %w", err))
 	}
 
 	// create save file
 	log.Logger.Debug("create save file: ", path)
-	saveFd, ret := os.Create(path)
-	if ret != nil {
-		log.Logger.Fatalf("save to %s failed!", path)
-		return false
+	saveFd, err := os.Create(path)
+	if err != nil {
+		return comm.NewStageError(comm.StageGenerate, path, err)
 	}
 	defer saveFd.Close()
 
 	// render template
 	log.Logger.Debug("render template: ", ts)
-	tpl.Execute(saveFd, ts)
-
-	return true
-
+	if err := tpl.Execute(saveFd, ts); err != nil {
+		return comm.NewStageError(comm.StageGenerate, path, err)
+	}
+	return nil
 }
 
 // read linglong.yaml
@@ -177,7 +181,7 @@ func (ts *LinglongBuilder) CreateLinglongBuilder(path string) bool {
 
 	// caller ll-builder build
 	if ret, msg, err := comm.ExecAndWait(10, "ll-builder", "build"); err != nil {
-		log.Logger.Fatalf("ll-builder failed: ", err, msg, ret)
+		log.Logger.Errorf("ll-builder failed: %s %s %s", err, msg, ret)
 		return false
 	} else {
 		log.Logger.Infof("ll-builder succeeded: ", path, ret)
@@ -186,28 +190,28 @@ func (ts *LinglongBuilder) CreateLinglongBuilder(path string) bool {
 }
 
 // 调用 ll-builder build
-func (ts *LinglongBuilder) LinglongBuild(path string, cmd string) bool {
-	if ret, msg, err := comm.ExecAndWait(1<<11, "sh", "-c",
-		fmt.Sprintf("cd %s && %s", path, cmd)); err != nil {
-		log.Logger.Fatalf("msg: %+v err:%+v, out: %+v", msg, err, ret)
-	} else {
-		log.Logger.Infof("msg: %+v err:%+v, out: %+v", msg, err, ret)
+func (ts *LinglongBuilder) LinglongBuild(path string, cmd string) error {
+	ret, msg, err := comm.ExecAndWait(1<<11, "sh", "-c", fmt.Sprintf("cd %s && %s", path, cmd))
+	if err != nil {
+		log.Logger.Debugf("msg: %+v err:%+v, out: %+v", msg, err, ret)
+		return comm.NewStageError(comm.StageBuild, path, fmt.Errorf("%s: %w: %s", cmd, err, strings.TrimSpace(msg)))
 	}
-	return true
+	log.Logger.Infof("msg: %+v err:%+v, out: %+v", msg, err, ret)
+	return nil
 }
 
-func (ts *LinglongBuilder) LinglongExport(path string, exportFile string) bool {
+func (ts *LinglongBuilder) LinglongExport(path string, exportFile string) error {
 	runCmd := "ll-builder export"
 	if exportFile == "layer" {
 		runCmd += " --layer"
 	}
 	// caller ll-builder export --local
-	if ret, msg, err := comm.ExecAndWait(1<<20, "sh", "-c",
-		fmt.Sprintf("cd %s && %s", path, runCmd)); err != nil {
-		log.Logger.Fatalf("msg: %+v err:%+v, out: %+v", msg, err, ret)
-	} else {
-		log.Logger.Infof("%s export success.", path)
+	ret, msg, err := comm.ExecAndWait(1<<20, "sh", "-c", fmt.Sprintf("cd %s && %s", path, runCmd))
+	if err != nil {
+		log.Logger.Debugf("msg: %+v err:%+v, out: %+v", msg, err, ret)
+		return comm.NewStageError(comm.StageExport, path, fmt.Errorf("%s: %w: %s", runCmd, err, strings.TrimSpace(msg)))
 	}
+	log.Logger.Infof("%s export success.", path)
 
 	// chmod 755 uab
 	// if bundleList, err := fs.FindBundlePath(appExportPath); err != nil {
@@ -222,7 +226,7 @@ func (ts *LinglongBuilder) LinglongExport(path string, exportFile string) bool {
 	// 		}
 	// 	}
 	// }
-	return true
+	return nil
 }
 
 func (cli *LinglongCli) LinglongCliInfo(appid string) {
@@ -238,72 +242,82 @@ func (cli *LinglongCli) LinglongCliInfo(appid string) {
 }
 
 // 获取 base 里面安装的包列表
-func (cli *LinglongCli) GetBaseInsPack() []string {
-	var packages []string
+func (cli *LinglongCli) GetBaseInsPack() *deb.PackageList {
+	dir := cli.GetBaseFilesDir()
+	if dir == "" {
+		return deb.NewPackageList()
+	}
+	return readInstalledPackages(filepath.Join(dir, "var/lib/dpkg/status"))
+}
 
+// 获取 runtime 里面安装的包列表
+func (cli *LinglongCli) GetRuntimeInsPack() *deb.PackageList {
+	dir := cli.GetRuntimeFilesDir()
+	if dir == "" {
+		return deb.NewPackageList()
+	}
+	return readInstalledPackages(filepath.Join(dir, "packages.list"))
+}
+
+// 获取 base 的文件目录，未安装时先安装
+func (cli *LinglongCli) GetBaseFilesDir() string {
 	// 读取 pica 的配置
 	config := comm.NewConfig()
 	config.ReadConfigJson()
 
 	cli.LinglongCliInstall(config.BaseId, config.BaseVersion)
 
-	// 先检查文件是否存在
 	commit := comm.GetBaseRuntimeCommit(config.BaseId, config.BaseVersion)
 	if commit == "" {
 		log.Logger.Warnf("failed to get base commit for %s/%s", config.BaseId, config.BaseVersion)
-		return packages
+		return ""
 	}
-
-	statusFile := fmt.Sprintf("/var/lib/linglong/layers/%s/files/var/lib/dpkg/status", commit)
-	if ret, _ := fs.CheckFileExits(statusFile); !ret {
-		log.Logger.Warnf("status file not found: %s", statusFile)
-		return packages
-	}
-
-	if ret, msg, err := comm.ExecAndWait(60, "sh", "-c",
-		fmt.Sprintf("cat %s | awk -F': ' '/^Package: /{a=a\",\"$2} END{sub(/^,/,\"\",a);printf a}'", statusFile)); err != nil {
-		log.Logger.Warnf("cat dpkg/status error: %s", msg)
-		return packages
-	} else {
-		// 只有当 ret 不为空时才处理
-		if strings.TrimSpace(ret) != "" {
-			packages = append(packages, strings.Split(ret, ",")...)
-		}
-	}
-	return packages
+	return fmt.Sprintf("/var/lib/linglong/layers/%s/files", commit)
 }
 
-// 获取 runtime 里面安装的包列表
-func (cli *LinglongCli) GetRuntimeInsPack() []string {
-	var packages []string
-
+// 获取 runtime 的文件目录，未安装时先安装
+func (cli *LinglongCli) GetRuntimeFilesDir() string {
 	// 读取 pica 的配置
 	config := comm.NewConfig()
 	config.ReadConfigJson()
 
 	cli.LinglongCliInstall(config.Id, config.Version)
 
-	// 先检查文件是否存在
 	commit := comm.GetBaseRuntimeCommit(config.Id, config.Version)
 	if commit == "" {
 		log.Logger.Warnf("failed to get runtime commit for %s/%s", config.Id, config.Version)
-		return packages
+		return ""
 	}
+	return fmt.Sprintf("/var/lib/linglong/layers/%s/files", commit)
+}
+
+// 读取 dpkg status 格式的包列表文件，保留包名、版本和 Provides 等信息
+func readInstalledPackages(path string) *deb.PackageList {
+	packages := deb.NewPackageList()
 
-	packagesFile := fmt.Sprintf("/var/lib/linglong/layers/%s/files/packages.list", commit)
-	if ret, _ := fs.CheckFileExits(packagesFile); !ret {
-		log.Logger.Warnf("packages.list file not found: %s", packagesFile)
+	fd, err := os.Open(path)
+	if err != nil {
+		log.Logger.Warnf("package list not found: %s", path)
 		return packages
 	}
+	defer fd.Close()
 
-	if ret, msg, err := comm.ExecAndWait(60, "sh", "-c",
-		fmt.Sprintf("cat %s | awk -F': ' '/^Package: /{a=a\",\"$2} END{sub(/^,/,\"\",a);printf a}'", packagesFile)); err != nil {
-		log.Logger.Warnf("cat runtime/package.list error: %s", msg)
-		return packages
-	} else {
-		// 只有当 ret 不为空时才处理
-		if strings.TrimSpace(ret) != "" {
-			packages = append(packages, strings.Split(ret, ",")...)
+	reader := deb.NewControlFileReader(fd, false, false)
+	for {
+		stanza, err := reader.ReadStanza()
+		if err != nil {
+			log.Logger.Warnf("read %s error: %s", path, err)
+			break
+		}
+		if stanza == nil {
+			break
+		}
+		// 跳过已卸载只保留配置文件的包
+		if status, ok := stanza["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			continue
+		}
+		if err := packages.Add(deb.NewPackageFromControlFile(stanza)); err != nil {
+			log.Logger.Debugf("skip package in %s: %s", path, err)
 		}
 	}
 	return packages
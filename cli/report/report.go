@@ -0,0 +1,453 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/cli/deb"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+const (
+	ReportJson     = "report.json"
+	ReportMarkdown = "report.md"
+
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped" // linglong.yaml 已经存在，没有重新转换
+)
+
+// 单个应用的 markdown 报告
+const appTMPL = `## {{.Id}} ({{.Arch}})
+
+- status: {{.Status}}{{if .Error}}, exit code {{.ExitCode}}{{end}}
+{{- if .Error}}
+- error: {{.Error}}
+{{- end}}
+- path: {{.Path}}
+- duration: {{seconds .Seconds}}{{range .Stages}}, {{.Stage}} {{seconds .Seconds}}{{end}}
+{{- if .Command}}
+- command: ` + "`{{join .Command \" \"}}`" + `
+{{- end}}
+
+### Inputs
+
+| package | version | architecture | app store | sha256 |
+| ------- | ------- | ------------ | --------- | ------ |
+{{- range .Inputs}}
+| {{.Name}} | {{.Version}} | {{.Architecture}} | {{.FromAppStore}} | {{.SHA256}} |
+{{- end}}
+{{- if .Depends}}
+
+### Depends
+
+| package | version | origin |
+| ------- | ------- | ------ |
+{{- range .Depends}}
+| {{.Name}} | {{.Version}} | {{.Origin}} |
+{{- end}}
+{{- end}}
+{{- if .Skipped}}
+
+### Skipped depends
+
+| relation | satisfied by | reason |
+| -------- | ------------ | ------ |
+{{- range .Skipped}}
+| {{.Relation}} | {{.Package}} | {{.Reason}} |
+{{- end}}
+{{- end}}
+{{- if .Desktops}}
+
+### Desktop files
+{{range .Desktops}}
+- {{.File}} [{{.Group}}]: ` + "`{{join .Command \" \"}}`" + `{{if .Hidden}} (hidden){{end}}
+{{- end}}
+{{- end}}
+{{- if .DesktopEdits}}
+
+### Desktop changes
+{{range .DesktopEdits}}
+- {{.File}} [{{.Group}}] {{.Key}}: ` + "`{{.Old}}` => `{{.New}}`" + `
+{{- end}}
+{{- end}}
+{{- if .Rewrites}}
+
+### Rewritten scripts
+{{range .Rewrites}}
+- {{.File}} ({{.Kind}}): {{len .Changes}} lines
+{{- end}}
+{{- end}}
+{{- if .Warnings}}
+
+### Warnings
+{{range .Warnings}}
+- {{.}}
+{{- end}}
+{{- end}}
+{{- if .Artifacts}}
+
+### Artifacts
+{{range .Artifacts}}
+- {{.}}
+{{- end}}
+{{- end}}
+`
+
+const reportTMPL = `# ll-pica convert report
+
+{{template "app" .}}`
+
+const summaryTMPL = `# ll-pica convert report
+
+{{.Total}} apps, {{.Failed}} failed, {{.Skipped}} skipped.
+
+| id | arch | status | error |
+| -- | ---- | ------ | ----- |
+{{- range .Reports}}
+| {{.Id}} | {{.Arch}} | {{.Status}} | {{.Error}} |
+{{- end}}
+{{range .Reports}}
+{{template "app" .}}
+{{- end}}`
+
+// 输入的 deb 包
+type Input struct {
+	Name         string   `json:"name"`
+	Package      string   `json:"package"`
+	Type         string   `json:"type"`
+	Url          string   `json:"url"`
+	SHA256       string   `json:"sha256"`
+	Version      string   `json:"version"`
+	Linglong     string   `json:"linglong_version"`
+	Architecture string   `json:"architecture"`
+	FromAppStore bool     `json:"from_app_store"`
+	Lossy        []string `json:"lossy,omitempty"`
+}
+
+// 从仓库获取的依赖包
+type Depend struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+	Url          string `json:"url"`
+	SHA256       string `json:"sha256"`
+	Origin       string `json:"origin,omitempty"`
+}
+
+// 跳过的依赖，Reason 为 group、base、runtime 或者 blacklist
+type Skipped struct {
+	Relation string `json:"relation"`
+	Package  string `json:"package"`
+	Reason   string `json:"reason"`
+}
+
+type Provider struct {
+	Virtual    string   `json:"virtual"`
+	Package    string   `json:"package"`
+	Candidates []string `json:"candidates"`
+	Preferred  bool     `json:"preferred"`
+}
+
+type Library struct {
+	Soname   string   `json:"soname"`
+	NeededBy []string `json:"needed_by"`
+	Packages []string `json:"packages"`
+}
+
+type Desktop struct {
+	Package string   `json:"package"`
+	File    string   `json:"file"`
+	Group   string   `json:"group"`
+	Command []string `json:"command"`
+	Hidden  bool     `json:"hidden,omitempty"`
+}
+
+// desktop 文件中改写过的键，删除的键 new 为空
+type DesktopEdit struct {
+	Package string `json:"package"`
+	File    string `json:"file"`
+	Group   string `json:"group"`
+	Key     string `json:"key"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
+
+type Icon struct {
+	Package   string `json:"package"`
+	Desktop   string `json:"desktop"`
+	Value     string `json:"value"`
+	Source    string `json:"source,omitempty"`
+	Installed string `json:"installed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// 改写过的启动脚本
+type Rewrite struct {
+	Package string   `json:"package"`
+	File    string   `json:"file"`
+	Kind    string   `json:"kind"`
+	Changes []Change `json:"changes"`
+}
+
+type Change struct {
+	Line int    `json:"line"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// 维护者脚本中的命令
+type Script struct {
+	Package string `json:"package"`
+	Script  string `json:"script"`
+	Line    int    `json:"line"`
+	Command string `json:"command"`
+	Kind    string `json:"kind"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type Conflict struct {
+	Path     string   `json:"path"`
+	Packages []string `json:"packages"`
+}
+
+// 各个阶段的耗时，同一个阶段多次执行时累加
+type StageTime struct {
+	Stage   comm.Stage `json:"stage"`
+	Seconds float64    `json:"seconds"`
+}
+
+// 一个应用一个架构的转换报告
+type Report struct {
+	Id           string        `json:"id"`
+	Arch         string        `json:"arch"`
+	Path         string        `json:"path"`
+	Status       string        `json:"status"`
+	Error        string        `json:"error,omitempty"`
+	ExitCode     int           `json:"exit_code"`
+	Inputs       []Input       `json:"inputs"`
+	Command      []string      `json:"command,omitempty"`
+	Depends      []Depend      `json:"depends"`
+	Skipped      []Skipped     `json:"skipped"`
+	Providers    []Provider    `json:"providers,omitempty"`
+	Unsatisfied  []string      `json:"unsatisfied,omitempty"`
+	Libraries    []Library     `json:"missing_libraries,omitempty"`
+	Desktops     []Desktop     `json:"desktops"`
+	DesktopEdits []DesktopEdit `json:"desktop_changes,omitempty"`
+	Icons        []Icon        `json:"icons,omitempty"`
+	Rewrites     []Rewrite     `json:"rewrites,omitempty"`
+	Scripts      []Script      `json:"maintainer_scripts,omitempty"`
+	Conflicts    []Conflict    `json:"conflicts,omitempty"`
+	Warnings     []string      `json:"warnings"`
+	Stages       []StageTime   `json:"stages"`
+	Artifacts    []string      `json:"artifacts"`
+	Started      time.Time     `json:"started"`
+	Seconds      float64       `json:"seconds"`
+}
+
+// 多个应用的报告汇总
+type Summary struct {
+	Total   int       `json:"total"`
+	Failed  int       `json:"failed"`
+	Skipped int       `json:"skipped"`
+	Reports []*Report `json:"reports"`
+}
+
+func New(id, arch, path string) *Report {
+	return &Report{Id: id, Arch: arch, Path: path, Started: time.Now()}
+}
+
+// 开始一个阶段，返回的函数在阶段结束时调用
+func (r *Report) Start(stage comm.Stage) func() {
+	begin := time.Now()
+	return func() {
+		seconds := time.Since(begin).Seconds()
+		for idx := range r.Stages {
+			if r.Stages[idx].Stage == stage {
+				r.Stages[idx].Seconds += seconds
+				return
+			}
+		}
+		r.Stages = append(r.Stages, StageTime{Stage: stage, Seconds: seconds})
+	}
+}
+
+// 输出警告日志并记录到报告中
+func (r *Report) Warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Logger.Warn(msg)
+	r.Warnings = append(r.Warnings, msg)
+}
+
+func (r *Report) AddArtifact(path string) {
+	r.Artifacts = append(r.Artifacts, path)
+}
+
+// 从转换后的 deb 包组中收集输入、依赖、desktop 文件、改写的脚本等信息，以及其中需要检查的问题
+func (r *Report) Collect(group *deb.DebGroup) {
+	r.Inputs, r.Desktops, r.DesktopEdits, r.Icons, r.Rewrites, r.Scripts = nil, nil, nil, nil, nil, nil
+	for _, d := range group.Debs {
+		r.Inputs = append(r.Inputs, Input{
+			Name:         d.Name,
+			Package:      d.Package,
+			Type:         d.Type,
+			Url:          d.Ref,
+			SHA256:       d.Hash,
+			Version:      d.DebVersion,
+			Linglong:     d.Version,
+			Architecture: d.Architecture,
+			FromAppStore: d.FromAppStore,
+			Lossy:        d.Lossy,
+		})
+		for _, lossy := range d.Lossy {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("%s version %s => %s: %s", d.Name, d.DebVersion, d.Version, lossy))
+		}
+		for _, item := range d.Desktops {
+			r.Desktops = append(r.Desktops, Desktop{Package: d.Name, File: item.File, Group: item.Group, Command: item.Command, Hidden: item.Hidden})
+		}
+		for _, item := range d.DesktopEdits {
+			r.DesktopEdits = append(r.DesktopEdits, DesktopEdit{Package: d.Name, File: item.File, Group: item.Group, Key: item.Key, Old: item.Old, New: item.New})
+		}
+		for _, item := range d.Icons {
+			r.Icons = append(r.Icons, Icon{Package: d.Name, Desktop: item.Desktop, Value: item.Value, Source: item.Source, Installed: item.Installed, Error: item.Error})
+			if item.Error != "" {
+				r.Warnings = append(r.Warnings, fmt.Sprintf("%s icon %s in %s: %s", d.Name, item.Value, item.Desktop, item.Error))
+			}
+		}
+		for _, item := range d.Rewrites {
+			rewrite := Rewrite{Package: d.Name, File: item.File, Kind: item.Kind}
+			for _, change := range item.Changes {
+				rewrite.Changes = append(rewrite.Changes, Change{Line: change.Line, Old: change.Old, New: change.New})
+			}
+			r.Rewrites = append(r.Rewrites, rewrite)
+		}
+		for _, item := range d.Scripts {
+			r.Scripts = append(r.Scripts, Script{Package: d.Name, Script: item.Script, Line: item.Line, Command: item.Command, Kind: item.Kind, Reason: item.Reason})
+			if item.Kind == deb.ActionUnsupported {
+				r.Warnings = append(r.Warnings, fmt.Sprintf("%s %s:%d unsupported: %s (%s)", d.Name, item.Script, item.Line, item.Command, item.Reason))
+			}
+		}
+		r.Warnings = append(r.Warnings, d.Warnings...)
+	}
+	if len(group.Command) > 0 && strings.Join(group.Command, "") != "" {
+		r.Command = group.Command
+	}
+
+	r.Depends, r.Skipped, r.Providers, r.Libraries, r.Conflicts = nil, nil, nil, nil, nil
+	for _, item := range group.Depends {
+		r.Depends = append(r.Depends, Depend{Name: item.Name, Version: item.Version, Architecture: item.Architecture, Url: item.Url, SHA256: item.SHA256, Origin: item.Origin})
+	}
+	for _, item := range group.Skipped {
+		r.Skipped = append(r.Skipped, Skipped{Relation: item.Relation, Package: item.Package, Reason: item.Reason})
+	}
+	for _, item := range group.Providers {
+		r.Providers = append(r.Providers, Provider{Virtual: item.Virtual, Package: item.Package, Candidates: item.Candidates, Preferred: item.Preferred})
+	}
+	r.Unsatisfied = group.Unsatisfied
+	for _, item := range group.Unsatisfied {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("unsatisfiable depend %s", item))
+	}
+	for _, item := range group.Libraries {
+		r.Libraries = append(r.Libraries, Library{Soname: item.Soname, NeededBy: item.NeededBy, Packages: item.Packages})
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%s needed by %s not found", item.Soname, strings.Join(item.NeededBy, ", ")))
+	}
+	for _, item := range group.Conflicts {
+		r.Conflicts = append(r.Conflicts, Conflict{Path: item.Path, Packages: item.Packages})
+		r.Warnings = append(r.Warnings, fmt.Sprintf("%s conflicts between %s", item.Path, strings.Join(item.Packages, ", ")))
+	}
+	r.Warnings = append(r.Warnings, group.Warnings...)
+}
+
+// 记录转换结果，err 为 nil 并且没有跳过时为成功
+func (r *Report) Finish(err error) {
+	r.Seconds = time.Since(r.Started).Seconds()
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+		r.ExitCode = comm.ExitCode(err)
+		return
+	}
+	if r.Status == "" {
+		r.Status = StatusSuccess
+	}
+}
+
+// 写入 dir 下的 report.json，markdown 为 true 时同时写入 report.md
+func (r *Report) Write(dir string, markdown bool) error {
+	return write(dir, r, markdown, reportTMPL)
+}
+
+// 读取 dir 下的 report.json
+func Read(dir string) (*Report, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ReportJson))
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func NewSummary(reports []*Report) *Summary {
+	summary := &Summary{Total: len(reports), Reports: reports}
+	for _, r := range reports {
+		switch r.Status {
+		case StatusFailed:
+			summary.Failed++
+		case StatusSkipped:
+			summary.Skipped++
+		}
+	}
+	return summary
+}
+
+// 写入 dir 下汇总的 report.json，markdown 为 true 时同时写入 report.md
+func (s *Summary) Write(dir string, markdown bool) error {
+	return write(dir, s, markdown, summaryTMPL)
+}
+
+func write(dir string, data interface{}, markdown bool, tmpl string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ReportJson), append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	if !markdown {
+		return nil
+	}
+	tpl, err := template.New("app").Funcs(template.FuncMap{
+		"join":    strings.Join,
+		"seconds": func(value float64) string { return fmt.Sprintf("%.1fs", value) },
+	}).Parse(appTMPL)
+	if err != nil {
+		return err
+	}
+	if tpl, err = tpl.New("report").Parse(tmpl); err != nil {
+		return err
+	}
+	fd, err := os.Create(filepath.Join(dir, ReportMarkdown))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return tpl.Execute(fd, data)
+}
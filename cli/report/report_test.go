@@ -0,0 +1,115 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pkg.deepin.com/linglong/pica/cli/comm"
+	"pkg.deepin.com/linglong/pica/cli/deb"
+	"pkg.deepin.com/linglong/pica/tools/fs/desktop"
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+func init() {
+	log.Logger = log.InitLog()
+}
+
+func newTestGroup() *deb.DebGroup {
+	return &deb.DebGroup{
+		Id: "org.demo.app",
+		Debs: []*deb.Deb{{
+			Name:         "demo",
+			Package:      "demo",
+			Type:         "repo",
+			Ref:          "https://example.com/pool/demo_1.0-1_amd64.deb",
+			Hash:         "0123",
+			DebVersion:   "1.0-1",
+			Version:      "1.0.0.1",
+			Architecture: "amd64",
+			FromAppStore: true,
+			Desktops:     []deb.DesktopCommand{{File: "usr/share/applications/demo.desktop", Group: "Desktop Entry", Command: []string{"/opt/apps/org.demo.app/files/bin/demo", "%F"}}},
+			Rewrites:     []deb.ScriptRewrite{{File: "usr/bin/demo", Kind: deb.ScriptShell, Changes: []deb.LineChange{{Line: 2, Old: "/usr/lib/demo", New: "/opt/apps/org.demo.app/files/lib/demo"}}}},
+			Scripts:      []deb.ScriptAction{{Script: "postinst", Line: 3, Command: "systemctl enable demo", Kind: deb.ActionUnsupported, Reason: "service"}},
+			DesktopEdits: []deb.DesktopChange{{File: "usr/share/applications/demo.desktop", Change: desktop.Change{Group: "Desktop Entry", Key: "Exec", Old: "/usr/bin/demo %F", New: "/opt/apps/org.demo.app/files/bin/demo %F"}}},
+			Warnings:     deb.Warnings{"demo: icon demo.png is not square (png 64x48)"},
+		}},
+		Command:     []string{"/opt/apps/org.demo.app/files/bin/demo"},
+		Depends:     []deb.LockedPackage{{Name: "libfoo1", Version: "2.0", Architecture: "amd64", Origin: "main"}},
+		Skipped:     []deb.SkippedDepend{{Relation: "libc6 (>= 2.28)", Package: "libc6=2.28-10", Reason: deb.SkipReasonBase}},
+		Unsatisfied: []string{"libbar (>= 3)"},
+		Warnings:    deb.Warnings{"load repository vendor error: connection refused"},
+	}
+}
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	rep := New("org.demo.app", "amd64", dir)
+	done := rep.Start(comm.StageFetch)
+	done()
+	done = rep.Start(comm.StageFetch)
+	done()
+	rep.Warnf("skip building %s", "org.demo.app")
+	rep.Collect(newTestGroup())
+	rep.Finish(comm.NewStageError(comm.StageBuild, dir, errors.New("ll-builder build failed")))
+	if err := rep.Write(dir, true); err != nil {
+		t.Fatalf("Failed test for Write! Error: %s", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ReportJson))
+	if err != nil {
+		t.Fatalf("Failed test for Write! Error: %s", err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Failed test for Write! Error: %s", err)
+	}
+	if got.Status != StatusFailed || got.ExitCode != comm.ExitBuild {
+		t.Errorf("Failed test for Finish! Error: status %s exit code %d", got.Status, got.ExitCode)
+	}
+	if len(got.Stages) != 1 || got.Stages[0].Stage != comm.StageFetch {
+		t.Errorf("Failed test for Start! Error: stages %+v", got.Stages)
+	}
+	if len(got.Inputs) != 1 || !got.Inputs[0].FromAppStore || got.Inputs[0].SHA256 != "0123" {
+		t.Errorf("Failed test for Collect! Error: inputs %+v", got.Inputs)
+	}
+	if len(got.Skipped) != 1 || got.Skipped[0].Reason != deb.SkipReasonBase || len(got.Depends) != 1 {
+		t.Errorf("Failed test for Collect! Error: depends %+v skipped %+v", got.Depends, got.Skipped)
+	}
+	if len(got.Desktops) != 1 || len(got.Rewrites) != 1 || len(got.Rewrites[0].Changes) != 1 {
+		t.Errorf("Failed test for Collect! Error: desktops %+v rewrites %+v", got.Desktops, got.Rewrites)
+	}
+	if len(got.DesktopEdits) != 1 || got.DesktopEdits[0].Package != "demo" || got.DesktopEdits[0].Old != "/usr/bin/demo %F" {
+		t.Errorf("Failed test for Collect! Error: desktop changes %+v", got.DesktopEdits)
+	}
+	// 跳过构建、无法满足的依赖、不支持的维护者脚本命令，以及转换 deb 包和解析依赖时的警告
+	if len(got.Warnings) != 5 {
+		t.Errorf("Failed test for Collect! Error: warnings %v", got.Warnings)
+	}
+
+	markdown, err := os.ReadFile(filepath.Join(dir, ReportMarkdown))
+	if err != nil || !strings.Contains(string(markdown), "## org.demo.app (amd64)") || !strings.Contains(string(markdown), "libfoo1") ||
+		!strings.Contains(string(markdown), "Exec: `/usr/bin/demo %F` => `/opt/apps/org.demo.app/files/bin/demo %F`") {
+		t.Errorf("Failed test for Write! Error: %v\n%s", err, markdown)
+	}
+
+	skipped := New("org.demo.other", "amd64", dir)
+	skipped.Status = StatusSkipped
+	skipped.Finish(nil)
+	summary := NewSummary([]*Report{rep, skipped})
+	if summary.Total != 2 || summary.Failed != 1 || summary.Skipped != 1 {
+		t.Errorf("Failed test for NewSummary! Error: %+v", summary)
+	}
+	if err := summary.Write(filepath.Join(dir, "all"), true); err != nil {
+		t.Errorf("Failed test for Summary.Write! Error: %s", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"pkg.deepin.com/linglong/pica/cli"
+	"pkg.deepin.com/linglong/pica/cli/comm"
 	"pkg.deepin.com/linglong/pica/cli/command/commands"
 	"pkg.deepin.com/linglong/pica/tools/log"
 )
@@ -25,7 +26,8 @@ func main() {
 
 	if err := runPica(); err != nil {
 		log.Logger.Errorf("run pica failed: %v", err)
-		os.Exit(1)
+		// 按失败的阶段返回不同的退出码
+		os.Exit(comm.ExitCode(err))
 	}
 }
 
@@ -4,10 +4,10 @@ go 1.17
 
 require (
 	github.com/aptly-dev/aptly v1.5.0
-	github.com/smira/flag v0.0.0-20170926215700-695ea5e84e76
 	github.com/spf13/cobra v1.6.1
 	github.com/spf13/pflag v1.0.5
 	go.uber.org/zap v1.16.0
+	golang.org/x/crypto v0.9.0
 	gopkg.in/yaml.v3 v3.0.1
 	pault.ag/go/debian v0.16.0
 )
@@ -57,15 +57,16 @@ require (
 	github.com/prometheus/common v0.32.1 // indirect
 	github.com/prometheus/procfs v0.7.3 // indirect
 	github.com/smira/commander v0.0.0-20140515201010-f408b00e68d5 // indirect
+	github.com/smira/flag v0.0.0-20170926215700-695ea5e84e76 // indirect
 	github.com/smira/go-aws-auth v0.0.0-20180731211914-8b73995fd8d1 // indirect
 	github.com/smira/go-ftp-protocol v0.0.0-20140829150050-066b75c2b70d // indirect
 	github.com/smira/go-xz v0.0.0-20150414201226-0c531f070014 // indirect
 	github.com/syndtr/goleveldb v1.0.1-0.20190923125748-758128399b1d // indirect
 	github.com/ugorji/go/codec v1.2.7 // indirect
 	github.com/wsxiaoys/terminal v0.0.0-20160513160801-0940f3fc43a0 // indirect
+	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	go.uber.org/atomic v1.6.0 // indirect
 	go.uber.org/multierr v1.5.0 // indirect
-	golang.org/x/crypto v0.9.0 // indirect
 	golang.org/x/net v0.10.0 // indirect
 	golang.org/x/sys v0.8.0 // indirect
 	golang.org/x/term v0.8.0 // indirect
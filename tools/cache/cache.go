@@ -0,0 +1,350 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	blobsDir   = "sha256"
+	metaSuffix = ".json"
+	// linux 的 FICLONE ioctl，btrfs、xfs 等文件系统上共享数据块
+	ficlone = 0x40049409
+)
+
+// 按 SHA256 存放文件的缓存，文件通过硬链接或者 reflink 放到工作目录，多个 ll-pica 可以同时使用
+type Cache struct {
+	root string
+}
+
+// 缓存中的文件，Used 为最后一次使用的时间
+type Entry struct {
+	SHA256 string    `json:"sha256"`
+	Name   string    `json:"name"`
+	Url    string    `json:"url,omitempty"`
+	Size   int64     `json:"size"`
+	Added  time.Time `json:"added"`
+	Used   time.Time `json:"-"`
+}
+
+// 缓存中的文件内容与 SHA256 不一致
+type CorruptError struct {
+	SHA256 string
+	Got    string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("cache entry %s corrupted, got %s", e.SHA256, e.Got)
+}
+
+func New(root string) *Cache {
+	return &Cache{root: root}
+}
+
+func (c *Cache) Root() string {
+	return c.root
+}
+
+// 文件在缓存中的路径，按前两位分目录
+func (c *Cache) Path(sum string) string {
+	return filepath.Join(c.root, blobsDir, sum[:2], sum)
+}
+
+func validSum(sum string) bool {
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
+
+// 使用缓存时加共享锁，清理和校验时加排他锁，避免文件在链接前被删除
+func (c *Cache) lock(how int) (func(), error) {
+	if err := os.MkdirAll(c.root, 0755); err != nil {
+		return nil, err
+	}
+	fd, err := os.OpenFile(filepath.Join(c.root, "lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(fd.Fd()), how); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+		fd.Close()
+	}, nil
+}
+
+// 缓存中存在 sum 时链接到 dst 并更新使用时间，不存在时返回 false
+func (c *Cache) Link(sum, dst string) (bool, error) {
+	if !validSum(sum) {
+		return false, nil
+	}
+	unlock, err := c.lock(syscall.LOCK_SH)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	blob := c.Path(sum)
+	if _, err := os.Stat(blob); err != nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+	if err := linkFile(blob, dst); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	os.Chtimes(blob+metaSuffix, now, now)
+	return true, nil
+}
+
+// 将 src 加入缓存，sum 为空时计算 SHA256；src 的内容与 sum 不一致时返回 CorruptError
+func (c *Cache) Put(src, sum string, entry Entry) (string, error) {
+	got, size, err := hashFile(src)
+	if err != nil {
+		return "", err
+	}
+	if sum != "" && sum != got {
+		return "", &CorruptError{SHA256: sum, Got: got}
+	}
+	unlock, err := c.lock(syscall.LOCK_SH)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	blob := c.Path(got)
+	if _, err := os.Stat(blob); err == nil {
+		now := time.Now()
+		os.Chtimes(blob+metaSuffix, now, now)
+		return got, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return "", err
+	}
+	// 先写入临时文件再改名，同时加入同一个文件的进程不会看到不完整的文件
+	tmp := fmt.Sprintf("%s.%d.tmp", blob, os.Getpid())
+	if err := linkFile(src, tmp); err != nil {
+		return "", err
+	}
+	// 只读，避免通过工作目录中的硬链接修改缓存
+	os.Chmod(tmp, 0444)
+	entry.SHA256, entry.Size, entry.Added = got, size, time.Now()
+	if err := writeEntry(blob+metaSuffix, entry); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, blob); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return got, nil
+}
+
+func writeEntry(path string, entry Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 缓存中的所有文件，按最后使用时间从新到旧排序
+func (c *Cache) List() ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(filepath.Join(c.root, blobsDir), func(path string, item fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		name := item.Name()
+		if item.IsDir() || !validSum(name) {
+			return nil
+		}
+		entry := Entry{SHA256: name}
+		if data, err := os.ReadFile(path + metaSuffix); err == nil {
+			json.Unmarshal(data, &entry)
+		}
+		if info, err := os.Stat(path + metaSuffix); err == nil {
+			entry.Used = info.ModTime()
+		}
+		if info, err := item.Info(); err == nil {
+			entry.Size = info.Size()
+			if entry.Used.IsZero() {
+				entry.Used = info.ModTime()
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Used.After(entries[j].Used)
+	})
+	return entries, err
+}
+
+// 缓存的文件数和总大小
+func (c *Cache) Du() (int, int64, error) {
+	entries, err := c.List()
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+	return len(entries), size, err
+}
+
+// 删除超过 olderThan 没有使用的文件，返回删除的文件
+func (c *Cache) Prune(olderThan time.Duration) ([]Entry, error) {
+	unlock, err := c.lock(syscall.LOCK_EX)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []Entry
+	deadline := time.Now().Add(-olderThan)
+	for _, entry := range entries {
+		if entry.Used.After(deadline) {
+			continue
+		}
+		if err := c.remove(entry.SHA256); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+	c.cleanTemp()
+	return removed, nil
+}
+
+// 重新计算所有文件的 SHA256，删除内容不一致的文件，返回对应的错误
+func (c *Cache) Verify() ([]*CorruptError, error) {
+	unlock, err := c.lock(syscall.LOCK_EX)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var corrupted []*CorruptError
+	for _, entry := range entries {
+		got, _, err := hashFile(c.Path(entry.SHA256))
+		if err != nil {
+			return corrupted, err
+		}
+		if got == entry.SHA256 {
+			continue
+		}
+		corrupted = append(corrupted, &CorruptError{SHA256: entry.SHA256, Got: got})
+		if err := c.remove(entry.SHA256); err != nil {
+			return corrupted, err
+		}
+	}
+	return corrupted, nil
+}
+
+func (c *Cache) remove(sum string) error {
+	blob := c.Path(sum)
+	if err := os.Remove(blob + metaSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(blob); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// 删除中断的进程留下的临时文件，持有排他锁时没有进程在写入
+func (c *Cache) cleanTemp() {
+	filepath.WalkDir(filepath.Join(c.root, blobsDir), func(path string, item fs.DirEntry, err error) error {
+		if err == nil && !item.IsDir() && (strings.HasSuffix(path, ".tmp") || strings.HasSuffix(path, ".link")) {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// 依次尝试硬链接、reflink 和复制，dst 已经存在时替换
+func linkFile(src, dst string) error {
+	tmp := fmt.Sprintf("%s.%d.link", dst, os.Getpid())
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		if err := cloneFile(src, tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// 不支持 reflink 的文件系统上复制文件
+func cloneFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd()); errno != 0 {
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
+
+func hashFile(path string) (string, int64, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer fd.Close()
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, fd)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
@@ -0,0 +1,78 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := New(t.TempDir())
+	work := t.TempDir()
+	src := filepath.Join(work, "app1/libqt5_5.15_amd64.deb")
+	os.MkdirAll(filepath.Dir(src), 0755)
+	os.WriteFile(src, []byte("libqt5"), 0644)
+
+	sum, err := c.Put(src, "", Entry{Name: "libqt5_5.15_amd64.deb"})
+	if err != nil {
+		t.Fatalf("Failed test for Put! Error: %s", err)
+	}
+	if _, err := c.Put(src, "0000000000000000000000000000000000000000000000000000000000000000", Entry{}); err == nil {
+		t.Errorf("Failed test for Put! Error: wrong sha256 accepted")
+	}
+
+	// 多个进程同时链接到各自的工作目录
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dst := filepath.Join(work, "app", string(rune('a'+i)), "libqt5_5.15_amd64.deb")
+			if ok, err := c.Link(sum, dst); !ok || err != nil {
+				t.Errorf("Failed test for Link! Error: %v %v", ok, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	var blob, linked syscall.Stat_t
+	syscall.Stat(c.Path(sum), &blob)
+	syscall.Stat(filepath.Join(work, "app/a/libqt5_5.15_amd64.deb"), &linked)
+	if blob.Ino != linked.Ino {
+		t.Errorf("Failed test for Link! Error: not hardlinked")
+	}
+	if ok, _ := c.Link("1111111111111111111111111111111111111111111111111111111111111111", filepath.Join(work, "missing.deb")); ok {
+		t.Errorf("Failed test for Link! Error: missing entry linked")
+	}
+
+	entries, err := c.List()
+	if err != nil || len(entries) != 1 || entries[0].Name != "libqt5_5.15_amd64.deb" || entries[0].Size != 6 {
+		t.Fatalf("Failed test for List! Error: %v %+v", err, entries)
+	}
+
+	// 内容被修改的文件在校验时删除
+	os.Chmod(c.Path(sum), 0644)
+	os.WriteFile(c.Path(sum), []byte("broken"), 0644)
+	if corrupted, err := c.Verify(); err != nil || len(corrupted) != 1 {
+		t.Errorf("Failed test for Verify! Error: %v %v", err, corrupted)
+	}
+
+	c.Put(src, "", Entry{Name: "libqt5_5.15_amd64.deb"})
+	if removed, err := c.Prune(time.Hour); err != nil || len(removed) != 0 {
+		t.Errorf("Failed test for Prune! Error: recently used entry removed %v %v", err, removed)
+	}
+	if removed, err := c.Prune(0); err != nil || len(removed) != 1 {
+		t.Errorf("Failed test for Prune! Error: %v %v", err, removed)
+	}
+	if count, _, _ := c.Du(); count != 0 {
+		t.Errorf("Failed test for Du! Error: %d entries left", count)
+	}
+}
@@ -0,0 +1,304 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pkg.deepin.com/linglong/pica/tools/log"
+)
+
+const (
+	DefaultRetries = 3           // 每个地址失败后的重试次数
+	DefaultBackoff = time.Second // 第一次重试前的等待时间，之后每次翻倍
+
+	// 两次进度回调之间的最小间隔
+	progressInterval = 500 * time.Millisecond
+	// 未下载完成的文件后缀，下次下载时从断点继续
+	partSuffix = ".part"
+)
+
+// 下载进度，Total 未知时为 -1
+type Progress struct {
+	Url        string
+	Downloaded int64
+	Total      int64
+}
+
+// 仓库地址的镜像，以 Source 开头的地址下载失败时依次替换为 Urls 中的地址
+type Mirror struct {
+	Source string
+	Urls   []string
+}
+
+type Options struct {
+	Retries  int           // 为 0 时使用 DefaultRetries，小于 0 时不重试
+	Backoff  time.Duration // 为 0 时使用 DefaultBackoff
+	Proxy    string        // http 代理，为空时使用 http_proxy、https_proxy 环境变量
+	Mirrors  []Mirror
+	Progress func(Progress)
+}
+
+// 下载请求，SHA256 不为空时下载过程中计算校验值，不一致时返回 ChecksumError
+type Request struct {
+	Url    string // http(s)、file:// 地址或者本地路径
+	Dest   string
+	SHA256 string
+}
+
+// 服务器返回错误的状态码
+type HTTPError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("download %s: %d %s", e.Url, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// 下载的内容与期望的校验值不一致
+type ChecksumError struct {
+	Url  string
+	Want string
+	Got  string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: want %s, got %s", e.Url, e.Want, e.Got)
+}
+
+// 下载器，可以在多个 goroutine 中同时使用
+type Downloader struct {
+	options Options
+	client  *http.Client
+}
+
+func New(options Options) (*Downloader, error) {
+	if options.Retries == 0 {
+		options.Retries = DefaultRetries
+	} else if options.Retries < 0 {
+		options.Retries = 0
+	}
+	if options.Backoff == 0 {
+		options.Backoff = DefaultBackoff
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Minute
+	if options.Proxy != "" {
+		proxy, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %s: %w", options.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &Downloader{options: options, client: &http.Client{Transport: transport}}, nil
+}
+
+// 下载文件，地址失败时依次使用镜像，每个地址按退避时间重试
+func (d *Downloader) Fetch(req Request) error {
+	if err := os.MkdirAll(filepath.Dir(req.Dest), 0755); err != nil {
+		return err
+	}
+	var lastErr error
+	for _, item := range d.urls(req.Url) {
+		err := d.fetchURL(item, req)
+		if err == nil {
+			return nil
+		}
+		log.Logger.Debugf("download %s error: %s", item, err)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// 地址本身以及镜像中对应的地址
+func (d *Downloader) urls(rawURL string) []string {
+	result := []string{rawURL}
+	for _, mirror := range d.options.Mirrors {
+		rest, ok := strings.CutPrefix(rawURL, strings.TrimSuffix(mirror.Source, "/")+"/")
+		if !ok {
+			continue
+		}
+		for _, item := range mirror.Urls {
+			result = append(result, strings.TrimSuffix(item, "/")+"/"+rest)
+		}
+	}
+	return result
+}
+
+// file:// 地址和不带协议的路径为本地文件
+func localPath(rawURL string) (string, bool) {
+	if local, ok := strings.CutPrefix(rawURL, "file://"); ok {
+		return local, true
+	}
+	return rawURL, !strings.Contains(rawURL, "://")
+}
+
+func (d *Downloader) fetchURL(rawURL string, req Request) error {
+	if local, ok := localPath(rawURL); ok {
+		return d.copyLocal(rawURL, local, req)
+	}
+	backoff := d.options.Backoff
+	var err error
+	for attempt := 0; attempt <= d.options.Retries; attempt++ {
+		if attempt > 0 {
+			log.Logger.Debugf("retry %s in %s: %s", rawURL, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = d.fetchHTTP(rawURL, req); err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// 校验值错误和 4xx 错误重试也不会成功，超时、429 和 5xx 错误需要重试
+func retryable(err error) bool {
+	var checksumErr *ChecksumError
+	if errors.As(err, &checksumErr) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusRequestedRangeNotSatisfiable, http.StatusTooManyRequests:
+			return true
+		}
+		return httpErr.StatusCode >= 500
+	}
+	return true
+}
+
+// 通过 http 下载，存在未完成的文件时使用 Range 从断点继续
+func (d *Downloader) fetchHTTP(rawURL string, req Request) error {
+	part := req.Dest + partSuffix
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+	httpReq, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	hasher := sha256.New()
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		// 已经下载的部分需要先计入校验值
+		if err := hashFile(part, hasher); err != nil {
+			return err
+		}
+		flag = os.O_WRONLY | os.O_APPEND
+		log.Logger.Debugf("resume %s from %d", rawURL, offset)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// 断点超出了文件大小，文件可能已经变化，删除后重新下载
+		os.Remove(part)
+		return &HTTPError{Url: rawURL, StatusCode: resp.StatusCode}
+	case resp.StatusCode != http.StatusOK:
+		return &HTTPError{Url: rawURL, StatusCode: resp.StatusCode}
+	default:
+		offset = 0
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	return d.write(rawURL, part, flag, resp.Body, hasher, offset, total, req)
+}
+
+// 复制本地文件，同样计算校验值
+func (d *Downloader) copyLocal(rawURL, local string, req Request) error {
+	in, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	total := int64(-1)
+	if info, err := in.Stat(); err == nil {
+		total = info.Size()
+	}
+	return d.write(rawURL, req.Dest+partSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, in, sha256.New(), 0, total, req)
+}
+
+// 写入未完成的文件，同时计算校验值和报告进度，校验通过后改名为目标文件。
+// 读取中断时保留未完成的文件，下次从断点继续
+func (d *Downloader) write(rawURL, part string, flag int, reader io.Reader, hasher hash.Hash, offset, total int64, req Request) error {
+	out, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return err
+	}
+	progress := &progressWriter{callback: d.options.Progress, progress: Progress{Url: rawURL, Downloaded: offset, Total: total}}
+	_, err = io.Copy(io.MultiWriter(out, hasher, progress), reader)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	progress.report()
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if req.SHA256 != "" && sum != req.SHA256 {
+		os.Remove(part)
+		return &ChecksumError{Url: rawURL, Want: req.SHA256, Got: sum}
+	}
+	return os.Rename(part, req.Dest)
+}
+
+func hashFile(path string, hasher hash.Hash) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	_, err = io.Copy(hasher, fd)
+	return err
+}
+
+// 统计写入的字节数，按间隔调用进度回调
+type progressWriter struct {
+	callback func(Progress)
+	progress Progress
+	last     time.Time
+}
+
+func (w *progressWriter) Write(data []byte) (int, error) {
+	w.progress.Downloaded += int64(len(data))
+	if w.callback != nil && time.Since(w.last) >= progressInterval {
+		w.report()
+	}
+	return len(data), nil
+}
+
+func (w *progressWriter) report() {
+	if w.callback != nil {
+		w.last = time.Now()
+		w.callback(w.progress)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testContent = bytes.Repeat([]byte("linglong-pica "), 1024)
+
+func testSum(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// 测试服务器，/flaky 前两次返回 503，/missing 返回 404，其他路径支持 Range
+func newTestServer(hits map[string]int, lock *sync.Mutex) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		hits[r.URL.Path]++
+		count := hits[r.URL.Path]
+		if r.Header.Get("Range") != "" {
+			hits["range"]++
+		}
+		lock.Unlock()
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/missing"):
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/flaky") && count <= 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(testContent))
+		}
+	}))
+}
+
+var testDataFetch = []struct {
+	name    string
+	path    string
+	sha256  string
+	part    []byte // 上次中断时已经下载的部分
+	mirrors bool
+	err     string
+}{
+	{"plain", "/pool/foo.deb", testSum(testContent), nil, false, ""},
+	{"retry", "/flaky/foo.deb", testSum(testContent), nil, false, ""},
+	{"resume", "/pool/foo.deb", testSum(testContent), testContent[:100], false, ""},
+	{"mirror", "/missing/pool/foo.deb", testSum(testContent), nil, true, ""},
+	{"not found", "/missing/pool/foo.deb", "", nil, false, "http"},
+	{"checksum", "/pool/foo.deb", testSum([]byte("other")), nil, false, "checksum"},
+}
+
+func TestFetch(t *testing.T) {
+	hits := make(map[string]int)
+	var lock sync.Mutex
+	server := newTestServer(hits, &lock)
+	defer server.Close()
+
+	var progress []Progress
+	downloader, err := New(Options{
+		Backoff:  time.Millisecond,
+		Progress: func(p Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("Failed test for New! Error: %s", err)
+	}
+
+	for _, tds := range testDataFetch {
+		dst := filepath.Join(t.TempDir(), "foo.deb")
+		if tds.part != nil {
+			os.WriteFile(dst+partSuffix, tds.part, 0644)
+		}
+		downloader.options.Mirrors = nil
+		if tds.mirrors {
+			downloader.options.Mirrors = []Mirror{{Source: server.URL + "/missing", Urls: []string{server.URL}}}
+		}
+		err := downloader.Fetch(Request{Url: server.URL + tds.path, Dest: dst, SHA256: tds.sha256})
+
+		var httpErr *HTTPError
+		var checksumErr *ChecksumError
+		switch tds.err {
+		case "":
+			if data, _ := os.ReadFile(dst); err != nil || !bytes.Equal(data, testContent) {
+				t.Errorf("Failed test for Fetch %s! Error: %v", tds.name, err)
+			}
+		case "http":
+			if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+				t.Errorf("Failed test for Fetch %s! Error: want 404, got %v", tds.name, err)
+			}
+		case "checksum":
+			if _, statErr := os.Stat(dst + partSuffix); !errors.As(err, &checksumErr) || statErr == nil {
+				t.Errorf("Failed test for Fetch %s! Error: want ChecksumError, got %v", tds.name, err)
+			}
+		}
+	}
+	if hits["range"] != 1 {
+		t.Errorf("Failed test for Fetch! Error: want 1 range request, got %d", hits["range"])
+	}
+	if len(progress) == 0 || progress[len(progress)-1].Downloaded != int64(len(testContent)) {
+		t.Errorf("Failed test for Fetch! Error: unexpected progress %v", progress)
+	}
+
+	// 本地路径和 file:// 地址
+	src := filepath.Join(t.TempDir(), "bar.deb")
+	os.WriteFile(src, testContent, 0644)
+	for _, item := range []string{src, "file://" + src} {
+		dst := filepath.Join(t.TempDir(), "bar.deb")
+		if err := downloader.Fetch(Request{Url: item, Dest: dst, SHA256: testSum(testContent)}); err != nil {
+			t.Errorf("Failed test for Fetch %s! Error: %s", item, err)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+// desktop 文件的解析、校验和写回，参考 https://specifications.freedesktop.org/desktop-entry-spec/latest/
+package desktop
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// 主组的名称
+const EntryGroup = "Desktop Entry"
+
+// 动作组名称的前缀
+const ActionGroupPrefix = "Desktop Action "
+
+// 行的类型
+type LineKind int
+
+const (
+	LineBlank LineKind = iota
+	LineComment
+	LineEntry
+	LineInvalid
+)
+
+// 文件中的一行，Raw 为写回时的内容，未修改的行按原样写回
+type Line struct {
+	Kind   LineKind
+	Number int    // 行号，新增的行为 0
+	Raw    string // 不包含换行符
+	Key    string // 不包含本地化后缀
+	Locale string // Name[zh_CN] 中的 zh_CN
+	Value  string // 未处理转义的值
+}
+
+// 组内的键，包含本地化后缀
+func (l *Line) FullKey() string {
+	if l.Locale == "" {
+		return l.Key
+	}
+	return l.Key + "[" + l.Locale + "]"
+}
+
+// 一个组，保留组内所有行的顺序，包括注释、空行和重复的键
+type Group struct {
+	Name   string
+	Number int    // 组名所在的行号
+	Raw    string // 组名行
+	Lines  []*Line
+}
+
+// desktop 文件，允许存在重复的组，由 Validate 报告
+type File struct {
+	Header []*Line // 第一个组之前的注释和空行
+	Groups []*Group
+	// 最后一行没有换行符
+	noEOL bool
+}
+
+func New() *File {
+	return &File{}
+}
+
+// 解析 desktop 文件，不符合规范的行保留为 LineInvalid，由 Validate 报告
+func Parse(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	content := string(data)
+	if content == "" {
+		return f, nil
+	}
+	if strings.HasSuffix(content, "\n") {
+		content = content[:len(content)-1]
+	} else {
+		f.noEOL = true
+	}
+
+	var group *Group
+	for idx, raw := range strings.Split(content, "\n") {
+		number := idx + 1
+		text := strings.TrimSpace(raw)
+		switch {
+		case text == "":
+			f.appendLine(group, &Line{Kind: LineBlank, Number: number, Raw: raw})
+		case strings.HasPrefix(text, "#"):
+			f.appendLine(group, &Line{Kind: LineComment, Number: number, Raw: raw})
+		case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+			group = &Group{Name: text[1 : len(text)-1], Number: number, Raw: raw}
+			f.Groups = append(f.Groups, group)
+		default:
+			line := &Line{Kind: LineInvalid, Number: number, Raw: raw}
+			if key, value, ok := strings.Cut(text, "="); ok {
+				line.Kind = LineEntry
+				line.Key, line.Locale = splitKey(strings.TrimSpace(key))
+				line.Value = strings.TrimLeft(value, " \t")
+			}
+			f.appendLine(group, line)
+		}
+	}
+	return f, nil
+}
+
+func ParseFile(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+func (f *File) appendLine(group *Group, line *Line) {
+	if group == nil {
+		f.Header = append(f.Header, line)
+		return
+	}
+	group.Lines = append(group.Lines, line)
+}
+
+// Name[zh_CN] 拆分为 Name 和 zh_CN
+func splitKey(key string) (string, string) {
+	if idx := strings.Index(key, "["); idx > 0 && strings.HasSuffix(key, "]") {
+		return key[:idx], key[idx+1 : len(key)-1]
+	}
+	return key, ""
+}
+
+// 序列化为文件内容，未修改的文件与原文件完全相同
+func (f *File) Bytes() []byte {
+	var lines []string
+	for _, line := range f.Header {
+		lines = append(lines, line.Raw)
+	}
+	for _, group := range f.Groups {
+		lines = append(lines, group.Raw)
+		for _, line := range group.Lines {
+			lines = append(lines, line.Raw)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	content := strings.Join(lines, "\n")
+	if !f.noEOL {
+		content += "\n"
+	}
+	return []byte(content)
+}
+
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.Copy(w, bytes.NewReader(f.Bytes()))
+	return n, err
+}
+
+// 写入文件，文件已经存在时保留原有的权限
+func (f *File) Save(path string) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return os.WriteFile(path, f.Bytes(), perm)
+}
+
+// 文件内容是否为合法的 UTF-8
+func (f *File) ValidUTF8() bool {
+	return utf8.Valid(f.Bytes())
+}
+
+// 按名称查找组，存在重复的组时返回第一个
+func (f *File) Group(name string) *Group {
+	for _, group := range f.Groups {
+		if group.Name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+// [Desktop Entry] 组
+func (f *File) Entry() *Group {
+	return f.Group(EntryGroup)
+}
+
+// 在文件末尾添加组，组已经存在时返回已有的组
+func (f *File) AddGroup(name string) *Group {
+	if group := f.Group(name); group != nil {
+		return group
+	}
+	group := &Group{Name: name, Raw: "[" + name + "]"}
+	f.Groups = append(f.Groups, group)
+	return group
+}
+
+// 删除组，包括重复的组
+func (f *File) RemoveGroup(name string) {
+	var groups []*Group
+	for _, group := range f.Groups {
+		if group.Name != name {
+			groups = append(groups, group)
+		}
+	}
+	f.Groups = groups
+}
+
+// 所有组的名称，按文件中的顺序
+func (f *File) GroupNames() []string {
+	var names []string
+	for _, group := range f.Groups {
+		names = append(names, group.Name)
+	}
+	return names
+}
+
+// [Desktop Action xxx] 组，按文件中的顺序
+func (f *File) ActionGroups() []*Group {
+	var groups []*Group
+	for _, group := range f.Groups {
+		if strings.HasPrefix(group.Name, ActionGroupPrefix) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// 查找键所在的行，key 可以包含本地化后缀，存在重复的键时返回第一个
+func (g *Group) Lookup(key string) *Line {
+	name, locale := splitKey(key)
+	for _, line := range g.Lines {
+		if line.Kind == LineEntry && line.Key == name && line.Locale == locale {
+			return line
+		}
+	}
+	return nil
+}
+
+// 所有键，包含本地化后缀，按文件中的顺序去重
+func (g *Group) Keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, line := range g.Entries() {
+		if key := line.FullKey(); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// 组内的键值行
+func (g *Group) Entries() []*Line {
+	var lines []*Line
+	for _, line := range g.Lines {
+		if line.Kind == LineEntry {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// 未处理转义的值
+func (g *Group) Value(key string) (string, bool) {
+	if line := g.Lookup(key); line != nil {
+		return line.Value, true
+	}
+	return "", false
+}
+
+// string 和 localestring 类型的值，处理 \s \n \t \r \\ 转义
+func (g *Group) String(key string) string {
+	value, _ := g.Value(key)
+	return UnescapeString(value)
+}
+
+// 按照规范的本地化匹配顺序查找 localestring，例如 zh_CN.UTF-8 依次匹配 zh_CN、zh，最后使用不带后缀的值
+func (g *Group) LocaleString(key, locale string) string {
+	for _, candidate := range localeCandidates(locale) {
+		if value, ok := g.Value(key + "[" + candidate + "]"); ok {
+			return UnescapeString(value)
+		}
+	}
+	return g.String(key)
+}
+
+// boolean 类型的值，只有 true 为真
+func (g *Group) Bool(key string) bool {
+	value, _ := g.Value(key)
+	return value == "true"
+}
+
+// 以 ; 分隔的列表，\; 表示值中的分号
+func (g *Group) List(key string) []string {
+	value, _ := g.Value(key)
+	return SplitList(value)
+}
+
+// 设置未处理转义的值，键已经存在时只修改第一个，保留所在的位置
+func (g *Group) SetValue(key, value string) {
+	if line := g.Lookup(key); line != nil {
+		if line.Value != value {
+			line.Value = value
+			line.Raw = line.FullKey() + "=" + value
+		}
+		return
+	}
+	name, locale := splitKey(key)
+	line := &Line{Kind: LineEntry, Key: name, Locale: locale, Value: value}
+	line.Raw = line.FullKey() + "=" + value
+	// 新增的键放在最后一个键值行之后，保留组末尾的空行和注释
+	pos := len(g.Lines)
+	for pos > 0 && g.Lines[pos-1].Kind != LineEntry {
+		pos--
+	}
+	if pos == 0 {
+		pos = len(g.Lines)
+		for pos > 0 && g.Lines[pos-1].Kind == LineBlank {
+			pos--
+		}
+	}
+	g.Lines = append(g.Lines[:pos], append([]*Line{line}, g.Lines[pos:]...)...)
+}
+
+func (g *Group) Set(key, value string) {
+	g.SetValue(key, EscapeString(value))
+}
+
+func (g *Group) SetLocale(key, locale, value string) {
+	g.Set(key+"["+locale+"]", value)
+}
+
+func (g *Group) SetBool(key string, value bool) {
+	if value {
+		g.SetValue(key, "true")
+	} else {
+		g.SetValue(key, "false")
+	}
+}
+
+func (g *Group) SetList(key string, values []string) {
+	g.SetValue(key, JoinList(values))
+}
+
+// 删除键，包括重复的键
+func (g *Group) Delete(key string) {
+	name, locale := splitKey(key)
+	var lines []*Line
+	for _, line := range g.Lines {
+		if line.Kind == LineEntry && line.Key == name && line.Locale == locale {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	g.Lines = lines
+}
+
+// 本地化后缀的匹配顺序，lang_COUNTRY@MODIFIER、lang_COUNTRY、lang@MODIFIER、lang
+func localeCandidates(locale string) []string {
+	if idx := strings.Index(locale, "."); idx >= 0 {
+		// 去掉编码
+		rest := locale[idx:]
+		modifier := ""
+		if at := strings.Index(rest, "@"); at >= 0 {
+			modifier = rest[at:]
+		}
+		locale = locale[:idx] + modifier
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+	lang, modifier, _ := strings.Cut(locale, "@")
+	lang, country, _ := strings.Cut(lang, "_")
+
+	var candidates []string
+	if country != "" && modifier != "" {
+		candidates = append(candidates, lang+"_"+country+"@"+modifier)
+	}
+	if country != "" {
+		candidates = append(candidates, lang+"_"+country)
+	}
+	if modifier != "" {
+		candidates = append(candidates, lang+"@"+modifier)
+	}
+	return append(candidates, lang)
+}
+
+// 处理 string 类型的转义，不规范的转义保持原样
+func UnescapeString(value string) string {
+	var b strings.Builder
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) {
+			switch runes[i+1] {
+			case 's':
+				b.WriteRune(' ')
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			case 'r':
+				b.WriteRune('\r')
+			case '\\':
+				b.WriteRune('\\')
+			default:
+				// 例如 \" 只写了一个反斜杠
+				b.WriteRune(runes[i])
+				b.WriteRune(runes[i+1])
+			}
+			i++
+			continue
+		}
+		b.WriteRune(runes[i])
+	}
+	return b.String()
+}
+
+// 值开头的空格会被忽略，需要转义为 \s
+func EscapeString(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(value)
+	if strings.HasPrefix(value, " ") {
+		value = `\s` + value[1:]
+	}
+	return value
+}
+
+// 拆分列表，每一项再处理 string 类型的转义
+func SplitList(value string) []string {
+	var items []string
+	var item strings.Builder
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == ';':
+			item.WriteRune(';')
+			i++
+		case runes[i] == '\\' && i+1 < len(runes):
+			item.WriteRune(runes[i])
+			item.WriteRune(runes[i+1])
+			i++
+		case runes[i] == ';':
+			items = append(items, UnescapeString(item.String()))
+			item.Reset()
+		default:
+			item.WriteRune(runes[i])
+		}
+	}
+	// 最后一项后面的分号可以省略
+	if item.Len() > 0 {
+		items = append(items, UnescapeString(item.String()))
+	}
+	return items
+}
+
+// 拼接列表，以分号结尾
+func JoinList(values []string) string {
+	var b strings.Builder
+	for _, value := range values {
+		b.WriteString(strings.ReplaceAll(EscapeString(value), ";", `\;`))
+		b.WriteString(";")
+	}
+	return b.String()
+}
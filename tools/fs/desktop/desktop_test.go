@@ -0,0 +1,183 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package desktop
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDesktop = `# comment before group
+[Desktop Entry]
+Type=Application
+Name=Foo
+Name[zh_CN]=福
+Name[zh]=福福
+Comment = leading\sspace
+Keywords=a\;b;c;
+Exec=/usr/bin/foo %U
+Actions=new;
+
+[Desktop Action new]
+Name=New
+Exec=/usr/bin/foo --new
+[X-Foo]
+X-Key=1`
+
+func TestParseLossless(t *testing.T) {
+	f, err := Parse(strings.NewReader(testDesktop))
+	if err != nil {
+		t.Fatalf("Failed test for Parse! Error: %s", err)
+	}
+	if string(f.Bytes()) != testDesktop {
+		t.Errorf("Failed test for Parse! Error: not lossless\n%s", f.Bytes())
+	}
+	if names := strings.Join(f.GroupNames(), ","); names != "Desktop Entry,Desktop Action new,X-Foo" {
+		t.Errorf("Failed test for Parse! Error: groups %s", names)
+	}
+	if problems := f.Validate(); len(problems) != 0 {
+		t.Errorf("Failed test for Validate! Error: %v", problems)
+	}
+
+	entry := f.Entry()
+	if keys := strings.Join(entry.Keys(), ","); keys != "Type,Name,Name[zh_CN],Name[zh],Comment,Keywords,Exec,Actions" {
+		t.Errorf("Failed test for Keys! Error: %s", keys)
+	}
+	for locale, want := range map[string]string{"zh_CN.UTF-8": "福", "zh_TW": "福福", "en_US": "Foo", "": "Foo"} {
+		if ret := entry.LocaleString("Name", locale); ret != want {
+			t.Errorf("Failed test for LocaleString! Error: %s got %s", locale, ret)
+		}
+	}
+	if ret := entry.String("Comment"); ret != "leading space" {
+		t.Errorf("Failed test for String! Error: got %q", ret)
+	}
+	if ret := strings.Join(entry.List("Keywords"), "|"); ret != "a;b|c" {
+		t.Errorf("Failed test for List! Error: got %q", ret)
+	}
+
+	// 只有修改的行重新生成
+	entry.SetValue("Exec", "/opt/apps/org.foo/files/bin/foo %U")
+	entry.SetBool("Terminal", false)
+	want := strings.Replace(testDesktop, "Exec=/usr/bin/foo %U\nActions=new;\n", "Exec=/opt/apps/org.foo/files/bin/foo %U\nActions=new;\nTerminal=false\n", 1)
+	if string(f.Bytes()) != want {
+		t.Errorf("Failed test for SetValue! Error:\n%s", f.Bytes())
+	}
+}
+
+var testDataValidate = []struct {
+	in      string
+	message string
+}{
+	{"[X-Foo]\nA=1\n[Desktop Entry]\nType=Application\nName=a\nExec=a\n", "first group"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\n[Desktop Entry]\n", "duplicate group"},
+	{"[Desktop Entry]\nType=Application\nName=a\nName=b\nExec=a\n", "duplicate key"},
+	{"[Desktop Entry]\nType=Application\nExec=a\n", "required key"},
+	{"[Desktop Entry]\nType=Application\nName=a\n", "required key is missing for Application"},
+	{"[Desktop Entry]\nType=Link\nName=a\n", "required key is missing for Link"},
+	{"[Desktop Entry]\nType=Foo\nName=a\n", "unknown type"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\nTerminal=yes\n", "invalid boolean"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\nFoo=1\n", "unknown key"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\nEncoding=UTF-8\n", "deprecated key"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\nfoo_bar=1\n", "invalid key"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\nExec[zh_CN]=b\n", "not localizable"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\nCategories=Utility\n", "should end with"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a %x\n", "invalid field code"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a $HOME\n", "must be quoted"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=\"a\n", "unterminated quote"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\nActions=new;\n", "has no group"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\n[Desktop Action new]\nName=b\n", "not declared"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\n[Foo]\n", "unknown group"},
+	{"[Desktop Entry]\nType=Application\nName=a\nExec=a\nbroken line\n", "invalid line"},
+	{"[Desktop Entry]\nType=Application\nName=\xff\nExec=a\n", "invalid UTF-8"},
+}
+
+func TestValidate(t *testing.T) {
+	for _, tds := range testDataValidate {
+		f, _ := Parse(strings.NewReader(tds.in))
+		found := false
+		for _, problem := range f.Validate() {
+			if strings.Contains(problem.Message, tds.message) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Failed test for Validate! Error: %q expect %s, got %v", tds.in, tds.message, f.Validate())
+		}
+	}
+}
+
+var testDataParseExec = []struct {
+	in  string
+	out []string
+}{
+	{`/usr/bin/foo %U`, []string{"/usr/bin/foo", "%U"}},
+	{`env GDK_BACKEND=x11 /usr/bin/foo --name="a b" %F`, []string{"env", "GDK_BACKEND=x11", "/usr/bin/foo", "--name=a b", "%F"}},
+	{`"/opt/apps/org.foo/files/My App/foo" "say \\"hi\\""`, []string{"/opt/apps/org.foo/files/My App/foo", `say "hi"`}},
+	{`foo\sbar`, []string{"foo", "bar"}},
+}
+
+func TestParseExec(t *testing.T) {
+	for _, tds := range testDataParseExec {
+		ret, err := ParseExec(tds.in)
+		if err != nil || strings.Join(ret, "|") != strings.Join(tds.out, "|") {
+			t.Errorf("Failed test for ParseExec! Error: %s got %q %v", tds.in, ret, err)
+			continue
+		}
+		// 格式化后再解析结果不变
+		if again, err := ParseExec(FormatExec(ret)); err != nil || strings.Join(again, "|") != strings.Join(ret, "|") {
+			t.Errorf("Failed test for FormatExec! Error: %s got %q %v", FormatExec(ret), again, err)
+		}
+	}
+}
+
+var testDataRewrite = []struct {
+	in      string
+	options RewriteOptions
+	out     string
+	changes int
+}{
+	// 替换程序，保留 env 前缀、参数和域代码，删除 TryExec
+	{"[Desktop Entry]\nExec=env A=1 \"./My App\" --x %U\nTryExec=./My App\nIcon=foo\n", RewriteOptions{Exec: "/opt/apps/org.foo/files/bin/foo"},
+		"[Desktop Entry]\nExec=env A=1 /opt/apps/org.foo/files/bin/foo --x %U\nIcon=foo\n", 2},
+	// 改写路径和图标，其他组不变
+	{"[Desktop Entry]\nExec=/app/bin/foo %F\nTryExec=/app/bin/foo\nIcon[zh_CN]=/app/share/icons/foo.png\n[Foo]\nExec=/app/bin/foo\n", RewriteOptions{
+		MapPath: func(value string) string { return strings.Replace(value, "/app/", "/opt/apps/org.foo/files/", 1) },
+		MapIcon: func(value string) string { return "foo" },
+	}, "[Desktop Entry]\nExec=/opt/apps/org.foo/files/bin/foo %F\nTryExec=/opt/apps/org.foo/files/bin/foo\nIcon[zh_CN]=foo\n[Foo]\nExec=/app/bin/foo\n", 3},
+}
+
+func TestRewrite(t *testing.T) {
+	for _, tds := range testDataRewrite {
+		f, _ := Parse(strings.NewReader(tds.in))
+		changes, warnings := f.Rewrite(tds.options)
+		if string(f.Bytes()) != tds.out || len(changes) != tds.changes || len(warnings) != 0 {
+			t.Errorf("Failed test for Rewrite! Error: %q got %q %+v %v", tds.in, f.Bytes(), changes, warnings)
+		}
+	}
+}
+
+var testDataCutEnv = []struct {
+	in    string
+	name  string
+	value string
+	ok    bool
+}{
+	{"LD_LIBRARY_PATH=/app/lib", "LD_LIBRARY_PATH=", "/app/lib", true},
+	{"_A1=", "_A1=", "", true},
+	{"/app/bin/foo", "", "/app/bin/foo", false},
+	{"--name=foo", "", "--name=foo", false},
+	{"1A=x", "", "1A=x", false},
+}
+
+func TestCutEnv(t *testing.T) {
+	for _, tds := range testDataCutEnv {
+		name, value, ok := CutEnv(tds.in)
+		if name != tds.name || value != tds.value || ok != tds.ok {
+			t.Errorf("Failed test for CutEnv! Error: %s got %q %q %v", tds.in, name, value, ok)
+		}
+	}
+}
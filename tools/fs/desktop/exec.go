@@ -0,0 +1,149 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package desktop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Exec 中的域代码，%d %D %n %N %v %m 已经废弃
+var FieldCodes = map[string]bool{
+	"%f": true, "%F": true, "%u": true, "%U": true, "%i": true, "%c": true, "%k": true,
+	"%d": true, "%D": true, "%n": true, "%N": true, "%v": true, "%m": true,
+}
+
+var deprecatedFieldCodes = map[string]bool{
+	"%d": true, "%D": true, "%n": true, "%N": true, "%v": true, "%m": true,
+}
+
+// Exec 参数中需要加引号的保留字符
+const reservedChars = " \t\n\"'\\><~|&;$*?#()`"
+
+// 按照规范解析 Exec 的原始值，先处理字符串的转义，再处理参数的引号
+func ParseExec(value string) ([]string, error) {
+	value = UnescapeString(value)
+	var args []string
+	var arg strings.Builder
+	hasArg, quoted := false, false
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		if quoted {
+			switch {
+			case c == '\\' && i+1 < len(runes) && strings.ContainsRune("\"`$\\", runes[i+1]):
+				arg.WriteRune(runes[i+1])
+				i++
+			case c == '"':
+				quoted = false
+			default:
+				arg.WriteRune(c)
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t':
+			if hasArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				hasArg = false
+			}
+		case '"':
+			quoted = true
+			hasArg = true
+		default:
+			arg.WriteRune(c)
+			hasArg = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %s", value)
+	}
+	if hasArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty Exec")
+	}
+	return args, nil
+}
+
+// 将参数拼接为 Exec 的原始值，包含保留字符的参数加上引号
+func FormatExec(args []string) string {
+	var items []string
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, reservedChars) {
+			replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+			arg = `"` + replacer.Replace(arg) + `"`
+		}
+		items = append(items, arg)
+	}
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(strings.Join(items, " "))
+}
+
+// 去掉域代码，%% 转换为 %
+func CommandFromExec(args []string) []string {
+	var command []string
+	for _, arg := range args {
+		if FieldCodes[arg] {
+			continue
+		}
+		command = append(command, strings.ReplaceAll(arg, "%%", "%"))
+	}
+	return command
+}
+
+// 检查 Exec 的引号和域代码，返回错误和警告
+func checkExec(value string) (errs, warnings []string) {
+	args, err := ParseExec(value)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	// 未加引号的参数不能包含保留字符
+	quoted := false
+	runes := []rune(UnescapeString(value))
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case quoted && runes[i] == '\\':
+			i++
+		case runes[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.ContainsRune("\\><~|&;$*?#()`'", runes[i]):
+			errs = append(errs, fmt.Sprintf("reserved character %q must be quoted", runes[i]))
+		}
+	}
+	fileCodes := 0
+	for _, arg := range args {
+		for i := 0; i < len(arg); i++ {
+			if arg[i] != '%' {
+				continue
+			}
+			if i+1 >= len(arg) {
+				errs = append(errs, fmt.Sprintf("incomplete field code in %s", arg))
+				break
+			}
+			code := arg[i : i+2]
+			i++
+			switch {
+			case code == "%%":
+			case !FieldCodes[code]:
+				errs = append(errs, fmt.Sprintf("invalid field code %s", code))
+			case deprecatedFieldCodes[code]:
+				warnings = append(warnings, fmt.Sprintf("deprecated field code %s", code))
+			case arg != code:
+				// 域代码必须作为单独的参数
+				errs = append(errs, fmt.Sprintf("field code %s must be a standalone argument", code))
+			case strings.ContainsAny(code[1:], "fFuU"):
+				fileCodes++
+			}
+		}
+	}
+	if fileCodes > 1 {
+		errs = append(errs, "more than one of %f %F %u %U")
+	}
+	return errs, warnings
+}
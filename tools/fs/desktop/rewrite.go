@@ -0,0 +1,114 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package desktop
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var envPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// desktop 文件中一个键的改写，删除的键 New 为空
+type Change struct {
+	Group string `json:"group"`
+	Key   string `json:"key"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type RewriteOptions struct {
+	Exec    string              // 不为空时替换 Exec 中的程序，保留参数和域代码，同时删除 TryExec
+	MapPath func(string) string // 改写 Exec 的参数和 TryExec
+	MapIcon func(string) string // 改写 Icon，包括本地化的键
+}
+
+// 只改写 [Desktop Entry] 和 [Desktop Action xxx] 中的 Exec、TryExec 和 Icon，其他行保持不变。
+// 返回改写过的键，以及无法解析的 Exec
+func (f *File) Rewrite(options RewriteOptions) ([]Change, []string) {
+	var changes []Change
+	var warnings []string
+	for _, group := range f.Groups {
+		if group.Name != EntryGroup && !strings.HasPrefix(group.Name, ActionGroupPrefix) {
+			continue
+		}
+		for _, line := range group.Entries() {
+			value := line.Value
+			newValue := value
+			switch {
+			case line.Key == "Exec" && line.Locale == "":
+				args, err := ParseExec(value)
+				if err != nil {
+					warnings = append(warnings, fmt.Sprintf("[%s] Exec: %s", group.Name, err))
+					continue
+				}
+				changed := false
+				if options.Exec != "" {
+					if idx := programIndex(args); idx < len(args) && args[idx] != options.Exec {
+						args[idx] = options.Exec
+						changed = true
+					}
+				}
+				if options.MapPath != nil {
+					for i := range args {
+						if newArg := options.MapPath(args[i]); newArg != args[i] {
+							args[i] = newArg
+							changed = true
+						}
+					}
+				}
+				// 只在参数改变时重新生成，保留原有的引号和域代码
+				if changed {
+					newValue = FormatExec(args)
+				}
+			case line.Key == "TryExec" && line.Locale == "":
+				if options.Exec != "" {
+					newValue = ""
+				} else if options.MapPath != nil {
+					newValue = options.MapPath(value)
+				}
+			case line.Key == "Icon" && options.MapIcon != nil:
+				newValue = options.MapIcon(value)
+			}
+			if newValue == value {
+				continue
+			}
+			if newValue == "" {
+				group.Delete(line.FullKey())
+			} else {
+				group.SetValue(line.FullKey(), newValue)
+			}
+			changes = append(changes, Change{Group: group.Name, Key: line.FullKey(), Old: value, New: newValue})
+		}
+	}
+	return changes, warnings
+}
+
+// Exec 中程序所在的位置，跳过 env 和 VAR=x 前缀
+func programIndex(args []string) int {
+	idx := 0
+	if idx < len(args) && args[idx] == "env" {
+		idx++
+	}
+	for idx < len(args) {
+		if _, _, ok := CutEnv(args[idx]); !ok {
+			break
+		}
+		idx++
+	}
+	return idx
+}
+
+// 拆分 VAR=value 形式的参数，返回 VAR= 和值，不是这种形式时返回原参数和 false
+func CutEnv(arg string) (string, string, bool) {
+	loc := envPattern.FindStringIndex(arg)
+	if loc == nil {
+		return "", arg, false
+	}
+	return arg[:loc[1]], arg[loc[1]:], true
+}
@@ -0,0 +1,307 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package desktop
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// 问题的严重程度，与 desktop-file-validate 一致
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// 校验发现的问题
+type Problem struct {
+	Line     int // 所在的行号，新增的行或者整个文件的问题为 0
+	Group    string
+	Key      string
+	Severity string
+	Message  string
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", p.Line)
+	}
+	b.WriteString(p.Severity + ": ")
+	if p.Group != "" {
+		fmt.Fprintf(&b, "[%s] ", p.Group)
+	}
+	if p.Key != "" {
+		b.WriteString(p.Key + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// 值的类型
+type valueType int
+
+const (
+	typeString valueType = iota
+	typeLocaleString
+	typeIconString
+	typeBoolean
+	typeStrings
+	typeLocaleStrings
+)
+
+// [Desktop Entry] 中规范定义的键
+var entryKeys = map[string]valueType{
+	"Type": typeString, "Version": typeString, "Name": typeLocaleString, "GenericName": typeLocaleString,
+	"NoDisplay": typeBoolean, "Comment": typeLocaleString, "Icon": typeIconString, "Hidden": typeBoolean,
+	"OnlyShowIn": typeStrings, "NotShowIn": typeStrings, "DBusActivatable": typeBoolean, "TryExec": typeString,
+	"Exec": typeString, "Path": typeString, "Terminal": typeBoolean, "Actions": typeStrings,
+	"MimeType": typeStrings, "Categories": typeStrings, "Implements": typeStrings, "Keywords": typeLocaleStrings,
+	"StartupNotify": typeBoolean, "StartupWMClass": typeString, "URL": typeString,
+	"PrefersNonDefaultGPU": typeBoolean, "SingleMainWindow": typeBoolean,
+}
+
+// [Desktop Action xxx] 中规范定义的键
+var actionKeys = map[string]valueType{
+	"Name": typeLocaleString, "Icon": typeIconString, "Exec": typeString,
+}
+
+// 已经废弃的键
+var deprecatedKeys = map[string]bool{
+	"Encoding": true, "MiniIcon": true, "TerminalOptions": true, "Protocols": true, "Extensions": true,
+	"BinaryPattern": true, "MapNotify": true, "SwallowTitle": true, "SwallowExec": true, "SortOrder": true,
+	"FilePattern": true,
+}
+
+// 只在 Application 类型中有效的键
+var applicationKeys = map[string]bool{
+	"DBusActivatable": true, "TryExec": true, "Exec": true, "Path": true, "Terminal": true, "Actions": true,
+	"MimeType": true, "Categories": true, "Keywords": true, "StartupNotify": true, "StartupWMClass": true,
+	"PrefersNonDefaultGPU": true, "SingleMainWindow": true,
+}
+
+// 按照 desktop-file-validate 的规则校验文件，返回所有问题
+func (f *File) Validate() []Problem {
+	var problems []Problem
+	report := func(line int, group, key, severity, format string, args ...interface{}) {
+		problems = append(problems, Problem{Line: line, Group: group, Key: key, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !f.ValidUTF8() {
+		report(0, "", "", SeverityError, "file contains invalid UTF-8")
+	}
+	for _, line := range f.Header {
+		if line.Kind == LineEntry || line.Kind == LineInvalid {
+			report(line.Number, "", "", SeverityError, "key-value pair before the first group")
+		}
+	}
+	if len(f.Groups) == 0 || f.Groups[0].Name != EntryGroup {
+		report(0, "", "", SeverityError, "first group must be \"%s\"", EntryGroup)
+	}
+
+	seenGroups := make(map[string]bool)
+	for _, group := range f.Groups {
+		if seenGroups[group.Name] {
+			report(group.Number, group.Name, "", SeverityError, "duplicate group")
+		}
+		seenGroups[group.Name] = true
+		if strings.ContainsAny(group.Name, "[]") || !isPrintableASCII(group.Name) {
+			report(group.Number, group.Name, "", SeverityError, "invalid group name")
+		}
+
+		var known map[string]valueType
+		switch {
+		case group.Name == EntryGroup:
+			known = entryKeys
+		case strings.HasPrefix(group.Name, ActionGroupPrefix):
+			known = actionKeys
+		case !strings.HasPrefix(group.Name, "X-"):
+			report(group.Number, group.Name, "", SeverityError, "unknown group, extension groups must start with \"X-\"")
+		}
+		problems = append(problems, validateKeys(group, known)...)
+	}
+
+	if entry := f.Entry(); entry != nil {
+		problems = append(problems, f.validateEntry(entry)...)
+	}
+	return problems
+}
+
+// 校验组内的键和值的格式
+func validateKeys(group *Group, known map[string]valueType) []Problem {
+	var problems []Problem
+	report := func(line *Line, severity, format string, args ...interface{}) {
+		problems = append(problems, Problem{Line: line.Number, Group: group.Name, Key: line.FullKey(), Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range group.Lines {
+		if line.Kind == LineInvalid {
+			report(line, SeverityError, "invalid line %q, expect key=value", line.Raw)
+			continue
+		}
+		if line.Kind != LineEntry {
+			continue
+		}
+		if seen[line.FullKey()] {
+			report(line, SeverityError, "duplicate key")
+		}
+		seen[line.FullKey()] = true
+		if !validKey(line.Key) {
+			report(line, SeverityError, "invalid key, only A-Za-z0-9- are allowed")
+			continue
+		}
+		if strings.ContainsAny(line.Locale, "[]") {
+			report(line, SeverityError, "invalid locale")
+		}
+		if !utf8.ValidString(line.Value) {
+			report(line, SeverityError, "value is not valid UTF-8")
+		}
+		if known == nil || strings.HasPrefix(line.Key, "X-") {
+			continue
+		}
+		if deprecatedKeys[line.Key] {
+			report(line, SeverityWarning, "deprecated key")
+			continue
+		}
+		kind, ok := known[line.Key]
+		if !ok {
+			report(line, SeverityError, "unknown key, extension keys must start with \"X-\"")
+			continue
+		}
+		if line.Locale != "" && kind != typeLocaleString && kind != typeIconString && kind != typeLocaleStrings {
+			report(line, SeverityError, "key is not localizable")
+		}
+		switch kind {
+		case typeBoolean:
+			if line.Value != "true" && line.Value != "false" {
+				report(line, SeverityError, "invalid boolean %q, expect true or false", line.Value)
+			}
+		case typeString:
+			if !isPrintableASCII(line.Value) {
+				report(line, SeverityError, "value must be ASCII")
+			}
+		case typeStrings, typeLocaleStrings:
+			if line.Value != "" && !strings.HasSuffix(line.Value, ";") {
+				report(line, SeverityWarning, "list should end with \";\"")
+			}
+			if kind == typeStrings && !isPrintableASCII(line.Value) {
+				report(line, SeverityError, "value must be ASCII")
+			}
+		}
+		if line.Key == "Exec" {
+			errs, warnings := checkExec(line.Value)
+			for _, msg := range errs {
+				report(line, SeverityError, "%s", msg)
+			}
+			for _, msg := range warnings {
+				report(line, SeverityWarning, "%s", msg)
+			}
+		}
+	}
+	return problems
+}
+
+// 校验 [Desktop Entry] 中必需的键以及 Actions 与动作组的对应关系
+func (f *File) validateEntry(entry *Group) []Problem {
+	var problems []Problem
+	report := func(key, severity, format string, args ...interface{}) {
+		line := entry.Number
+		if l := entry.Lookup(key); l != nil {
+			line = l.Number
+		}
+		problems = append(problems, Problem{Line: line, Group: entry.Name, Key: key, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	typ, hasType := entry.Value("Type")
+	if !hasType {
+		report("Type", SeverityError, "required key is missing")
+	}
+	if _, ok := entry.Value("Name"); !ok {
+		report("Name", SeverityError, "required key is missing")
+	}
+	if value, ok := entry.Value("Version"); ok && value != "1.0" && value != "1.1" && value != "1.2" && value != "1.3" && value != "1.4" && value != "1.5" {
+		report("Version", SeverityError, "unknown version %q", value)
+	}
+
+	switch typ {
+	case "Application":
+		if _, ok := entry.Value("Exec"); !ok && !entry.Bool("DBusActivatable") {
+			report("Exec", SeverityError, "required key is missing for Application")
+		}
+	case "Link":
+		if _, ok := entry.Value("URL"); !ok {
+			report("URL", SeverityError, "required key is missing for Link")
+		}
+	case "Directory":
+	default:
+		if hasType {
+			report("Type", SeverityError, "unknown type %q", typ)
+		}
+	}
+	if typ != "Application" {
+		for _, key := range entry.Keys() {
+			if name, _ := splitKey(key); applicationKeys[name] {
+				report(key, SeverityError, "key is only valid for Application")
+			}
+		}
+	}
+	if _, ok := entry.Value("OnlyShowIn"); ok {
+		if _, ok := entry.Value("NotShowIn"); ok {
+			report("NotShowIn", SeverityError, "OnlyShowIn and NotShowIn should not be both present")
+		}
+	}
+
+	// Actions 中的每一项都要有对应的动作组，动作组也要在 Actions 中声明
+	declared := make(map[string]bool)
+	for _, action := range entry.List("Actions") {
+		declared[action] = true
+		if group := f.Group(ActionGroupPrefix + action); group == nil {
+			report("Actions", SeverityError, "action %q has no group \"%s%s\"", action, ActionGroupPrefix, action)
+		} else if _, ok := group.Value("Name"); !ok {
+			problems = append(problems, Problem{Line: group.Number, Group: group.Name, Key: "Name", Severity: SeverityError, Message: "required key is missing"})
+		}
+	}
+	for _, group := range f.ActionGroups() {
+		if !declared[strings.TrimPrefix(group.Name, ActionGroupPrefix)] {
+			problems = append(problems, Problem{Line: group.Number, Group: group.Name, Severity: SeverityError, Message: "action group is not declared in Actions"})
+		}
+	}
+	return problems
+}
+
+// 是否存在严重程度为 error 的问题
+func HasError(problems []Problem) bool {
+	for _, problem := range problems {
+		if problem.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func isPrintableASCII(value string) bool {
+	for _, c := range value {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
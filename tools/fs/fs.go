@@ -7,7 +7,6 @@
 package fs
 
 import (
-	"bufio"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -19,6 +18,7 @@ import (
 	"strings"
 	"syscall"
 
+	"pkg.deepin.com/linglong/pica/tools/fs/desktop"
 	"pkg.deepin.com/linglong/pica/tools/log"
 )
 
@@ -398,95 +398,29 @@ func HasBundleName(name string) bool {
 	return strings.HasSuffix(name, ".uab")
 }
 
-// 初始化desktop文件
+// 初始化desktop文件，完整的解析和写回使用 tools/fs/desktop
 type DesktopData map[string]map[string]string
 
-const (
-	GroupBegin uint32 = iota
-	KeyValue
-	Empty
-	Comments
-)
-
 func DesktopInit(desktopFilePath string) (bool, DesktopData) {
 	if ret, err := CheckFileExits(desktopFilePath); !ret && err != nil {
 		log.Logger.Errorw("desktop file not exists：", desktopFilePath)
 		return false, nil
 	}
-	file, err := os.Open(desktopFilePath)
+	file, err := desktop.ParseFile(desktopFilePath)
 	if err != nil {
-		log.Logger.Errorw("open file failed: ", desktopFilePath)
+		log.Logger.Errorw("Read file error! : ", desktopFilePath)
 		return false, nil
 	}
-	defer file.Close()
-	reader := bufio.NewReader(file)
-
-	lineType := func(line string) uint32 {
-		for _, c := range line {
-			switch c {
-			case '#':
-				return Comments
-			case '[':
-				return GroupBegin
-			case ' ':
-				break
-			case '=':
-				return KeyValue
-			case '\n':
-				break
-			default:
-				return KeyValue
-			}
+	// 重复的组合并，重复的键后面的覆盖前面的
+	data := make(DesktopData, len(file.Groups))
+	for _, group := range file.Groups {
+		if data[group.Name] == nil {
+			data[group.Name] = make(map[string]string)
 		}
-		return Empty
-	}
-
-	parseGroupKey := func(line string) string {
-		newLine := strings.Replace(line, "[", "", -1)
-		newLine = strings.Replace(newLine, "]", "", -1)
-		return newLine
-	}
-
-	parseKeyValue := func(line string) (string, string) {
-		value := strings.SplitN(line, "=", 2)
-		return value[0], value[1]
-	}
-	data := make(DesktopData, 10)
-	var groupName string
-
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				log.Logger.Debug("File read ok! : ", desktopFilePath)
-				break
-			} else {
-				log.Logger.Errorw("Read file error! : ", desktopFilePath)
-				return false, nil
-			}
-		}
-		// 去掉换行符号
-		line = strings.TrimRight(line, "\r\n")
-		switch lineType(line) {
-		case GroupBegin:
-			groupName = parseGroupKey(line)
-			break
-		case KeyValue:
-			key, value := parseKeyValue(line)
-			if data[groupName] == nil {
-				subMap := make(map[string]string, 200)
-				data[groupName] = subMap
-			}
-
-			data[groupName][key] = value
-
-			break
-		case Empty:
-		case Comments:
-			break
+		for _, line := range group.Entries() {
+			data[group.Name][line.FullKey()] = line.Value
 		}
 	}
-	//fmt.Printf("%v", data)
 	return true, data
 }
 
@@ -500,7 +434,6 @@ func DesktopGroupname(desktopFile string) []string {
 	groupNmaeList := []string{}
 	for name := range data {
 		groupNmaeList = append(groupNmaeList, name)
-		fmt.Printf("%s\n", data[name]["Exec"])
 	}
 	return groupNmaeList
 }
@@ -534,12 +467,14 @@ func TransIconToLl(iconValue string) string {
 func GetFileSha256(filename string) (string, error) {
 	log.Logger.Debug("GetFileSha256 :", filename)
 	hasher := sha256.New()
-	s, err := ioutil.ReadFile(filename)
+	// 按块读取计算校验值，不把整个文件读入内存
+	fd, err := os.Open(filename)
 	if err != nil {
 		log.Logger.Warn(err)
 		return "", err
 	}
-	_, err = hasher.Write(s)
+	defer fd.Close()
+	_, err = io.Copy(hasher, fd)
 	if err != nil {
 		log.Logger.Warn(err)
 		return "", err
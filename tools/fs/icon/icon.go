@@ -0,0 +1,152 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+// 图标文件的格式识别以及 hicolor 主题目录的布局，参考 https://specifications.freedesktop.org/icon-theme-spec/latest/
+package icon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 图标主题规范支持的格式
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+	FormatXPM = "xpm"
+)
+
+// hicolor 主题的 index.theme 中定义的固定尺寸目录
+var HicolorSizes = []int{16, 22, 24, 32, 36, 48, 64, 72, 96, 128, 192, 256, 512}
+
+// 图标文件的格式和尺寸，svg 没有尺寸
+type Info struct {
+	Format string
+	Width  int
+	Height int
+}
+
+// 按文件内容识别图标的格式和尺寸，不依赖文件后缀
+func Detect(path string) (*Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DetectBytes(data)
+}
+
+func DetectBytes(data []byte) (*Info, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		// IHDR 块固定为第一个块，宽高位于第 16 到 24 字节
+		if len(data) < 24 || string(data[12:16]) != "IHDR" {
+			return nil, fmt.Errorf("invalid png header")
+		}
+		return &Info{
+			Format: FormatPNG,
+			Width:  int(binary.BigEndian.Uint32(data[16:20])),
+			Height: int(binary.BigEndian.Uint32(data[20:24])),
+		}, nil
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("/* XPM */")):
+		return detectXPM(data)
+	case isSVG(data):
+		return &Info{Format: FormatSVG}, nil
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return nil, fmt.Errorf("compressed svg is not supported by the icon theme spec")
+	}
+	return nil, fmt.Errorf("unsupported icon format, expect png, svg or xpm")
+}
+
+// svg 文件开头可能有 xml 声明、注释和 DOCTYPE
+func isSVG(data []byte) bool {
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	head = bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	return bytes.HasPrefix(head, []byte("<")) && bytes.Contains(head, []byte("<svg"))
+}
+
+// xpm 的第一个字符串为 "宽 高 颜色数 每像素字符数"
+func detectXPM(data []byte) (*Info, error) {
+	start := bytes.IndexByte(data, '"')
+	if start < 0 {
+		return nil, fmt.Errorf("invalid xpm header")
+	}
+	end := bytes.IndexByte(data[start+1:], '"')
+	if end < 0 {
+		return nil, fmt.Errorf("invalid xpm header")
+	}
+	fields := strings.Fields(string(data[start+1 : start+1+end]))
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("invalid xpm header %q", data[start+1:start+1+end])
+	}
+	width, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid xpm width %s", fields[0])
+	}
+	height, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid xpm height %s", fields[1])
+	}
+	return &Info{Format: FormatXPM, Width: width, Height: height}, nil
+}
+
+// 文件后缀，与格式相同
+func (i *Info) Ext() string {
+	return "." + i.Format
+}
+
+// 是否为正方形，非正方形的图标在启动器中会被拉伸
+func (i *Info) Square() bool {
+	return i.Format == FormatSVG || i.Width == i.Height
+}
+
+// hicolor 主题中的尺寸目录，svg 放在 scalable 中，位图选择不超过图标尺寸的最大固定尺寸
+func (i *Info) SizeDir() string {
+	if i.Format == FormatSVG {
+		return "scalable"
+	}
+	size := i.Width
+	if i.Height > size {
+		size = i.Height
+	}
+	dir := HicolorSizes[0]
+	for _, item := range HicolorSizes {
+		if item <= size {
+			dir = item
+		}
+	}
+	return fmt.Sprintf("%dx%d", dir, dir)
+}
+
+func (i *Info) String() string {
+	if i.Format == FormatSVG {
+		return i.Format
+	}
+	return fmt.Sprintf("%s %dx%d", i.Format, i.Width, i.Height)
+}
+
+// 图标在 hicolor 主题中的相对路径，例如 share/icons/hicolor/48x48/apps/foo.png
+func HicolorPath(name string, info *Info) string {
+	return filepath.Join("share/icons/hicolor", info.SizeDir(), "apps", name+info.Ext())
+}
+
+// 图标名，去掉目录和图标格式的后缀
+func Name(value string) string {
+	name := filepath.Base(value)
+	for _, ext := range []string{".png", ".svg", ".xpm", ".svgz"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
@@ -0,0 +1,52 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package icon
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func pngData(width, height int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+	return buf.Bytes()
+}
+
+var testDataDetect = []struct {
+	data    []byte
+	info    string
+	sizeDir string
+}{
+	{pngData(48, 48), "png 48x48", "48x48"},
+	{pngData(50, 40), "png 50x40", "48x48"},
+	{pngData(8, 8), "png 8x8", "16x16"},
+	{pngData(1024, 1024), "png 1024x1024", "512x512"},
+	{[]byte("/* XPM */\nstatic char *foo[] = {\n\"32 32 16 1\",\n"), "xpm 32x32", "32x32"},
+	{[]byte("<?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "svg", "scalable"},
+}
+
+func TestDetect(t *testing.T) {
+	for _, tds := range testDataDetect {
+		info, err := DetectBytes(tds.data)
+		if err != nil {
+			t.Errorf("Failed test for Detect! Error: %s", err)
+			continue
+		}
+		if info.String() != tds.info || info.SizeDir() != tds.sizeDir {
+			t.Errorf("Failed test for Detect! Error: got %s %s, expect %s %s", info, info.SizeDir(), tds.info, tds.sizeDir)
+		}
+	}
+	if _, err := DetectBytes([]byte("GIF89a")); err == nil {
+		t.Errorf("Failed test for Detect! Error: gif should be unsupported")
+	}
+	if ret := HicolorPath(Name("/usr/share/pixmaps/foo.xpm"), &Info{Format: FormatXPM, Width: 32, Height: 32}); ret != "share/icons/hicolor/32x32/apps/foo.xpm" {
+		t.Errorf("Failed test for HicolorPath! Error: got %s", ret)
+	}
+}
@@ -0,0 +1,401 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+// 按声明式的前缀映射重定位解压目录中的文件，改写 ELF 的 DT_RUNPATH/DT_RPATH、pkg-config 的 .pc 文件和绝对路径的软链接
+package relocate
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 改写的类型
+const (
+	KindRunpath   = "runpath"
+	KindRpath     = "rpath"
+	KindPkgConfig = "pkgconfig"
+	KindSymlink   = "symlink"
+)
+
+// RUNPATH 的改写方式
+const (
+	MethodInPlace  = "inplace"  // 直接改写 .dynstr 中的字符串
+	MethodOrigin   = "origin"   // 新路径超出原有长度，改为 $ORIGIN 相对路径后原地改写
+	MethodPatchelf = "patchelf" // 相对路径也放不下，调用 patchelf 重建字符串表
+)
+
+// 一条前缀映射，From 为包内的绝对路径，To 为安装后的路径
+type Mapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// 前缀映射，匹配时最长的 From 优先
+type PrefixMap []Mapping
+
+// 解析 from=to 形式的映射
+func ParsePrefixMap(items []string) (PrefixMap, error) {
+	var m PrefixMap
+	for _, item := range items {
+		from, to, ok := strings.Cut(item, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid prefix map %q, expect from=to", item)
+		}
+		if !filepath.IsAbs(from) {
+			return nil, fmt.Errorf("invalid prefix map %q, from must be an absolute path", item)
+		}
+		m = append(m, Mapping{From: filepath.Clean(from), To: filepath.Clean(to)})
+	}
+	sort.SliceStable(m, func(i, j int) bool {
+		return len(m[i].From) > len(m[j].From)
+	})
+	return m, nil
+}
+
+// 按路径组件匹配前缀，/usr 不匹配 /usrlocal
+func (m PrefixMap) Map(path string) (string, bool) {
+	for _, item := range m {
+		if item.From == "/" {
+			return filepath.Join(item.To, path), true
+		}
+		if path == item.From || strings.HasPrefix(path, item.From+"/") {
+			return item.To + path[len(item.From):], true
+		}
+	}
+	return path, false
+}
+
+type Options struct {
+	Root   string    // 解压目录
+	Map    PrefixMap // 前缀映射
+	System string    // 检查软链接目标是否已经存在的根目录，默认为 /
+	DryRun bool      // 只生成报告，不修改文件
+}
+
+// 一处改写，File 相对于解压目录
+type Change struct {
+	Kind   string `json:"kind"`
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+	Method string `json:"method,omitempty"`
+}
+
+// 无法改写的文件
+type Failure struct {
+	Kind  string `json:"kind"`
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// 重定位报告
+type Report struct {
+	Root     string    `json:"root"`
+	Map      PrefixMap `json:"map"`
+	DryRun   bool      `json:"dry_run,omitempty"`
+	Changes  []Change  `json:"changes"`
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+// pc 文件中的绝对路径，包括 -I/usr/include 和 -L/usr/lib 中的路径
+var pkgConfigPathPattern = regexp.MustCompile(`(^|[=\s"'])(-[IL])?(/[A-Za-z0-9._+@%/-]*)`)
+
+// 遍历解压目录，改写所有能被前缀映射匹配的路径
+func Relocate(opts Options) (*Report, error) {
+	if opts.System == "" {
+		opts.System = "/"
+	}
+	if _, err := os.Stat(opts.Root); err != nil {
+		return nil, err
+	}
+	report := &Report{Root: opts.Root, Map: opts.Map, DryRun: opts.DryRun, Changes: []Change{}}
+	err := filepath.WalkDir(opts.Root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(opts.Root, path)
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			relocateLink(&opts, rel, report)
+		case !entry.Type().IsRegular():
+		case filepath.Ext(rel) == ".pc" && filepath.Base(filepath.Dir(rel)) == "pkgconfig":
+			relocatePkgConfig(&opts, rel, report)
+		case strings.HasPrefix(rel, "usr/lib/debug/"):
+			// 调试符号文件不需要改写
+		case isElf(path):
+			relocateElf(&opts, rel, report)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// 绝对路径的软链接，目标在包内，或者目标在系统中也不存在时改写，指向 base 和 runtime 中已有文件的不改写
+func relocateLink(opts *Options, rel string, report *Report) {
+	path := filepath.Join(opts.Root, rel)
+	target, err := os.Readlink(path)
+	if err != nil || !filepath.IsAbs(target) {
+		return
+	}
+	mapped, ok := opts.Map.Map(target)
+	if !ok || mapped == target {
+		return
+	}
+	if _, err := os.Lstat(filepath.Join(opts.Root, target)); err != nil {
+		if _, err := os.Stat(filepath.Join(opts.System, target)); err == nil {
+			return
+		}
+	}
+	if !opts.DryRun {
+		if err := os.Remove(path); err == nil {
+			err = os.Symlink(mapped, path)
+		}
+		if err != nil {
+			report.Failures = append(report.Failures, Failure{Kind: KindSymlink, File: rel, Error: err.Error()})
+			return
+		}
+	}
+	report.Changes = append(report.Changes, Change{Kind: KindSymlink, File: rel, Old: target, New: mapped})
+}
+
+// 逐行改写 pc 文件中的绝对路径
+func relocatePkgConfig(opts *Options, rel string, report *Report) {
+	path := filepath.Join(opts.Root, rel)
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		report.Failures = append(report.Failures, Failure{Kind: KindPkgConfig, File: rel, Error: err.Error()})
+		return
+	}
+	var changes []Change
+	lines := strings.Split(string(data), "\n")
+	for idx, line := range lines {
+		newLine := pkgConfigPathPattern.ReplaceAllStringFunc(line, func(match string) string {
+			sub := pkgConfigPathPattern.FindStringSubmatch(match)
+			mapped, _ := opts.Map.Map(sub[3])
+			return sub[1] + sub[2] + mapped
+		})
+		if newLine != line {
+			changes = append(changes, Change{Kind: KindPkgConfig, File: rel, Line: idx + 1, Old: line, New: newLine})
+			lines[idx] = newLine
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	if !opts.DryRun {
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), info.Mode().Perm()); err != nil {
+			report.Failures = append(report.Failures, Failure{Kind: KindPkgConfig, File: rel, Error: err.Error()})
+			return
+		}
+	}
+	report.Changes = append(report.Changes, changes...)
+}
+
+// .dynamic 中的一个 DT_RUNPATH 或 DT_RPATH
+type runpathEntry struct {
+	kind   string
+	offset int64 // 字符串在文件中的偏移
+	value  string
+}
+
+// 改写 ELF 文件中的绝对路径 RUNPATH，优先在原有的字符串空间内改写，放不下时调用 patchelf
+func relocateElf(opts *Options, rel string, report *Report) {
+	path := filepath.Join(opts.Root, rel)
+	entries, err := readRunpath(path)
+	if err != nil {
+		report.Failures = append(report.Failures, Failure{Kind: KindRunpath, File: rel, Error: err.Error()})
+		return
+	}
+	var pending []Change
+	done := make(map[int64]bool)
+	for _, entry := range entries {
+		// DT_RPATH 和 DT_RUNPATH 可能指向同一个字符串
+		if done[entry.offset] {
+			continue
+		}
+		done[entry.offset] = true
+		absolute, origin := mapRunpath(opts.Map, rel, entry.value)
+		if absolute == entry.value {
+			continue
+		}
+		change := Change{Kind: entry.kind, File: rel, Old: entry.value, New: absolute, Method: MethodInPlace}
+		if len(absolute) > len(entry.value) {
+			if origin != "" && len(origin) <= len(entry.value) {
+				change.New, change.Method = origin, MethodOrigin
+			} else {
+				change.Method = MethodPatchelf
+			}
+		}
+		if change.Method == MethodPatchelf {
+			pending = append(pending, change)
+			continue
+		}
+		if !opts.DryRun {
+			if err := writeString(path, entry.offset, change.New, len(entry.value)); err != nil {
+				report.Failures = append(report.Failures, Failure{Kind: entry.kind, File: rel, Error: err.Error()})
+				continue
+			}
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	// patchelf 会移动字符串表，需要在原地改写完成之后执行
+	for _, change := range pending {
+		if !opts.DryRun {
+			if err := patchelf(path, change.Kind, change.New); err != nil {
+				report.Failures = append(report.Failures, Failure{Kind: change.Kind, File: rel, Error: err.Error()})
+				continue
+			}
+		}
+		report.Changes = append(report.Changes, change)
+	}
+}
+
+// 读取 .dynamic 中的 DT_RUNPATH 和 DT_RPATH 及其在文件中的位置
+func readRunpath(path string) ([]runpathEntry, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dynamic := file.SectionByType(elf.SHT_DYNAMIC)
+	if dynamic == nil {
+		return nil, nil
+	}
+	if int(dynamic.Link) >= len(file.Sections) {
+		return nil, fmt.Errorf("invalid string table index %d", dynamic.Link)
+	}
+	strtab := file.Sections[dynamic.Link]
+	data, err := dynamic.Data()
+	if err != nil {
+		return nil, err
+	}
+	strs, err := strtab.Data()
+	if err != nil {
+		return nil, err
+	}
+
+	size := 16
+	if file.Class == elf.ELFCLASS32 {
+		size = 8
+	}
+	var entries []runpathEntry
+	for len(data) >= size {
+		var tag elf.DynTag
+		var value uint64
+		if file.Class == elf.ELFCLASS32 {
+			tag = elf.DynTag(int32(file.ByteOrder.Uint32(data[0:4])))
+			value = uint64(file.ByteOrder.Uint32(data[4:8]))
+		} else {
+			tag = elf.DynTag(int64(file.ByteOrder.Uint64(data[0:8])))
+			value = file.ByteOrder.Uint64(data[8:16])
+		}
+		data = data[size:]
+		if tag == elf.DT_NULL {
+			break
+		}
+		if tag != elf.DT_RUNPATH && tag != elf.DT_RPATH {
+			continue
+		}
+		if value >= uint64(len(strs)) {
+			return nil, fmt.Errorf("invalid %s offset %d", tag, value)
+		}
+		end := bytes.IndexByte(strs[value:], 0)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated %s string", tag)
+		}
+		kind := KindRunpath
+		if tag == elf.DT_RPATH {
+			kind = KindRpath
+		}
+		entries = append(entries, runpathEntry{
+			kind:   kind,
+			offset: int64(strtab.Offset + value),
+			value:  string(strs[value : value+uint64(end)]),
+		})
+	}
+	return entries, nil
+}
+
+// 映射 RUNPATH 中的每个绝对路径，同时计算以 $ORIGIN 开头的相对写法，文件本身不能被映射时相对写法为空
+func mapRunpath(m PrefixMap, rel, runpath string) (string, string) {
+	origin := ""
+	fileDir, ok := m.Map(filepath.Dir("/" + rel))
+	var absolute, relative []string
+	for _, item := range strings.Split(runpath, ":") {
+		mapped, matched := m.Map(item)
+		if !filepath.IsAbs(item) || !matched {
+			absolute = append(absolute, item)
+			relative = append(relative, item)
+			continue
+		}
+		absolute = append(absolute, mapped)
+		if ok {
+			if path, err := filepath.Rel(fileDir, mapped); err == nil {
+				relative = append(relative, strings.TrimSuffix("$ORIGIN/"+path, "/."))
+				continue
+			}
+		}
+		ok = false
+	}
+	if ok {
+		origin = strings.Join(relative, ":")
+	}
+	return strings.Join(absolute, ":"), origin
+}
+
+// 在原有的字符串位置写入新值，剩余的空间用 \0 填充
+func writeString(path string, offset int64, value string, size int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buf := make([]byte, size)
+	copy(buf, value)
+	_, err = file.WriteAt(buf, offset)
+	return err
+}
+
+func patchelf(path, kind, value string) error {
+	args := []string{"--set-rpath", value}
+	// 保持 DT_RPATH，patchelf 默认会转换为 DT_RUNPATH
+	if kind == KindRpath {
+		args = append(args, "--force-rpath")
+	}
+	args = append(args, path)
+	out, err := exec.Command("patchelf", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("patchelf: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func isElf(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, []byte(elf.ELFMAG))
+}
@@ -0,0 +1,111 @@
+/*
+ * SPDX-FileCopyrightText: 2024 UnionTech Software Technology Co., Ltd.
+ *
+ * SPDX-License-Identifier: LGPL-3.0-or-later
+ */
+
+package relocate
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrefixMap(t *testing.T) {
+	m, err := ParsePrefixMap([]string{"/usr=/opt/apps/org.test/files", "/usr/lib=/runtime/lib"})
+	if err != nil {
+		t.Fatalf("Failed test for ParsePrefixMap! Error: %s", err)
+	}
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/usr", "/opt/apps/org.test/files", true},
+		{"/usr/bin/foo", "/opt/apps/org.test/files/bin/foo", true},
+		{"/usr/lib/libfoo.so", "/runtime/lib/libfoo.so", true},
+		{"/usrlocal/bin", "/usrlocal/bin", false},
+		{"/etc/foo", "/etc/foo", false},
+	}
+	for _, tc := range tests {
+		if got, ok := m.Map(tc.path); got != tc.want || ok != tc.ok {
+			t.Errorf("Failed test for Map! Error: %s => %s %v, want %s %v", tc.path, got, ok, tc.want, tc.ok)
+		}
+	}
+	if _, err := ParsePrefixMap([]string{"usr=/opt"}); err == nil {
+		t.Errorf("Failed test for ParsePrefixMap! Error: relative from accepted")
+	}
+}
+
+func TestRelocate(t *testing.T) {
+	root := t.TempDir()
+	system := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("usr/lib/x86_64-linux-gnu/pkgconfig/foo.pc", "prefix=/usr\nlibdir=${prefix}/lib\nCflags: -I/usr/include/foo -I/opt/include\n")
+	write("usr/lib/x86_64-linux-gnu/libfoo.so.1", "")
+	os.MkdirAll(filepath.Join(system, "lib/x86_64-linux-gnu"), 0755)
+	os.WriteFile(filepath.Join(system, "lib/x86_64-linux-gnu/libc.so.6"), nil, 0644)
+	os.Symlink("/usr/lib/x86_64-linux-gnu/libfoo.so.1", filepath.Join(root, "usr/lib/x86_64-linux-gnu/libfoo.so"))
+	os.Symlink("/lib/x86_64-linux-gnu/libc.so.6", filepath.Join(root, "usr/lib/x86_64-linux-gnu/libc.so"))
+	os.Symlink("/lib/x86_64-linux-gnu/libbar.so.2", filepath.Join(root, "usr/lib/x86_64-linux-gnu/libbar.so"))
+
+	// 使用 gcc 生成带有绝对路径 RUNPATH 的动态库
+	hasGcc := false
+	if _, err := exec.LookPath("gcc"); err == nil {
+		src := filepath.Join(t.TempDir(), "foo.c")
+		os.WriteFile(src, []byte("int foo(void) { return 0; }\n"), 0644)
+		out := filepath.Join(root, "usr/lib/x86_64-linux-gnu/libbaz.so")
+		cmd := exec.Command("gcc", "-shared", "-fPIC", "-o", out, src,
+			"-Wl,--enable-new-dtags,-rpath,/usr/lib/x86_64-linux-gnu/baz:/usr/lib/x86_64-linux-gnu")
+		hasGcc = cmd.Run() == nil
+	}
+
+	m, _ := ParsePrefixMap([]string{"/usr=/opt/apps/org.test/files", "/lib=/opt/apps/org.test/files/lib"})
+	report, err := Relocate(Options{Root: root, Map: m, System: system})
+	if err != nil {
+		t.Fatalf("Failed test for Relocate! Error: %s", err)
+	}
+	if len(report.Failures) != 0 {
+		t.Errorf("Failed test for Relocate! Error: unexpected failures %+v", report.Failures)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(root, "usr/lib/x86_64-linux-gnu/pkgconfig/foo.pc"))
+	want := "prefix=/opt/apps/org.test/files\nlibdir=${prefix}/lib\nCflags: -I/opt/apps/org.test/files/include/foo -I/opt/include\n"
+	if string(data) != want {
+		t.Errorf("Failed test for Relocate! Error: pc file %q, want %q", data, want)
+	}
+
+	links := map[string]string{
+		"libfoo.so": "/opt/apps/org.test/files/lib/x86_64-linux-gnu/libfoo.so.1",
+		"libc.so":   "/lib/x86_64-linux-gnu/libc.so.6",
+		"libbar.so": "/opt/apps/org.test/files/lib/x86_64-linux-gnu/libbar.so.2",
+	}
+	for name, want := range links {
+		if got, _ := os.Readlink(filepath.Join(root, "usr/lib/x86_64-linux-gnu", name)); got != want {
+			t.Errorf("Failed test for Relocate! Error: link %s => %s, want %s", name, got, want)
+		}
+	}
+
+	if !hasGcc {
+		t.Skip("gcc not available, skip runpath test")
+	}
+	file, err := elf.Open(filepath.Join(root, "usr/lib/x86_64-linux-gnu/libbaz.so"))
+	if err != nil {
+		t.Fatalf("Failed test for Relocate! Error: %s", err)
+	}
+	defer file.Close()
+	runpath, _ := file.DynString(elf.DT_RUNPATH)
+	if strings.Join(runpath, "") != "$ORIGIN/baz:$ORIGIN" {
+		t.Errorf("Failed test for Relocate! Error: runpath %v", runpath)
+	}
+}